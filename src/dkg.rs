@@ -266,6 +266,20 @@ fn other_parties(
         .filter(move |p| *p != party_id)
 }
 
+impl Keyshare {
+    /// Final session ID of the DKG that produced this keyshare. Every
+    /// key rotation or recovery produces a new one, so it identifies the
+    /// generation of the key shares.
+    pub fn final_session_id(&self) -> &[u8; 32] {
+        &self.final_session_id
+    }
+
+    /// Public share `s_j * G` of every party, indexed by party ID.
+    pub fn big_s_list(&self) -> &[AffinePoint] {
+        &self.big_s_list
+    }
+}
+
 impl Party {
     /// Return a party definition with zero ranks.
     pub fn new(n: usize, t: usize, party_id: usize) -> Self {
@@ -279,11 +293,22 @@ impl Party {
 }
 
 impl State {
-    /// Initialize generation of a new distributed key
+    /// Initialize generation of a new distributed key.
+    /// Panics if the ranks of the party are invalid, see `try_new`.
     pub fn new<R: RngCore + CryptoRng>(party: Party, rng: &mut R) -> Self {
         Self::new_with_refresh(party, rng, None).unwrap()
     }
 
+    /// Initialize generation of a new distributed key. Every rank must be
+    /// below the threshold and the parties of lowest rank must be able to
+    /// reach it.
+    pub fn try_new<R: RngCore + CryptoRng>(
+        party: Party,
+        rng: &mut R,
+    ) -> Result<Self, KeygenError> {
+        Self::new_with_refresh(party, rng, None)
+    }
+
     fn new_with_refresh<R: RngCore + CryptoRng>(
         party: Party,
         rng: &mut R,
@@ -303,8 +328,7 @@ impl State {
             }
         }
 
-        // currently we support only zero ranks in this impl.
-        assert!(ranks.iter().all(|&r| r == 0));
+        validate_ranks(&ranks, t)?;
 
         let r_i = rng.gen();
         let session_id = rng.gen();
@@ -378,9 +402,6 @@ impl State {
         let n = party.ranks.len();
         let my_party_id = party.party_id;
 
-        // currently we support only zero ranks in this impl.
-        assert!(party.ranks.iter().all(|&r| r == 0));
-
         let mut s_i_0 = Scalar::ZERO;
         if refresh_share.s_i.is_some() && refresh_share.x_i_list.is_some() {
             // calculate additive share s_i_0 of participant_i,
@@ -395,8 +416,17 @@ impl State {
                 })
                 .collect::<Vec<_>>();
 
-            let lambda =
-                get_lagrange_coeff(x_i, x_i_list, &party_ids_with_keyshares);
+            let lambda = if party.ranks.iter().all(|&r| r == 0) {
+                get_lagrange_coeff(x_i, x_i_list, &party_ids_with_keyshares)
+            } else {
+                get_birkhoff_coeff(
+                    my_party_id,
+                    x_i_list,
+                    &party.ranks,
+                    &party_ids_with_keyshares,
+                )
+                .ok_or(KeygenError::InvalidKeyRefresh)?
+            };
 
             s_i_0 = lambda * s_i;
         }
@@ -1026,6 +1056,23 @@ pub mod tests {
             .collect()
     }
 
+    #[test]
+    fn invalid_ranks() {
+        let mut rng = rand::thread_rng();
+
+        for ranks in [vec![1, 1, 1], vec![0, 2, 0]] {
+            let party = Party {
+                ranks,
+                party_id: 0,
+                t: 2,
+            };
+            assert!(matches!(
+                State::try_new(party, &mut rng),
+                Err(KeygenError::InvalidRanks)
+            ));
+        }
+    }
+
     pub fn dkg(n: u8, t: u8) -> Vec<Keyshare> {
         let parties = init_states(n, t);
 
@@ -224,6 +224,17 @@ impl State {
                 .push(msg.from_id, msg.commitment_r_i);
         }
 
+        // Reject a quorum that can not sign before doing any OT work
+        if !polya_condition(self.sid_list.iter().map(|(p, _)| {
+            self.keyshare
+                .rank_list
+                .get(*p as usize)
+                .copied()
+                .unwrap_or(u8::MAX)
+        })) {
+            return Err(SignError::InvalidQuorum);
+        }
+
         self.final_session_id = self
             .sid_list
             .iter()
@@ -305,12 +316,13 @@ impl State {
                 other_parties(&self.sid_list, my_party_id),
             )
         } else {
-            // let betta_coeffs = get_birkhoff_coefficients(&self.keyshare, &party_idx_to_id_map);
-            // *betta_coeffs
-            //     .get(&(my_party_id as usize))
-            //     .expect("betta_i not found") // FIXME
-
-            unimplemented!()
+            get_birkhoff_coeff(
+                my_party_id,
+                &self.keyshare.x_i_list,
+                &self.keyshare.rank_list,
+                &self.sid_list.iter().map(|(p, _)| *p).collect::<Vec<_>>(),
+            )
+            .ok_or(SignError::InvalidQuorum)?
         };
 
         self.sk_i = coeff * self.keyshare.s_i + self.additive_offset + zeta_i;
@@ -696,6 +708,25 @@ pub fn derive_with_offset(
     Ok((additive_offset, pubkey))
 }
 
+/// Get the public key and chain code of the child key at a derivation
+/// path. Only non-hardened derivation is possible from a public key.
+pub fn derive_child_public_key(
+    public_key: &ProjectivePoint,
+    root_chain_code: &[u8; 32],
+    chain_path: &DerivationPath,
+) -> Result<(ProjectivePoint, [u8; 32]), BIP32Error> {
+    let mut pubkey = *public_key;
+    let mut chain_code = *root_chain_code;
+    for child_num in chain_path {
+        let (_, child_pubkey, child_chain_code) =
+            derive_child_pubkey(&pubkey, chain_code, child_num)?;
+        pubkey = child_pubkey;
+        chain_code = child_chain_code;
+    }
+
+    Ok((pubkey, chain_code))
+}
+
 #[cfg(test)]
 mod tests {
     use crate::dkg::{Party, RefreshShare};
@@ -829,6 +860,56 @@ mod tests {
         dsg(&new_shares[1..]);
     }
 
+    fn ranked_dkg(ranks: &[u8], t: u8) -> Vec<Keyshare> {
+        let mut rng = rand::thread_rng();
+
+        let parties = (0..ranks.len() as u8)
+            .map(|party_id| {
+                crate::dkg::State::try_new(
+                    Party {
+                        ranks: ranks.to_vec(),
+                        party_id,
+                        t,
+                    },
+                    &mut rng,
+                )
+                .unwrap()
+            })
+            .collect();
+
+        dkg_inner(parties)
+    }
+
+    #[test]
+    fn sign_with_ranks() {
+        let mut rng = rand::thread_rng();
+
+        // party 0 and any other party, but never parties 1 and 2 alone
+        let shares = ranked_dkg(&[0, 1, 1], 2);
+        dsg(&shares[..2]);
+        dsg(&[shares[0].clone(), shares[2].clone()]);
+
+        let chain_path = DerivationPath::from_str("m").unwrap();
+        let mut parties = shares[1..]
+            .iter()
+            .map(|s| State::new(&mut rng, s.clone(), &chain_path).unwrap())
+            .collect::<Vec<_>>();
+        let msg1 = parties[1].generate_msg1();
+        assert!(matches!(
+            parties[0].handle_msg1(&mut rng, vec![msg1]),
+            Err(SignError::InvalidQuorum)
+        ));
+
+        let rotation_states = shares
+            .iter()
+            .map(|s| crate::dkg::State::key_rotation(s, &mut rng).unwrap())
+            .collect::<Vec<_>>();
+
+        let new_shares = dkg_inner(rotation_states);
+        assert_eq!(new_shares[2].rank_list, vec![0, 1, 1]);
+        dsg(&[new_shares[0].clone(), new_shares[2].clone()]);
+    }
+
     #[test]
     fn recover_lost_share_and_sign() {
         let mut rng = rand::thread_rng();
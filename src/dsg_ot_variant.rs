@@ -203,6 +203,17 @@ impl State {
                 .push(msg.from_id, msg.commitment_r_i);
         }
 
+        // Reject a quorum that can not sign before doing any OT work
+        if !polya_condition(self.sid_list.iter().map(|(p, _)| {
+            self.keyshare
+                .rank_list
+                .get(*p as usize)
+                .copied()
+                .unwrap_or(u8::MAX)
+        })) {
+            return Err(SignOTVariantError::InvalidQuorum);
+        }
+
         self.final_session_id = self
             .sid_list
             .iter()
@@ -283,12 +294,13 @@ impl State {
                 other_parties(&self.sid_list, my_party_id),
             )
         } else {
-            // let betta_coeffs = get_birkhoff_coefficients(&self.keyshare, &party_idx_to_id_map);
-            // *betta_coeffs
-            //     .get(&(my_party_id as usize))
-            //     .expect("betta_i not found") // FIXME
-
-            unimplemented!()
+            get_birkhoff_coeff(
+                my_party_id,
+                &self.keyshare.x_i_list,
+                &self.keyshare.rank_list,
+                &self.sid_list.iter().map(|(p, _)| *p).collect::<Vec<_>>(),
+            )
+            .ok_or(SignOTVariantError::InvalidQuorum)?
         };
 
         self.sk_i = coeff * self.keyshare.s_i + self.additive_offset + zeta_i;
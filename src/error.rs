@@ -54,6 +54,10 @@ pub enum KeygenError {
     #[error("Invalid key refresh")]
     /// Invalid key refresh
     InvalidKeyRefresh,
+
+    /// Ranks that no set of threshold parties can sign with
+    #[error("Invalid ranks")]
+    InvalidRanks,
 }
 
 /// Distributed key generation errors
@@ -85,6 +89,10 @@ pub enum SignError {
     /// Abort the protocol and ban the party
     #[error("Abort the protocol and ban the party {0}")]
     AbortProtocolAndBanParty(u8),
+
+    /// The ranks of the signing parties do not allow them to sign
+    #[error("Signing parties do not satisfy the rank rules")]
+    InvalidQuorum,
 }
 
 /// Distributed key generation errors (OT variant)
@@ -116,6 +124,10 @@ pub enum SignOTVariantError {
     /// Invalid RVOLE
     #[error("Invalid RVOLE")]
     Rvole,
+
+    /// The ranks of the signing parties do not allow them to sign
+    #[error("Signing parties do not satisfy the rank rules")]
+    InvalidQuorum,
 }
 
 impl From<SignError> for SignOTVariantError {
@@ -134,6 +146,7 @@ impl From<SignError> for SignOTVariantError {
             SignError::AbortProtocolAndBanParty(_) => {
                 SignOTVariantError::Rvole
             }
+            SignError::InvalidQuorum => SignOTVariantError::InvalidQuorum,
         }
     }
 }
@@ -152,6 +152,60 @@ where
     })
 }
 
+/// Pólya condition of Birkhoff interpolation: sorted in ascending
+/// order, the i-th rank is at most i. A set of parties can interpolate
+/// the secret only if its ranks satisfy it.
+pub(crate) fn polya_condition(ranks: impl Iterator<Item = u8>) -> bool {
+    let mut ranks = ranks.collect::<Vec<_>>();
+    ranks.sort_unstable();
+    ranks.iter().enumerate().all(|(i, &r)| r as usize <= i)
+}
+
+/// Check the ranks of a key with threshold `t`. A rank must be below `t`,
+/// and the `t` parties of lowest rank must be able to sign.
+pub(crate) fn validate_ranks(ranks: &[u8], t: u8) -> Result<(), KeygenError> {
+    if ranks.iter().any(|&r| r >= t)
+        || !polya_condition(ranks.iter().copied())
+    {
+        return Err(KeygenError::InvalidRanks);
+    }
+    Ok(())
+}
+
+/// Birkhoff coefficient of `party_id` to interpolate the secret from the
+/// shares of `party_ids`. Returns None if their ranks do not satisfy the
+/// Pólya condition.
+pub(crate) fn get_birkhoff_coeff(
+    party_id: u8,
+    x_i_list: &[NonZeroScalar],
+    rank_list: &[u8],
+    party_ids: &[u8],
+) -> Option<Scalar> {
+    if !polya_condition(party_ids.iter().map(|&p| rank_list[p as usize])) {
+        return None;
+    }
+
+    let mut party_params_list = party_ids
+        .iter()
+        .map(|&p| (p, x_i_list[p as usize], rank_list[p as usize] as usize))
+        .collect::<Vec<_>>();
+
+    party_params_list.sort_by_key(|&(_, _, n_i)| n_i);
+
+    let params = party_params_list
+        .iter()
+        .map(|&(_, x_i, n_i)| (x_i, n_i))
+        .collect::<Vec<_>>();
+
+    let betta_vector = birkhoff_coeffs(&params);
+
+    party_params_list
+        .iter()
+        .zip(betta_vector)
+        .find(|((p, _, _), _)| *p == party_id)
+        .map(|(_, betta_i)| betta_i)
+}
+
 pub(crate) fn check_secret_recovery(
     x_i_list: &[NonZeroScalar],
     rank_list: &[u8],
@@ -0,0 +1,91 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/internal/base58"
+)
+
+// Network selects the version bytes of a serialized extended key
+type Network int
+
+const (
+	// Mainnet keys serialize as "xpub..."
+	Mainnet Network = iota
+	// Testnet keys serialize as "tpub..."
+	Testnet
+)
+
+func (n Network) pubVersion() ([]byte, error) {
+	switch n {
+	case Mainnet:
+		return []byte{0x04, 0x88, 0xb2, 0x1e}, nil
+	case Testnet:
+		return []byte{0x04, 0x35, 0x87, 0xcf}, nil
+	}
+	return nil, fmt.Errorf("unknown network %d", n)
+}
+
+// ExtendedPublicKey returns the BIP32 extended public key (xpub or tpub)
+// of the child key at path, e.g. "m/0/1". Only non-hardened paths can be
+// derived from the public key.
+func (k *Keyshare) ExtendedPublicKey(path string, network Network) (string, error) {
+	version, err := network.pubVersion()
+	if err != nil {
+		return "", err
+	}
+	parsed, err := ParsePath(path)
+	if err != nil {
+		return "", err
+	}
+	pubKey, chainCode, err := k.DerivePublicKey(path)
+	if err != nil {
+		return "", err
+	}
+
+	var fingerprint []byte
+	var childNumber uint32
+	if len(parsed) > 0 {
+		parentKey, _, err := k.DerivePublicKey(parsed.Parent().String())
+		if err != nil {
+			return "", err
+		}
+		fingerprint = hash160(parentKey)[:4]
+		childNumber = parsed[len(parsed)-1]
+	}
+	return serializeExtendedKey(version, uint8(len(parsed)), fingerprint, childNumber, chainCode, pubKey)
+}
+
+// serializeExtendedKey encodes an extended key as in BIP32. fingerprint
+// is nil for the master key.
+func serializeExtendedKey(version []byte, depth uint8, fingerprint []byte, childNumber uint32, chainCode, key []byte) (string, error) {
+	if len(chainCode) != 32 || len(key) != 33 {
+		return "", fmt.Errorf("invalid extended key")
+	}
+	buf := make([]byte, 0, 78)
+	buf = append(buf, version...)
+	buf = append(buf, depth)
+	if fingerprint == nil {
+		fingerprint = make([]byte, 4)
+	}
+	buf = append(buf, fingerprint...)
+	buf = append(buf, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], childNumber)
+	buf = append(buf, chainCode...)
+	buf = append(buf, key...)
+	return base58.CheckEncode(buf), nil
+}
+
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// BIP32 test vector 1
+func TestSerializeExtendedKey(t *testing.T) {
+	version, _ := Mainnet.pubVersion()
+	master, err := serializeExtendedKey(version, 0, nil, 0,
+		mustHex(t, "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508"),
+		mustHex(t, "0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"; master != want {
+		t.Errorf("master xpub mismatch:\n got %s\nwant %s", master, want)
+	}
+
+	// m/0H/1; the parent m/0H has fingerprint 5c1bd648
+	child, err := serializeExtendedKey(version, 2, mustHex(t, "5c1bd648"), 1,
+		mustHex(t, "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19"),
+		mustHex(t, "03501e454bf00751f24b1b489aa925215d66af2234e3891c3b21a52bedb3cd711c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"; child != want {
+		t.Errorf("child xpub mismatch:\n got %s\nwant %s", child, want)
+	}
+
+	// The fingerprint of m/0H is HASH160 of the master public key
+	if fp := hash160(mustHex(t, "0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2"))[:4]; !bytes.Equal(fp, mustHex(t, "3442193e")) {
+		t.Errorf("unexpected fingerprint %x", fp)
+	}
+}
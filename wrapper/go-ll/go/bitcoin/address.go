@@ -0,0 +1,154 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+// Package bitcoin derives Bitcoin addresses from a keyshare and signs
+// BIP174 partially signed transactions (PSBTs) with the distributed sign
+// protocol.
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/internal/base58"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/internal/bech32"
+)
+
+// Network holds the address prefixes of a Bitcoin network
+type Network struct {
+	Name string
+	// PubKeyHashAddrID is the version byte of P2PKH addresses
+	PubKeyHashAddrID byte
+	// ScriptHashAddrID is the version byte of P2SH addresses
+	ScriptHashAddrID byte
+	// Bech32HRP is the human-readable part of segwit addresses
+	Bech32HRP string
+}
+
+var (
+	// MainNet is the Bitcoin main network
+	MainNet = &Network{Name: "mainnet", PubKeyHashAddrID: 0x00, ScriptHashAddrID: 0x05, Bech32HRP: "bc"}
+	// TestNet is the Bitcoin test network, testnet3 and signet
+	TestNet = &Network{Name: "testnet", PubKeyHashAddrID: 0x6f, ScriptHashAddrID: 0xc4, Bech32HRP: "tb"}
+	// RegTest is the Bitcoin regression test network
+	RegTest = &Network{Name: "regtest", PubKeyHashAddrID: 0x6f, ScriptHashAddrID: 0xc4, Bech32HRP: "bcrt"}
+)
+
+// AddressType selects the output script an address pays to
+type AddressType int
+
+const (
+	// P2PKH is a legacy pay-to-pubkey-hash address, "1..."
+	P2PKH AddressType = iota
+	// P2SHP2WPKH is a P2WPKH program nested in a P2SH address, "3..."
+	P2SHP2WPKH
+	// P2WPKH is a native segwit v0 address, "bc1q..."
+	P2WPKH
+)
+
+func (t AddressType) String() string {
+	switch t {
+	case P2PKH:
+		return "p2pkh"
+	case P2SHP2WPKH:
+		return "p2sh-p2wpkh"
+	case P2WPKH:
+		return "p2wpkh"
+	}
+	return fmt.Sprintf("AddressType(%d)", int(t))
+}
+
+// Hash160 returns RIPEMD-160(SHA-256(data))
+func Hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+func checkPubKey(pubKey []byte) error {
+	if len(pubKey) != 33 || (pubKey[0] != 0x02 && pubKey[0] != 0x03) {
+		return errors.New("public key must be 33 bytes compressed")
+	}
+	return nil
+}
+
+// p2pkhScript returns OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+func p2pkhScript(hash []byte) []byte {
+	return append(append([]byte{0x76, 0xa9, 0x14}, hash...), 0x88, 0xac)
+}
+
+// p2wpkhScript returns OP_0 <hash>
+func p2wpkhScript(hash []byte) []byte {
+	return append([]byte{0x00, 0x14}, hash...)
+}
+
+// p2shScript returns OP_HASH160 <hash> OP_EQUAL
+func p2shScript(hash []byte) []byte {
+	return append(append([]byte{0xa9, 0x14}, hash...), 0x87)
+}
+
+// ScriptPubKey returns the output script paying the compressed public
+// key with the given address type
+func ScriptPubKey(pubKey []byte, typ AddressType) ([]byte, error) {
+	if err := checkPubKey(pubKey); err != nil {
+		return nil, err
+	}
+	hash := Hash160(pubKey)
+	switch typ {
+	case P2PKH:
+		return p2pkhScript(hash), nil
+	case P2SHP2WPKH:
+		return p2shScript(Hash160(p2wpkhScript(hash))), nil
+	case P2WPKH:
+		return p2wpkhScript(hash), nil
+	}
+	return nil, fmt.Errorf("unknown address type %d", typ)
+}
+
+// Address returns the address of a compressed public key
+func Address(pubKey []byte, typ AddressType, net *Network) (string, error) {
+	if err := checkPubKey(pubKey); err != nil {
+		return "", err
+	}
+	hash := Hash160(pubKey)
+	switch typ {
+	case P2PKH:
+		return base58.CheckEncode(append([]byte{net.PubKeyHashAddrID}, hash...)), nil
+	case P2SHP2WPKH:
+		return base58.CheckEncode(append([]byte{net.ScriptHashAddrID}, Hash160(p2wpkhScript(hash))...)), nil
+	case P2WPKH:
+		program, err := bech32.ConvertBits(hash, 8, 5, true)
+		if err != nil {
+			return "", err
+		}
+		return bech32.Encode(net.Bech32HRP, append([]byte{0}, program...))
+	}
+	return "", fmt.Errorf("unknown address type %d", typ)
+}
+
+// DeriveAddress returns the address of the child key at a non-hardened
+// path, e.g. "m/84/0/0/0/0"
+func DeriveAddress(keyshare *dkls.Keyshare, path string, typ AddressType, net *Network) (string, error) {
+	pubKey, _, err := keyshare.DerivePublicKey(path)
+	if err != nil {
+		return "", err
+	}
+	return Address(pubKey, typ, net)
+}
+
+// scriptType returns the address type of an output script paying pubKey,
+// and false if the script does not pay it
+func scriptType(script, pubKey []byte) (AddressType, bool) {
+	for _, typ := range []AddressType{P2WPKH, P2SHP2WPKH, P2PKH} {
+		if want, err := ScriptPubKey(pubKey, typ); err == nil && bytes.Equal(script, want) {
+			return typ, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// The generator point, the public key of the private key 1
+const testPubKey = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+func TestAddress(t *testing.T) {
+	pubKey := mustHex(t, testPubKey)
+	tests := []struct {
+		typ  AddressType
+		net  *Network
+		want string
+	}{
+		{P2PKH, MainNet, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"},
+		{P2PKH, TestNet, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r"},
+		{P2SHP2WPKH, MainNet, "3JvL6Ymt8MVWiCNHC7oWU6nLeHNJKLZGLN"},
+		{P2SHP2WPKH, TestNet, "2NAUYAHhujozruyzpsFRP63mbrdaU5wnEpN"},
+		{P2WPKH, MainNet, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{P2WPKH, TestNet, "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"},
+	}
+	for _, tt := range tests {
+		got, err := Address(pubKey, tt.typ, tt.net)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.typ, tt.net.Name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s %s: got %s, want %s", tt.typ, tt.net.Name, got, tt.want)
+		}
+	}
+
+	uncompressed := append([]byte{0x04}, make([]byte, 64)...)
+	if _, err := Address(uncompressed, P2PKH, MainNet); err == nil {
+		t.Error("expected an error for an uncompressed key")
+	}
+}
+
+func TestScriptType(t *testing.T) {
+	pubKey := mustHex(t, testPubKey)
+	for _, typ := range []AddressType{P2PKH, P2SHP2WPKH, P2WPKH} {
+		script, err := ScriptPubKey(pubKey, typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := scriptType(script, pubKey); !ok || got != typ {
+			t.Errorf("%s: got %s, %v", typ, got, ok)
+		}
+	}
+	if _, ok := scriptType(mustHex(t, "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1"), pubKey); ok {
+		t.Error("expected no match for another key")
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+)
+
+// ErrInvalidPSBT is returned for a malformed BIP174 packet
+var ErrInvalidPSBT = errors.New("invalid PSBT")
+
+var psbtMagic = []byte{'p', 's', 'b', 't', 0xff}
+
+// Key types of BIP174 version 0
+const (
+	globalUnsignedTx = 0x00
+	globalVersion    = 0xfb
+
+	inputNonWitnessUtxo     = 0x00
+	inputWitnessUtxo        = 0x01
+	inputPartialSig         = 0x02
+	inputSighashType        = 0x03
+	inputRedeemScript       = 0x04
+	inputWitnessScript      = 0x05
+	inputBip32Derivation    = 0x06
+	inputFinalScriptSig     = 0x07
+	inputFinalScriptWitness = 0x08
+
+	outputRedeemScript    = 0x00
+	outputWitnessScript   = 0x01
+	outputBip32Derivation = 0x02
+)
+
+// Unknown is a key-value pair the package does not interpret. It is kept
+// so that the packet serializes unchanged.
+type Unknown struct {
+	Key, Value []byte
+}
+
+// PartialSig is a DER signature with the sighash type byte appended, made
+// by PubKey
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// Bip32Derivation records the path of PubKey below the master key with
+// the given fingerprint
+type Bip32Derivation struct {
+	PubKey            []byte
+	MasterFingerprint [4]byte
+	Path              dkls.DerivationPath
+}
+
+// Input holds the per-input fields of a packet
+type Input struct {
+	NonWitnessUtxo     *Tx
+	WitnessUtxo        *TxOut
+	PartialSigs        []*PartialSig
+	SighashType        SigHashType // 0 when unset, which signs with SigHashAll
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivation    []*Bip32Derivation
+	FinalScriptSig     []byte
+	FinalScriptWitness [][]byte
+	Unknowns           []*Unknown
+}
+
+// Output holds the per-output fields of a packet
+type Output struct {
+	RedeemScript    []byte
+	WitnessScript   []byte
+	Bip32Derivation []*Bip32Derivation
+	Unknowns        []*Unknown
+}
+
+// Packet is a BIP174 partially signed Bitcoin transaction, version 0
+type Packet struct {
+	UnsignedTx *Tx
+	Inputs     []*Input
+	Outputs    []*Output
+	Unknowns   []*Unknown
+}
+
+// NewPacket creates a packet for an unsigned transaction
+func NewPacket(tx *Tx) (*Packet, error) {
+	if err := checkUnsigned(tx); err != nil {
+		return nil, err
+	}
+	p := &Packet{UnsignedTx: tx}
+	for range tx.TxIn {
+		p.Inputs = append(p.Inputs, &Input{})
+	}
+	for range tx.TxOut {
+		p.Outputs = append(p.Outputs, &Output{})
+	}
+	return p, nil
+}
+
+func checkUnsigned(tx *Tx) error {
+	for _, in := range tx.TxIn {
+		if len(in.SignatureScript) != 0 || len(in.Witness) != 0 {
+			return fmt.Errorf("%w: transaction has signatures", ErrInvalidPSBT)
+		}
+	}
+	return nil
+}
+
+// ParsePacket parses a binary PSBT
+func ParsePacket(data []byte) (*Packet, error) {
+	if !bytes.HasPrefix(data, psbtMagic) {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidPSBT)
+	}
+	r := &reader{buf: data[len(psbtMagic):]}
+	p, err := readPacket(r)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPSBT) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPSBT, err)
+	}
+	if len(r.buf) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidPSBT)
+	}
+	return p, nil
+}
+
+// ParsePacketBase64 parses a base64 PSBT, as exchanged by wallets
+func ParsePacketBase64(s string) (*Packet, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPSBT, err)
+	}
+	return ParsePacket(data)
+}
+
+func readPacket(r *reader) (*Packet, error) {
+	p := &Packet{}
+	err := readMap(r, func(key, value []byte) error {
+		switch key[0] {
+		case globalUnsignedTx:
+			if len(key) != 1 {
+				return errors.New("invalid unsigned tx key")
+			}
+			tx, err := ParseTx(value)
+			if err != nil {
+				return err
+			}
+			if err := checkUnsigned(tx); err != nil {
+				return err
+			}
+			p.UnsignedTx = tx
+		case globalVersion:
+			if len(key) != 1 || len(value) != 4 {
+				return errors.New("invalid version")
+			}
+			if v := binary.LittleEndian.Uint32(value); v != 0 {
+				return fmt.Errorf("unsupported PSBT version %d", v)
+			}
+			p.Unknowns = append(p.Unknowns, &Unknown{Key: key, Value: value})
+		default:
+			p.Unknowns = append(p.Unknowns, &Unknown{Key: key, Value: value})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.UnsignedTx == nil {
+		return nil, errors.New("missing unsigned transaction")
+	}
+
+	for range p.UnsignedTx.TxIn {
+		in := &Input{}
+		if err := readMap(r, in.set); err != nil {
+			return nil, err
+		}
+		p.Inputs = append(p.Inputs, in)
+	}
+	for range p.UnsignedTx.TxOut {
+		out := &Output{}
+		if err := readMap(r, out.set); err != nil {
+			return nil, err
+		}
+		p.Outputs = append(p.Outputs, out)
+	}
+	return p, nil
+}
+
+// readMap reads key-value pairs up to the 0x00 separator, rejecting
+// duplicate keys
+func readMap(r *reader, set func(key, value []byte) error) error {
+	seen := make(map[string]bool)
+	for {
+		key, err := r.varBytes()
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return nil
+		}
+		value, err := r.varBytes()
+		if err != nil {
+			return err
+		}
+		if seen[string(key)] {
+			return fmt.Errorf("duplicate key %x", key)
+		}
+		seen[string(key)] = true
+		if err := set(key, value); err != nil {
+			return err
+		}
+	}
+}
+
+func (in *Input) set(key, value []byte) error {
+	var err error
+	switch key[0] {
+	case inputNonWitnessUtxo:
+		err = checkKeyLen(key, 1)
+		if err == nil {
+			in.NonWitnessUtxo, err = ParseTx(value)
+		}
+	case inputWitnessUtxo:
+		err = checkKeyLen(key, 1)
+		if err == nil {
+			in.WitnessUtxo, err = parseTxOut(value)
+		}
+	case inputPartialSig:
+		err = checkKeyLen(key, 34)
+		in.PartialSigs = append(in.PartialSigs, &PartialSig{PubKey: key[1:], Signature: value})
+	case inputSighashType:
+		err = checkKeyLen(key, 1)
+		if err == nil && len(value) != 4 {
+			err = errors.New("invalid sighash type")
+		}
+		if err == nil {
+			in.SighashType = SigHashType(binary.LittleEndian.Uint32(value))
+		}
+	case inputRedeemScript:
+		err = checkKeyLen(key, 1)
+		in.RedeemScript = value
+	case inputWitnessScript:
+		err = checkKeyLen(key, 1)
+		in.WitnessScript = value
+	case inputBip32Derivation:
+		var d *Bip32Derivation
+		d, err = parseBip32Derivation(key, value)
+		in.Bip32Derivation = append(in.Bip32Derivation, d)
+	case inputFinalScriptSig:
+		err = checkKeyLen(key, 1)
+		in.FinalScriptSig = value
+	case inputFinalScriptWitness:
+		err = checkKeyLen(key, 1)
+		if err == nil {
+			r := &reader{buf: value}
+			in.FinalScriptWitness, err = r.witness()
+			if err == nil && len(r.buf) != 0 {
+				err = errors.New("invalid final witness")
+			}
+		}
+	default:
+		in.Unknowns = append(in.Unknowns, &Unknown{Key: key, Value: value})
+	}
+	return err
+}
+
+func (out *Output) set(key, value []byte) error {
+	var err error
+	switch key[0] {
+	case outputRedeemScript:
+		err = checkKeyLen(key, 1)
+		out.RedeemScript = value
+	case outputWitnessScript:
+		err = checkKeyLen(key, 1)
+		out.WitnessScript = value
+	case outputBip32Derivation:
+		var d *Bip32Derivation
+		d, err = parseBip32Derivation(key, value)
+		out.Bip32Derivation = append(out.Bip32Derivation, d)
+	default:
+		out.Unknowns = append(out.Unknowns, &Unknown{Key: key, Value: value})
+	}
+	return err
+}
+
+func checkKeyLen(key []byte, n int) error {
+	if len(key) != n {
+		return fmt.Errorf("invalid key length for type 0x%02x", key[0])
+	}
+	return nil
+}
+
+func parseTxOut(value []byte) (*TxOut, error) {
+	r := &reader{buf: value}
+	amount, err := r.uint64()
+	if err != nil {
+		return nil, err
+	}
+	script, err := r.varBytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(r.buf) != 0 {
+		return nil, errors.New("invalid witness utxo")
+	}
+	return &TxOut{Value: int64(amount), PkScript: script}, nil
+}
+
+func parseBip32Derivation(key, value []byte) (*Bip32Derivation, error) {
+	if len(key) != 34 || checkPubKey(key[1:]) != nil {
+		return nil, errors.New("invalid BIP32 derivation key")
+	}
+	if len(value) < 4 || len(value)%4 != 0 {
+		return nil, errors.New("invalid BIP32 derivation")
+	}
+	d := &Bip32Derivation{PubKey: key[1:]}
+	copy(d.MasterFingerprint[:], value)
+	for i := 4; i < len(value); i += 4 {
+		d.Path = append(d.Path, binary.LittleEndian.Uint32(value[i:]))
+	}
+	return d, nil
+}
+
+func (d *Bip32Derivation) value() []byte {
+	var w writer
+	w.write(d.MasterFingerprint[:])
+	for _, index := range d.Path {
+		w.uint32(index)
+	}
+	return w.buf
+}
+
+// Serialize returns the binary PSBT
+func (p *Packet) Serialize() []byte {
+	var w writer
+	w.write(psbtMagic)
+	writePair(&w, []byte{globalUnsignedTx}, p.UnsignedTx.serialize(false))
+	writeUnknowns(&w, p.Unknowns)
+	w.write([]byte{0x00})
+
+	for _, in := range p.Inputs {
+		if in.NonWitnessUtxo != nil {
+			writePair(&w, []byte{inputNonWitnessUtxo}, in.NonWitnessUtxo.Serialize())
+		}
+		if in.WitnessUtxo != nil {
+			var v writer
+			in.WitnessUtxo.write(&v)
+			writePair(&w, []byte{inputWitnessUtxo}, v.buf)
+		}
+		for _, sig := range in.PartialSigs {
+			writePair(&w, append([]byte{inputPartialSig}, sig.PubKey...), sig.Signature)
+		}
+		if in.SighashType != 0 {
+			var v writer
+			v.uint32(uint32(in.SighashType))
+			writePair(&w, []byte{inputSighashType}, v.buf)
+		}
+		if in.RedeemScript != nil {
+			writePair(&w, []byte{inputRedeemScript}, in.RedeemScript)
+		}
+		if in.WitnessScript != nil {
+			writePair(&w, []byte{inputWitnessScript}, in.WitnessScript)
+		}
+		for _, d := range in.Bip32Derivation {
+			writePair(&w, append([]byte{inputBip32Derivation}, d.PubKey...), d.value())
+		}
+		if in.FinalScriptSig != nil {
+			writePair(&w, []byte{inputFinalScriptSig}, in.FinalScriptSig)
+		}
+		if in.FinalScriptWitness != nil {
+			var v writer
+			v.witness(in.FinalScriptWitness)
+			writePair(&w, []byte{inputFinalScriptWitness}, v.buf)
+		}
+		writeUnknowns(&w, in.Unknowns)
+		w.write([]byte{0x00})
+	}
+
+	for _, out := range p.Outputs {
+		if out.RedeemScript != nil {
+			writePair(&w, []byte{outputRedeemScript}, out.RedeemScript)
+		}
+		if out.WitnessScript != nil {
+			writePair(&w, []byte{outputWitnessScript}, out.WitnessScript)
+		}
+		for _, d := range out.Bip32Derivation {
+			writePair(&w, append([]byte{outputBip32Derivation}, d.PubKey...), d.value())
+		}
+		writeUnknowns(&w, out.Unknowns)
+		w.write([]byte{0x00})
+	}
+	return w.buf
+}
+
+// Base64 returns the base64 PSBT
+func (p *Packet) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.Serialize())
+}
+
+func writePair(w *writer, key, value []byte) {
+	w.varBytes(key)
+	w.varBytes(value)
+}
+
+func writeUnknowns(w *writer, unknowns []*Unknown) {
+	for _, u := range unknowns {
+		writePair(w, u.Key, u.Value)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// A valid packet of BIP174 with one P2PKH input
+const testPSBT = "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQXE8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2DpD9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwDlIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJRjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAAAAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kUM5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZzMlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2YVi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlMDDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQDHAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhPKrMAAAAAAAAA"
+
+func TestParsePacket(t *testing.T) {
+	p, err := ParsePacketBase64(testPSBT)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if len(p.Inputs) != 1 || len(p.Outputs) != 2 {
+		t.Fatalf("expected 1 input and 2 outputs, got %d and %d", len(p.Inputs), len(p.Outputs))
+	}
+	if p.Inputs[0].NonWitnessUtxo == nil {
+		t.Fatal("expected a previous transaction")
+	}
+	if _, err := p.prevOut(0); err != nil {
+		t.Errorf("previous transaction does not match: %v", err)
+	}
+	if p.Base64() != testPSBT {
+		t.Error("packet does not round trip")
+	}
+
+	// Unknown and proprietary entries are kept
+	p.Unknowns = append(p.Unknowns, &Unknown{Key: []byte{0xfc, 0x01}, Value: []byte{0x02}})
+	p.Outputs[1].Unknowns = append(p.Outputs[1].Unknowns, &Unknown{Key: []byte{0x0f}, Value: []byte{0x03}})
+	parsed, err := ParsePacket(p.Serialize())
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if !bytes.Equal(parsed.Serialize(), p.Serialize()) || len(parsed.Unknowns) != 1 || len(parsed.Outputs[1].Unknowns) != 1 {
+		t.Error("unknown entries do not round trip")
+	}
+}
+
+func TestParsePacketInvalid(t *testing.T) {
+	raw, _ := base64.StdEncoding.DecodeString(testPSBT)
+	signed, err := ParsePacket(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed.UnsignedTx.TxIn[0].SignatureScript = []byte{0x51}
+	duplicate := append([]byte{}, raw[:len(raw)-3]...)
+	duplicate = append(duplicate, 0x02, 0x0f, 0x00, 0x00, 0x02, 0x0f, 0x00, 0x00, 0x00, 0x00)
+
+	tests := map[string][]byte{
+		"bad magic":     append([]byte("psbu"), raw[4:]...),
+		"truncated":     raw[:len(raw)-1],
+		"trailing data": append(append([]byte{}, raw...), 0x00),
+		"signed tx":     signed.Serialize(),
+		"duplicate key": duplicate,
+	}
+	for name, data := range tests {
+		if _, err := ParsePacket(data); !errors.Is(err, ErrInvalidPSBT) {
+			t.Errorf("%s: expected ErrInvalidPSBT, got %v", name, err)
+		}
+	}
+	if _, err := NewPacket(signed.UnsignedTx); !errors.Is(err, ErrInvalidPSBT) {
+		t.Errorf("expected ErrInvalidPSBT for a signed transaction, got %v", err)
+	}
+}
+
+// testPacket returns a packet spending one output of each address type
+// paid to pubKey
+func testPacket(t *testing.T, pubKey []byte) *Packet {
+	t.Helper()
+	prev := &Tx{Version: 2}
+	for _, typ := range []AddressType{P2PKH, P2SHP2WPKH, P2WPKH} {
+		script, err := ScriptPubKey(pubKey, typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev.TxIn = []*TxIn{{Sequence: 0xffffffff}}
+		prev.TxOut = append(prev.TxOut, &TxOut{Value: 100000, PkScript: script})
+	}
+	tx := &Tx{Version: 2, LockTime: 0}
+	for i := range prev.TxOut {
+		tx.TxIn = append(tx.TxIn, &TxIn{PreviousOutPoint: OutPoint{Hash: prev.TxHash(), Index: uint32(i)}, Sequence: 0xfffffffd})
+	}
+	tx.TxOut = []*TxOut{{Value: 290000, PkScript: p2wpkhScript(make([]byte, 20))}}
+	p, err := NewPacket(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, in := range p.Inputs {
+		in.NonWitnessUtxo = prev
+		if i > 0 {
+			in.WitnessUtxo = prev.TxOut[i]
+		}
+	}
+	return p
+}
+
+func TestFinalize(t *testing.T) {
+	pubKey := mustHex(t, testPubKey)
+	p := testPacket(t, pubKey)
+	if err := p.Finalize(); err == nil {
+		t.Fatal("expected an error without signatures")
+	}
+	if _, err := p.Extract(); err == nil {
+		t.Fatal("expected an error for a packet that is not final")
+	}
+
+	sig := append(bytes.Repeat([]byte{0x30}, 71), byte(SigHashAll))
+	for _, in := range p.Inputs {
+		in.PartialSigs = []*PartialSig{{PubKey: pubKey, Signature: sig}}
+		in.Bip32Derivation = []*Bip32Derivation{{PubKey: pubKey, Path: []uint32{0}}}
+	}
+	if err := p.Finalize(); err != nil {
+		t.Fatalf("failed to finalize: %v", err)
+	}
+
+	p2pkh := append(pushData(sig), pushData(pubKey)...)
+	if !bytes.Equal(p.Inputs[0].FinalScriptSig, p2pkh) || p.Inputs[0].FinalScriptWitness != nil {
+		t.Errorf("unexpected P2PKH finalization %x", p.Inputs[0].FinalScriptSig)
+	}
+	if !bytes.Equal(p.Inputs[1].FinalScriptSig, pushData(p2wpkhScript(Hash160(pubKey)))) || len(p.Inputs[1].FinalScriptWitness) != 2 {
+		t.Errorf("unexpected P2SH-P2WPKH finalization %x", p.Inputs[1].FinalScriptSig)
+	}
+	if p.Inputs[2].FinalScriptSig != nil || !bytes.Equal(p.Inputs[2].FinalScriptWitness[1], pubKey) {
+		t.Error("unexpected P2WPKH finalization")
+	}
+	for i, in := range p.Inputs {
+		if in.PartialSigs != nil || in.Bip32Derivation != nil {
+			t.Errorf("input %d: expected signing fields to be dropped", i)
+		}
+	}
+
+	parsed, err := ParsePacket(p.Serialize())
+	if err != nil {
+		t.Fatalf("failed to parse finalized packet: %v", err)
+	}
+	tx, err := parsed.Extract()
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if !bytes.Equal(tx.TxIn[0].SignatureScript, p2pkh) || len(tx.TxIn[2].Witness) != 2 {
+		t.Error("unexpected extracted transaction")
+	}
+	if _, err := ParseTx(tx.Serialize()); err != nil {
+		t.Errorf("failed to parse extracted transaction: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SigHashType selects the parts of a transaction a signature commits to
+type SigHashType uint32
+
+// Sighash types. SigHashAnyOneCanPay is combined with one of the others.
+const (
+	SigHashAll          SigHashType = 0x01
+	SigHashNone         SigHashType = 0x02
+	SigHashSingle       SigHashType = 0x03
+	SigHashAnyOneCanPay SigHashType = 0x80
+)
+
+func (t SigHashType) check() error {
+	switch t &^ SigHashAnyOneCanPay {
+	case SigHashAll, SigHashNone, SigHashSingle:
+		return nil
+	}
+	return fmt.Errorf("unsupported sighash type 0x%x", uint32(t))
+}
+
+// errSingleNoOutput is returned for SIGHASH_SINGLE on an input without a
+// matching output. The signature would commit to no output at all, so
+// anyone could redirect the input; it is refused.
+var errSingleNoOutput = errors.New("SIGHASH_SINGLE input has no matching output")
+
+// LegacySigHash returns the pre-segwit signature hash of input idx.
+// scriptCode is the script of the output being spent, or the redeem script
+// for P2SH. It must not contain OP_CODESEPARATOR.
+func LegacySigHash(tx *Tx, idx int, scriptCode []byte, hashType SigHashType) ([]byte, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input %d out of range", idx)
+	}
+	if err := hashType.check(); err != nil {
+		return nil, err
+	}
+	base := hashType &^ SigHashAnyOneCanPay
+	if base == SigHashSingle && idx >= len(tx.TxOut) {
+		return nil, errSingleNoOutput
+	}
+
+	cp := &Tx{Version: tx.Version, LockTime: tx.LockTime}
+	for i, in := range tx.TxIn {
+		if hashType&SigHashAnyOneCanPay != 0 && i != idx {
+			continue
+		}
+		c := &TxIn{PreviousOutPoint: in.PreviousOutPoint, Sequence: in.Sequence}
+		if i == idx {
+			c.SignatureScript = scriptCode
+		} else if base == SigHashNone || base == SigHashSingle {
+			c.Sequence = 0
+		}
+		cp.TxIn = append(cp.TxIn, c)
+	}
+	switch base {
+	case SigHashAll:
+		cp.TxOut = tx.TxOut
+	case SigHashSingle:
+		for i := 0; i < idx; i++ {
+			cp.TxOut = append(cp.TxOut, &TxOut{Value: -1})
+		}
+		cp.TxOut = append(cp.TxOut, tx.TxOut[idx])
+	}
+
+	w := writer{buf: cp.serialize(false)}
+	w.uint32(uint32(hashType))
+	hash := doubleSHA256(w.buf)
+	return hash[:], nil
+}
+
+// WitnessSigHash returns the BIP143 signature hash of segwit v0 input
+// idx, which spends amount satoshis. For P2WPKH scriptCode is the P2PKH
+// script of the key hash.
+func WitnessSigHash(tx *Tx, idx int, scriptCode []byte, amount int64, hashType SigHashType) ([]byte, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input %d out of range", idx)
+	}
+	if err := hashType.check(); err != nil {
+		return nil, err
+	}
+	base := hashType &^ SigHashAnyOneCanPay
+	anyoneCanPay := hashType&SigHashAnyOneCanPay != 0
+
+	var hashPrevouts, hashSequence, hashOutputs [32]byte
+	if !anyoneCanPay {
+		var w writer
+		for _, in := range tx.TxIn {
+			w.write(in.PreviousOutPoint.Hash[:])
+			w.uint32(in.PreviousOutPoint.Index)
+		}
+		hashPrevouts = doubleSHA256(w.buf)
+	}
+	if !anyoneCanPay && base == SigHashAll {
+		var w writer
+		for _, in := range tx.TxIn {
+			w.uint32(in.Sequence)
+		}
+		hashSequence = doubleSHA256(w.buf)
+	}
+	switch {
+	case base == SigHashAll:
+		var w writer
+		for _, out := range tx.TxOut {
+			out.write(&w)
+		}
+		hashOutputs = doubleSHA256(w.buf)
+	case base == SigHashSingle && idx < len(tx.TxOut):
+		var w writer
+		tx.TxOut[idx].write(&w)
+		hashOutputs = doubleSHA256(w.buf)
+	case base == SigHashSingle:
+		return nil, errSingleNoOutput
+	}
+
+	in := tx.TxIn[idx]
+	var w writer
+	w.uint32(uint32(tx.Version))
+	w.write(hashPrevouts[:])
+	w.write(hashSequence[:])
+	w.write(in.PreviousOutPoint.Hash[:])
+	w.uint32(in.PreviousOutPoint.Index)
+	w.varBytes(scriptCode)
+	w.uint64(uint64(amount))
+	w.uint32(in.Sequence)
+	w.write(hashOutputs[:])
+	w.uint32(tx.LockTime)
+	w.uint32(uint32(hashType))
+	hash := doubleSHA256(w.buf)
+	return hash[:], nil
+}
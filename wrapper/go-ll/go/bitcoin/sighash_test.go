@@ -0,0 +1,117 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// The native P2WPKH example of BIP143
+const testWitnessTx = "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000"
+
+func TestParseTx(t *testing.T) {
+	raw := mustHex(t, testWitnessTx)
+	tx, err := ParseTx(raw)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if len(tx.TxIn) != 2 || len(tx.TxOut) != 2 || tx.LockTime != 17 || tx.TxIn[0].Sequence != 0xffffffee {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+	if !bytes.Equal(tx.Serialize(), raw) {
+		t.Error("serialization does not round trip")
+	}
+
+	// With witness data the marker and flag are written, and the ID does
+	// not change
+	id := tx.TxID()
+	tx.TxIn[1].Witness = [][]byte{{0x01}, {0x02, 0x03}}
+	withWitness := tx.Serialize()
+	if !bytes.Equal(withWitness[4:6], []byte{0x00, 0x01}) {
+		t.Errorf("expected segwit marker, got %x", withWitness[4:6])
+	}
+	parsed, err := ParseTx(withWitness)
+	if err != nil {
+		t.Fatalf("failed to parse segwit transaction: %v", err)
+	}
+	if len(parsed.TxIn[0].Witness) != 0 || len(parsed.TxIn[1].Witness) != 2 || parsed.TxID() != id {
+		t.Error("witness does not round trip")
+	}
+
+	if _, err := ParseTx(raw[:len(raw)-1]); err == nil {
+		t.Error("expected an error for a truncated transaction")
+	}
+}
+
+func TestWitnessSigHash(t *testing.T) {
+	tx, err := ParseTx(mustHex(t, testWitnessTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptCode := p2pkhScript(mustHex(t, "1d0f172a0ecb48aee1be1f2687d2963ae33f71a1"))
+	hash, err := WitnessSigHash(tx, 1, scriptCode, 600000000, SigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670" {
+		t.Errorf("unexpected P2WPKH sighash %s", got)
+	}
+
+	// The P2SH-P2WPKH example of BIP143
+	tx, err = ParseTx(mustHex(t, "0100000001db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a54770100000000feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac92040000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptCode = p2pkhScript(mustHex(t, "79091972186c449eb1ded22b78e40d009bdf0089"))
+	hash, err = WitnessSigHash(tx, 0, scriptCode, 1000000000, SigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != "64f3b0f4dd2bb3aa1ce8566d220cc74dda9df97d8490cc81d89d735c92e59fb6" {
+		t.Errorf("unexpected P2SH-P2WPKH sighash %s", got)
+	}
+}
+
+func TestLegacySigHash(t *testing.T) {
+	tx, err := ParseTx(mustHex(t, testWitnessTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptCode := p2pkhScript(mustHex(t, "1d0f172a0ecb48aee1be1f2687d2963ae33f71a1"))
+	tests := []struct {
+		idx      int
+		hashType SigHashType
+		want     string
+	}{
+		{0, SigHashAll, "47194bc3c303a30aa5f78e45c7c2980b3be1284a9d69b1ea9ec0d29aac5f6848"},
+		{1, SigHashNone, "ffbbcf554debe55f76a79db7d205edc891f194184a93a660366bb8f7facb89e2"},
+		{1, SigHashSingle, "33cd468bd6b82f04bcef180b748c521d6fdee3b11711a2f27b2e465915afaec2"},
+		{0, SigHashAll | SigHashAnyOneCanPay, "4e7de48ff097d47bb87912759ec9380049a160289f2b89d48a28887ee30a41d4"},
+		{1, SigHashSingle | SigHashAnyOneCanPay, "865c7791b88917498a4c402176c302f146c53a6c2f50ecda08548f515237dca6"},
+	}
+	for _, tt := range tests {
+		hash, err := LegacySigHash(tx, tt.idx, scriptCode, tt.hashType)
+		if err != nil {
+			t.Errorf("input %d type 0x%x: %v", tt.idx, uint32(tt.hashType), err)
+			continue
+		}
+		if got := hex.EncodeToString(hash); got != tt.want {
+			t.Errorf("input %d type 0x%x: got %s, want %s", tt.idx, uint32(tt.hashType), got, tt.want)
+		}
+	}
+
+	// SIGHASH_SINGLE without a matching output is refused
+	tx.TxOut = tx.TxOut[:1]
+	if _, err := LegacySigHash(tx, 1, scriptCode, SigHashSingle); err != errSingleNoOutput {
+		t.Errorf("expected errSingleNoOutput, got %v", err)
+	}
+	if _, err := WitnessSigHash(tx, 1, scriptCode, 1, SigHashSingle); err != errSingleNoOutput {
+		t.Errorf("expected errSingleNoOutput, got %v", err)
+	}
+	if _, err := LegacySigHash(tx, 0, scriptCode, 0x04); err == nil {
+		t.Error("expected an error for an unknown sighash type")
+	}
+}
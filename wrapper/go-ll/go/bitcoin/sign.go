@@ -0,0 +1,284 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+)
+
+// MasterFingerprint returns the BIP32 fingerprint of the root public key
+// of a keyshare, as recorded in the derivations of a packet
+func MasterFingerprint(keyshare *dkls.Keyshare) ([4]byte, error) {
+	var fp [4]byte
+	pubKey, err := keyshare.PublicKey()
+	if err != nil {
+		return fp, err
+	}
+	copy(fp[:], Hash160(pubKey))
+	return fp, nil
+}
+
+// prevOut returns the output spent by input idx. A full previous
+// transaction must match the outpoint and, with a witness UTXO, agree
+// with it.
+func (p *Packet) prevOut(idx int) (*TxOut, error) {
+	in := p.Inputs[idx]
+	outpoint := p.UnsignedTx.TxIn[idx].PreviousOutPoint
+	if in.NonWitnessUtxo != nil {
+		if in.NonWitnessUtxo.TxHash() != outpoint.Hash || int(outpoint.Index) >= len(in.NonWitnessUtxo.TxOut) {
+			return nil, fmt.Errorf("input %d: previous transaction does not match the outpoint", idx)
+		}
+		out := in.NonWitnessUtxo.TxOut[outpoint.Index]
+		if in.WitnessUtxo != nil && (in.WitnessUtxo.Value != out.Value || !bytes.Equal(in.WitnessUtxo.PkScript, out.PkScript)) {
+			return nil, fmt.Errorf("input %d: witness UTXO does not match the previous transaction", idx)
+		}
+		return out, nil
+	}
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo, nil
+	}
+	return nil, fmt.Errorf("input %d: missing UTXO", idx)
+}
+
+// inputType returns the address type of the output spent by input idx,
+// which must pay pubKey
+func (p *Packet) inputType(idx int, pubKey []byte) (AddressType, *TxOut, error) {
+	utxo, err := p.prevOut(idx)
+	if err != nil {
+		return 0, nil, err
+	}
+	typ, ok := scriptType(utxo.PkScript, pubKey)
+	if !ok {
+		return 0, nil, fmt.Errorf("input %d: unsupported script or key %x", idx, pubKey)
+	}
+	in := p.Inputs[idx]
+	switch typ {
+	case P2PKH:
+		// A legacy signature does not commit to the amount, so the
+		// previous transaction is needed to check it
+		if in.NonWitnessUtxo == nil {
+			return 0, nil, fmt.Errorf("input %d: P2PKH input needs the previous transaction", idx)
+		}
+	case P2SHP2WPKH:
+		if in.RedeemScript != nil && !bytes.Equal(in.RedeemScript, p2wpkhScript(Hash160(pubKey))) {
+			return 0, nil, fmt.Errorf("input %d: redeem script does not match the key", idx)
+		}
+	}
+	return typ, utxo, nil
+}
+
+// InputSigHash returns the hash that pubKey signs for input idx, using
+// the sighash type of the input. The input must spend a P2PKH,
+// P2SH-P2WPKH or P2WPKH output of pubKey.
+func (p *Packet) InputSigHash(idx int, pubKey []byte) ([]byte, error) {
+	if idx < 0 || idx >= len(p.Inputs) {
+		return nil, fmt.Errorf("input %d out of range", idx)
+	}
+	typ, utxo, err := p.inputType(idx, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	hashType := p.Inputs[idx].SighashType
+	if hashType == 0 {
+		hashType = SigHashAll
+	}
+	if typ == P2PKH {
+		return LegacySigHash(p.UnsignedTx, idx, utxo.PkScript, hashType)
+	}
+	return WitnessSigHash(p.UnsignedTx, idx, p2pkhScript(Hash160(pubKey)), utxo.Value, hashType)
+}
+
+// AddInputDerivation marks input idx as spent by the child key of the
+// keyshare at path, and adds the redeem script of a P2SH-P2WPKH output.
+// The UTXO of the input must be set.
+func (p *Packet) AddInputDerivation(idx int, keyshare *dkls.Keyshare, path string) error {
+	if idx < 0 || idx >= len(p.Inputs) {
+		return fmt.Errorf("input %d out of range", idx)
+	}
+	parsed, err := dkls.ParsePath(path)
+	if err != nil {
+		return err
+	}
+	fp, err := MasterFingerprint(keyshare)
+	if err != nil {
+		return err
+	}
+	pubKey, _, err := keyshare.DerivePublicKey(path)
+	if err != nil {
+		return err
+	}
+	typ, _, err := p.inputType(idx, pubKey)
+	if err != nil {
+		return err
+	}
+
+	in := p.Inputs[idx]
+	if typ == P2SHP2WPKH {
+		in.RedeemScript = p2wpkhScript(Hash160(pubKey))
+	}
+	for _, d := range in.Bip32Derivation {
+		if bytes.Equal(d.PubKey, pubKey) {
+			d.MasterFingerprint, d.Path = fp, parsed
+			return nil
+		}
+	}
+	in.Bip32Derivation = append(in.Bip32Derivation, &Bip32Derivation{PubKey: pubKey, MasterFingerprint: fp, Path: parsed})
+	return nil
+}
+
+// ownedKey returns the derivation of input idx that belongs to the
+// keyshare, or nil if the input is not spent by it or is already final
+func (p *Packet) ownedKey(idx int, keyshare *dkls.Keyshare, fp [4]byte) (*Bip32Derivation, error) {
+	in := p.Inputs[idx]
+	if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+		return nil, nil
+	}
+	for _, d := range in.Bip32Derivation {
+		if d.MasterFingerprint != fp || d.Path.Validate() != nil {
+			continue
+		}
+		pubKey, _, err := keyshare.DerivePublicKey(d.Path.String())
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(pubKey, d.PubKey) {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// inputSeed derives the seed of the session signing input idx, or
+// returns nil if the sessions use random seeds. Reusing one seed for two
+// sessions would leak the key.
+func inputSeed(seed []byte, idx int) []byte {
+	if len(seed) == 0 {
+		return nil
+	}
+	h := sha256.New()
+	h.Write(seed)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(idx))
+	h.Write(b[:])
+	return h.Sum(nil)
+}
+
+// SignPSBT runs one sign session over the transport for every input of
+// the packet that is spent by a key of the keyshare, as recorded in its
+// BIP32 derivations, and adds the signatures to the packet. The session
+// of input i has the ID sessionID + "/" + i. All parties must sign the
+// same packet. It returns the number of inputs signed.
+func SignPSBT(ctx context.Context, transport dkls.Transport, sessionID string, keyshare *dkls.Keyshare, p *Packet, seed []byte) (int, error) {
+	fp, err := MasterFingerprint(keyshare)
+	if err != nil {
+		return 0, err
+	}
+	signed := 0
+	for i, in := range p.Inputs {
+		d, err := p.ownedKey(i, keyshare, fp)
+		if err != nil {
+			return signed, err
+		}
+		if d == nil {
+			continue
+		}
+		hash, err := p.InputSigHash(i, d.PubKey)
+		if err != nil {
+			return signed, err
+		}
+		sig, err := dkls.RunSign(ctx, transport, fmt.Sprintf("%s/%d", sessionID, i), keyshare, d.Path.String(), hash, inputSeed(seed, i))
+		if err != nil {
+			return signed, fmt.Errorf("input %d: %w", i, err)
+		}
+		if !bytes.Equal(sig.PublicKey, d.PubKey) {
+			return signed, fmt.Errorf("input %d: signature made by another key", i)
+		}
+
+		hashType := in.SighashType
+		if hashType == 0 {
+			hashType = SigHashAll
+		}
+		partial := &PartialSig{PubKey: d.PubKey, Signature: append(sig.DER(), byte(hashType))}
+		replaced := false
+		for j, existing := range in.PartialSigs {
+			if bytes.Equal(existing.PubKey, d.PubKey) {
+				in.PartialSigs[j], replaced = partial, true
+			}
+		}
+		if !replaced {
+			in.PartialSigs = append(in.PartialSigs, partial)
+		}
+		signed++
+	}
+	if signed == 0 {
+		return 0, errors.New("no input is spent by the keyshare")
+	}
+	return signed, nil
+}
+
+// pushData returns a script push of data, which must be shorter than 76
+// bytes
+func pushData(data []byte) []byte {
+	return append([]byte{byte(len(data))}, data...)
+}
+
+// Finalize builds the final script and witness of every input that has a
+// signature for its P2PKH, P2SH-P2WPKH or P2WPKH output, and drops the
+// fields only needed for signing. Inputs that are already final are left
+// as they are. It stops at the first input that can not be finalized.
+func (p *Packet) Finalize() error {
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+			continue
+		}
+		if len(in.PartialSigs) == 0 {
+			return fmt.Errorf("input %d: missing signature", i)
+		}
+		sig := in.PartialSigs[0]
+		typ, _, err := p.inputType(i, sig.PubKey)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case P2PKH:
+			in.FinalScriptSig = append(pushData(sig.Signature), pushData(sig.PubKey)...)
+		case P2SHP2WPKH:
+			in.FinalScriptSig = pushData(p2wpkhScript(Hash160(sig.PubKey)))
+			in.FinalScriptWitness = [][]byte{sig.Signature, sig.PubKey}
+		case P2WPKH:
+			in.FinalScriptWitness = [][]byte{sig.Signature, sig.PubKey}
+		}
+		in.PartialSigs = nil
+		in.SighashType = 0
+		in.RedeemScript = nil
+		in.WitnessScript = nil
+		in.Bip32Derivation = nil
+	}
+	return nil
+}
+
+// Extract returns the signed transaction of a finalized packet
+func (p *Packet) Extract() (*Tx, error) {
+	tx := &Tx{Version: p.UnsignedTx.Version, TxOut: p.UnsignedTx.TxOut, LockTime: p.UnsignedTx.LockTime}
+	for i, in := range p.UnsignedTx.TxIn {
+		final := p.Inputs[i]
+		if final.FinalScriptSig == nil && final.FinalScriptWitness == nil {
+			return nil, fmt.Errorf("input %d is not finalized", i)
+		}
+		tx.TxIn = append(tx.TxIn, &TxIn{
+			PreviousOutPoint: in.PreviousOutPoint,
+			SignatureScript:  final.FinalScriptSig,
+			Witness:          final.FinalScriptWitness,
+			Sequence:         in.Sequence,
+		})
+	}
+	return tx, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/dklstest"
+)
+
+func TestSignPSBT(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	shares, err := dklstest.RunKeygen(ctx, 2, 2, nil)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	path := dkls.BIP44(0, 0, 0, 0).String()
+	pubKey, _, err := shares[0].DerivePublicKey(path)
+	if err != nil {
+		t.Fatalf("failed to derive key: %v", err)
+	}
+	p := testPacket(t, pubKey)
+	for i := range p.Inputs {
+		if err := p.AddInputDerivation(i, shares[0], path); err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+	if p.Inputs[1].RedeemScript == nil {
+		t.Error("expected a redeem script for the P2SH-P2WPKH input")
+	}
+	raw := p.Serialize()
+
+	net := dklstest.NewNetwork(2)
+	packets := make([]*Packet, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, share := range shares {
+		packets[i], err = ParsePacket(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int, share *dkls.Keyshare) {
+			defer wg.Done()
+			_, errs[i] = SignPSBT(ctx, net.Transport(uint8(i)), "psbt", share, packets[i], nil)
+		}(i, share)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("party %d: sign failed: %v", i, err)
+		}
+	}
+	if !bytes.Equal(packets[0].Serialize(), packets[1].Serialize()) {
+		t.Error("parties produced different packets")
+	}
+
+	// Every input has a low-S DER signature of its sighash with the
+	// sighash byte appended
+	for i, in := range packets[0].Inputs {
+		if len(in.PartialSigs) != 1 {
+			t.Fatalf("input %d: expected one signature, got %d", i, len(in.PartialSigs))
+		}
+		der := in.PartialSigs[0].Signature
+		if der[len(der)-1] != byte(SigHashAll) {
+			t.Errorf("input %d: unexpected sighash byte %x", i, der[len(der)-1])
+		}
+		sig, err := dkls.ParseDERSignature(der[:len(der)-1])
+		if err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+		hash, err := packets[0].InputSigHash(i, pubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dkls.VerifySignature(pubKey, hash, sig); err != nil {
+			t.Errorf("input %d: signature does not verify: %v", i, err)
+		}
+	}
+
+	if err := packets[0].Finalize(); err != nil {
+		t.Fatalf("failed to finalize: %v", err)
+	}
+	tx, err := packets[0].Extract()
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if len(tx.TxIn[0].SignatureScript) == 0 || len(tx.TxIn[1].Witness) != 2 || len(tx.TxIn[2].Witness) != 2 {
+		t.Error("unexpected signed transaction")
+	}
+
+	// A packet without inputs of the keyshare is not signed
+	other := testPacket(t, mustHex(t, testPubKey))
+	if _, err := SignPSBT(ctx, net.Transport(0), "other", shares[0], other, nil); err == nil {
+		t.Error("expected an error for a packet without inputs of the keyshare")
+	}
+}
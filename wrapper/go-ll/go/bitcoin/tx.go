@@ -0,0 +1,349 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bitcoin
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// errShortRead is returned when serialized data ends early
+var errShortRead = errors.New("unexpected end of data")
+
+// OutPoint references an output of a previous transaction. Hash is the
+// transaction ID in internal byte order, the reverse of its hex form.
+type OutPoint struct {
+	Hash  [32]byte
+	Index uint32
+}
+
+// TxIn is a transaction input
+type TxIn struct {
+	PreviousOutPoint OutPoint
+	SignatureScript  []byte
+	Witness          [][]byte
+	Sequence         uint32
+}
+
+// TxOut is a transaction output
+type TxOut struct {
+	Value    int64
+	PkScript []byte
+}
+
+// Tx is a Bitcoin transaction
+type Tx struct {
+	Version  int32
+	TxIn     []*TxIn
+	TxOut    []*TxOut
+	LockTime uint32
+}
+
+// ParseTx parses a serialized transaction, with or without witness data
+func ParseTx(data []byte) (*Tx, error) {
+	r := &reader{buf: data}
+	tx, err := readTx(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.buf) != 0 {
+		return nil, errors.New("trailing data after transaction")
+	}
+	return tx, nil
+}
+
+func readTx(r *reader) (*Tx, error) {
+	tx := &Tx{}
+	version, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	tx.Version = int32(version)
+
+	count, err := r.varInt()
+	if err != nil {
+		return nil, err
+	}
+	segwit := false
+	if count == 0 {
+		// Marker 0x00 followed by flag 0x01
+		flag, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if flag != 0x01 {
+			return nil, errors.New("invalid segwit flag")
+		}
+		segwit = true
+		if count, err = r.varInt(); err != nil {
+			return nil, err
+		}
+	}
+	for i := uint64(0); i < count; i++ {
+		in := &TxIn{}
+		hash, err := r.bytes(32)
+		if err != nil {
+			return nil, err
+		}
+		copy(in.PreviousOutPoint.Hash[:], hash)
+		if in.PreviousOutPoint.Index, err = r.uint32(); err != nil {
+			return nil, err
+		}
+		if in.SignatureScript, err = r.varBytes(); err != nil {
+			return nil, err
+		}
+		if in.Sequence, err = r.uint32(); err != nil {
+			return nil, err
+		}
+		tx.TxIn = append(tx.TxIn, in)
+	}
+
+	if count, err = r.varInt(); err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		value, err := r.uint64()
+		if err != nil {
+			return nil, err
+		}
+		script, err := r.varBytes()
+		if err != nil {
+			return nil, err
+		}
+		tx.TxOut = append(tx.TxOut, &TxOut{Value: int64(value), PkScript: script})
+	}
+
+	if segwit {
+		for _, in := range tx.TxIn {
+			if in.Witness, err = r.witness(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tx.LockTime, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// HasWitness reports whether any input has witness data
+func (tx *Tx) HasWitness() bool {
+	for _, in := range tx.TxIn {
+		if len(in.Witness) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Serialize returns the transaction in wire format, with witness data if
+// any input has it
+func (tx *Tx) Serialize() []byte {
+	return tx.serialize(tx.HasWitness())
+}
+
+func (tx *Tx) serialize(witness bool) []byte {
+	var w writer
+	w.uint32(uint32(tx.Version))
+	if witness {
+		w.write([]byte{0x00, 0x01})
+	}
+	w.varInt(uint64(len(tx.TxIn)))
+	for _, in := range tx.TxIn {
+		w.write(in.PreviousOutPoint.Hash[:])
+		w.uint32(in.PreviousOutPoint.Index)
+		w.varBytes(in.SignatureScript)
+		w.uint32(in.Sequence)
+	}
+	w.varInt(uint64(len(tx.TxOut)))
+	for _, out := range tx.TxOut {
+		out.write(&w)
+	}
+	if witness {
+		for _, in := range tx.TxIn {
+			w.witness(in.Witness)
+		}
+	}
+	w.uint32(tx.LockTime)
+	return w.buf
+}
+
+// TxHash returns the transaction ID in internal byte order
+func (tx *Tx) TxHash() [32]byte {
+	return doubleSHA256(tx.serialize(false))
+}
+
+// TxID returns the transaction ID in its usual hex form
+func (tx *Tx) TxID() string {
+	hash := tx.TxHash()
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+func (out *TxOut) write(w *writer) {
+	w.uint64(uint64(out.Value))
+	w.varBytes(out.PkScript)
+}
+
+func doubleSHA256(data []byte) [32]byte {
+	first := sha256.Sum256(data)
+	return sha256.Sum256(first[:])
+}
+
+// reader decodes the Bitcoin wire format
+type reader struct {
+	buf []byte
+}
+
+func (r *reader) bytes(n uint64) ([]byte, error) {
+	if uint64(len(r.buf)) < n {
+		return nil, errShortRead
+	}
+	out := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return out, nil
+}
+
+func (r *reader) byte() (byte, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *reader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *reader) uint64() (uint64, error) {
+	b, err := r.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+// varInt reads a CompactSize integer
+func (r *reader) varInt() (uint64, error) {
+	prefix, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	switch prefix {
+	case 0xfd:
+		b, err := r.bytes(2)
+		if err != nil {
+			return 0, err
+		}
+		n = uint64(binary.LittleEndian.Uint16(b))
+		if n < 0xfd {
+			return 0, errors.New("non-canonical varint")
+		}
+	case 0xfe:
+		v, err := r.uint32()
+		if err != nil {
+			return 0, err
+		}
+		n = uint64(v)
+		if n <= 0xffff {
+			return 0, errors.New("non-canonical varint")
+		}
+	case 0xff:
+		if n, err = r.uint64(); err != nil {
+			return 0, err
+		}
+		if n <= 0xffffffff {
+			return 0, errors.New("non-canonical varint")
+		}
+	default:
+		n = uint64(prefix)
+	}
+	return n, nil
+}
+
+func (r *reader) varBytes() ([]byte, error) {
+	n, err := r.varInt()
+	if err != nil {
+		return nil, err
+	}
+	return r.bytes(n)
+}
+
+func (r *reader) witness() ([][]byte, error) {
+	n, err := r.varInt()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)) {
+		return nil, errShortRead
+	}
+	stack := make([][]byte, 0, n)
+	for i := uint64(0); i < n; i++ {
+		item, err := r.varBytes()
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, item)
+	}
+	return stack, nil
+}
+
+// writer encodes the Bitcoin wire format
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) write(p []byte) {
+	w.buf = append(w.buf, p...)
+}
+
+func (w *writer) uint32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.write(b[:])
+}
+
+func (w *writer) uint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.write(b[:])
+}
+
+// varInt writes a CompactSize integer
+func (w *writer) varInt(n uint64) {
+	switch {
+	case n < 0xfd:
+		w.write([]byte{byte(n)})
+	case n <= 0xffff:
+		w.write([]byte{0xfd, byte(n), byte(n >> 8)})
+	case n <= 0xffffffff:
+		w.write([]byte{0xfe})
+		w.uint32(uint32(n))
+	default:
+		w.write([]byte{0xff})
+		w.uint64(n)
+	}
+}
+
+func (w *writer) varBytes(p []byte) {
+	w.varInt(uint64(len(p)))
+	w.write(p)
+}
+
+func (w *writer) witness(stack [][]byte) {
+	w.varInt(uint64(len(stack)))
+	for _, item := range stack {
+		w.varBytes(item)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+// Package cosmos derives bech32 account addresses from a keyshare and
+// signs Cosmos SDK and Tendermint sign bytes with the distributed sign
+// protocol.
+package cosmos
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/internal/bech32"
+)
+
+// ErrInvalidAddress is returned by ParseAddress for a malformed address
+// or one with another human-readable part
+var ErrInvalidAddress = errors.New("invalid bech32 address")
+
+// AddressBytes returns the 20-byte account address of a compressed
+// secp256k1 public key, RIPEMD-160(SHA-256(pubKey))
+func AddressBytes(pubKey []byte) ([]byte, error) {
+	if len(pubKey) != 33 || (pubKey[0] != 0x02 && pubKey[0] != 0x03) {
+		return nil, errors.New("public key must be 33 bytes compressed")
+	}
+	sha := sha256.Sum256(pubKey)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil), nil
+}
+
+// Address returns the bech32 account address of a compressed public key
+// with the human-readable part of the chain, e.g. "cosmos" or "osmo"
+func Address(pubKey []byte, hrp string) (string, error) {
+	addr, err := AddressBytes(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return encodeAddress(hrp, addr)
+}
+
+func encodeAddress(hrp string, addr []byte) (string, error) {
+	data, err := bech32.ConvertBits(addr, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode(hrp, data)
+}
+
+// DeriveAddress returns the address of the child key at a non-hardened
+// path. The usual Cosmos path m/44'/118'/0'/0/0 is hardened and can not
+// be derived from the public key.
+func DeriveAddress(keyshare *dkls.Keyshare, path, hrp string) (string, error) {
+	pubKey, _, err := keyshare.DerivePublicKey(path)
+	if err != nil {
+		return "", err
+	}
+	return Address(pubKey, hrp)
+}
+
+// ParseAddress returns the 20-byte account address of a bech32 address
+// with the given human-readable part
+func ParseAddress(s, hrp string) ([]byte, error) {
+	got, data, err := bech32.Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	if got != hrp {
+		return nil, fmt.Errorf("%w: expected prefix %q, got %q", ErrInvalidAddress, hrp, got)
+	}
+	addr, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil || len(addr) != 20 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	return addr, nil
+}
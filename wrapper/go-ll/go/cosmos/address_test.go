@@ -0,0 +1,54 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package cosmos
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestAddress(t *testing.T) {
+	// The generator point, the public key of the private key 1
+	pubKey := mustHex(t, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	for hrp, want := range map[string]string{
+		"cosmos": "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c",
+		"osmo":   "osmo1w508d6qejxtdg4y5r3zarvary0c5xw7kjxy2e2",
+	} {
+		got, err := Address(pubKey, hrp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got %s, want %s", hrp, got, want)
+		}
+		addr, err := ParseAddress(got, hrp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := AddressBytes(pubKey); !bytes.Equal(addr, want) {
+			t.Errorf("%s: parsed %x, want %x", hrp, addr, want)
+		}
+	}
+
+	if _, err := ParseAddress("osmo1w508d6qejxtdg4y5r3zarvary0c5xw7kjxy2e2", "cosmos"); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress for another prefix, got %v", err)
+	}
+	if _, err := ParseAddress("cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60d", "cosmos"); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress for a bad checksum, got %v", err)
+	}
+	if _, err := Address(append([]byte{0x04}, make([]byte, 64)...), "cosmos"); err == nil {
+		t.Error("expected an error for an uncompressed key")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package cosmos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+)
+
+// DirectSignBytes returns the sign bytes of SIGN_MODE_DIRECT, the
+// protobuf encoding of the SignDoc
+//
+//	message SignDoc {
+//	  bytes  body_bytes      = 1;
+//	  bytes  auth_info_bytes = 2;
+//	  string chain_id        = 3;
+//	  uint64 account_number  = 4;
+//	}
+//
+// bodyBytes and authInfoBytes are the encoded TxBody and AuthInfo, as
+// they appear in the TxRaw that is broadcast.
+func DirectSignBytes(bodyBytes, authInfoBytes []byte, chainID string, accountNumber uint64) []byte {
+	var out []byte
+	out = appendProtoBytes(out, 1, bodyBytes)
+	out = appendProtoBytes(out, 2, authInfoBytes)
+	out = appendProtoBytes(out, 3, []byte(chainID))
+	if accountNumber != 0 {
+		out = appendVarint(out, 4<<3)
+		out = appendVarint(out, accountNumber)
+	}
+	return out
+}
+
+// appendProtoBytes appends a length-delimited field, which proto3 leaves
+// out when empty
+func appendProtoBytes(out []byte, field uint64, value []byte) []byte {
+	if len(value) == 0 {
+		return out
+	}
+	out = appendVarint(out, field<<3|2)
+	out = appendVarint(out, uint64(len(value)))
+	return append(out, value...)
+}
+
+func appendVarint(out []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(out, buf[:n]...)
+}
+
+// AminoJSONSignBytes returns the sign bytes of SIGN_MODE_LEGACY_AMINO_JSON
+// for a StdSignDoc JSON document: the same JSON with sorted keys and no
+// whitespace. Numbers are kept as written, and <, > and & in strings are
+// escaped as \u003c, \u003e and \u0026, as the SDK does.
+func AminoJSONSignBytes(signDoc []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(signDoc))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid sign doc: %w", err)
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return nil, errors.New("invalid sign doc: expected an object")
+	}
+	return json.Marshal(doc)
+}
+
+// Sign runs the sign protocol for the SHA-256 hash of signBytes over the
+// transport, like dkls.RunSign, and returns the 64-byte [R || S]
+// signature with a low S, as carried in the signatures of a TxRaw and in
+// Tendermint votes
+func Sign(ctx context.Context, transport dkls.Transport, sessionID string, keyshare *dkls.Keyshare, path string, signBytes []byte, seed []byte) ([]byte, error) {
+	hash := sha256.Sum256(signBytes)
+	sig, err := dkls.RunSign(ctx, transport, sessionID, keyshare, path, hash[:], seed)
+	if err != nil {
+		return nil, err
+	}
+	return sig.Compact(), nil
+}
+
+// Verify checks a 64-byte [R || S] signature of signBytes against a
+// compressed public key. Signatures with a high S are rejected, as they
+// are by the Cosmos SDK.
+func Verify(pubKey, signBytes, signature []byte) error {
+	if len(signature) != 64 {
+		return errors.New("signature must be 64 bytes")
+	}
+	hash := sha256.Sum256(signBytes)
+	return dkls.VerifySignature(pubKey, hash[:], &dkls.Signature{R: signature[:32], S: signature[32:]})
+}
+
+// VerifyDerived checks a signature returned by Sign against the child key
+// of the keyshare at path
+func VerifyDerived(keyshare *dkls.Keyshare, path string, signBytes, signature []byte) error {
+	pubKey, _, err := keyshare.DerivePublicKey(path)
+	if err != nil {
+		return err
+	}
+	return Verify(pubKey, signBytes, signature)
+}
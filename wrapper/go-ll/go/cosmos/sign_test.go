@@ -0,0 +1,120 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package cosmos
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/dklstest"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/secp256k1"
+)
+
+func TestDirectSignBytes(t *testing.T) {
+	got := DirectSignBytes([]byte{0x01, 0x02}, []byte{0x03}, "c", 300)
+	if want := "0a020102" + "120103" + "1a0163" + "20ac02"; hex.EncodeToString(got) != want {
+		t.Errorf("got %x, want %s", got, want)
+	}
+	// Account number 0 is left out, as proto3 does
+	got = DirectSignBytes([]byte{0x01}, []byte{0x03}, "c", 0)
+	if want := "0a0101" + "120103" + "1a0163"; hex.EncodeToString(got) != want {
+		t.Errorf("got %x, want %s", got, want)
+	}
+}
+
+func TestAminoJSONSignBytes(t *testing.T) {
+	doc := `{
+		"chain_id": "cosmoshub-4",
+		"account_number": "1",
+		"sequence": "0",
+		"fee": {"gas": "200000", "amount": [{"denom": "uatom", "amount": "5000"}]},
+		"msgs": [{"type": "cosmos-sdk/MsgSend", "value": {"to_address": "b", "from_address": "a", "amount": []}}],
+		"memo": "<memo> & more"
+	}`
+	got, err := AminoJSONSignBytes([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"account_number":"1","chain_id":"cosmoshub-4","fee":{"amount":[{"amount":"5000","denom":"uatom"}],"gas":"200000"},` +
+		`"memo":"\u003cmemo\u003e \u0026 more","msgs":[{"type":"cosmos-sdk/MsgSend","value":{"amount":[],"from_address":"a","to_address":"b"}}],"sequence":"0"}`
+	if string(got) != want {
+		t.Errorf("unexpected sign bytes\n got %s\nwant %s", got, want)
+	}
+	if _, err := AminoJSONSignBytes([]byte(`["not", "a", "doc"]`)); err == nil {
+		t.Error("expected an error for a non-object document")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	pubKey := mustHex(t, "03f973a0b87062c389d125d8199e803b832b6ac6bf7867a4f6cd87506060fc4c58")
+	signBytes := []byte(`{"account_number":"1","chain_id":"cosmoshub-4"}`)
+	sig := mustHex(t, "14f36e2d6a4788341ff218a3d777940ed9d7d2618d92595f2fd5d156cf98d1a3"+
+		"53cc52ad2b87379271cd9e9d16cde54efaa49476d553d0942ac452785512705f")
+	if err := Verify(pubKey, signBytes, sig); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	if err := Verify(pubKey, append(signBytes, ' '), sig); err != secp256k1.ErrInvalidSignature {
+		t.Errorf("expected ErrInvalidSignature for other sign bytes, got %v", err)
+	}
+
+	// The high-S form of the same signature is rejected
+	s := new(big.Int).SetBytes(sig[32:])
+	high := append(append([]byte{}, sig[:32]...), s.Sub(secp256k1.N, s).FillBytes(make([]byte, 32))...)
+	if err := Verify(pubKey, signBytes, high); err != secp256k1.ErrHighS {
+		t.Errorf("expected ErrHighS, got %v", err)
+	}
+	if err := Verify(pubKey, signBytes, sig[:63]); err == nil {
+		t.Error("expected an error for a short signature")
+	}
+}
+
+func TestSign(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	shares, err := dklstest.RunKeygen(ctx, 2, 2, nil)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	path := dkls.BIP44(118, 0, 0, 0).String()
+	signBytes := DirectSignBytes([]byte{0x0a, 0x00}, []byte{0x12, 0x00}, "cosmoshub-4", 7)
+
+	net := dklstest.NewNetwork(2)
+	sigs := make([][]byte, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, share := range shares {
+		wg.Add(1)
+		go func(i int, share *dkls.Keyshare) {
+			defer wg.Done()
+			sigs[i], errs[i] = Sign(ctx, net.Transport(uint8(i)), "cosmos", share, path, signBytes, nil)
+		}(i, share)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("party %d: sign failed: %v", i, err)
+		}
+	}
+	if len(sigs[0]) != 64 || !bytes.Equal(sigs[0], sigs[1]) {
+		t.Fatal("expected the same 64-byte signature from every party")
+	}
+	if err := VerifyDerived(shares[1], path, signBytes, sigs[0]); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if err := VerifyDerived(shares[1], dkls.BIP44(118, 0, 0, 1).String(), signBytes, sigs[0]); err == nil {
+		t.Error("expected an error for the key of another path")
+	}
+}
@@ -28,27 +28,35 @@ typedef struct {
     size_t len;
 } MessageArray;
 
+// Matches the #[repr(C)] GoError of lib.rs
 typedef struct {
     char* message;
     int32_t code;
+    int32_t party;
 } GoError;
 
 // Error handling
 extern void dkls_free_error(GoError* err);
 extern const char* dkls_error_message(const GoError* err);
 extern int32_t dkls_error_code(const GoError* err);
+extern int32_t dkls_error_party(const GoError* err);
 
 // Byte buffer
 extern void dkls_free_bytes(ByteBuffer buf);
 
 // Keyshare
 typedef void* KeyshareHandle;
-extern KeyshareHandle dkls_keyshare_from_bytes(const uint8_t* bytes, size_t len);
+extern KeyshareHandle dkls_keyshare_from_bytes(const uint8_t* bytes, size_t len, GoError** err_out);
 extern ByteBuffer dkls_keyshare_to_bytes(const KeyshareHandle handle);
 extern int dkls_keyshare_public_key(const KeyshareHandle handle, uint8_t* out);
 extern uint8_t dkls_keyshare_participants(const KeyshareHandle handle);
 extern uint8_t dkls_keyshare_threshold(const KeyshareHandle handle);
 extern uint8_t dkls_keyshare_party_id(const KeyshareHandle handle);
+extern ByteBuffer dkls_keyshare_ranks(const KeyshareHandle handle);
+extern int dkls_keyshare_final_session_id(const KeyshareHandle handle, uint8_t* out);
+extern int dkls_keyshare_root_chain_code(const KeyshareHandle handle, uint8_t* out);
+extern int dkls_keyshare_derive_public_key(const KeyshareHandle handle, const char* chain_path, uint8_t* pk_out, uint8_t* chain_code_out, GoError** err_out);
+extern ByteBuffer dkls_keyshare_public_shares(const KeyshareHandle handle);
 extern void dkls_keyshare_free(KeyshareHandle handle);
 
 // Message
@@ -57,12 +65,12 @@ extern void dkls_message_free_array(Message* msgs, size_t len);
 
 // Keygen
 typedef void* KeygenSessionHandle;
-extern KeygenSessionHandle dkls_keygen_new(uint8_t participants, uint8_t threshold, uint8_t party_id, const uint8_t* seed, size_t seed_len);
+extern KeygenSessionHandle dkls_keygen_new(uint8_t participants, uint8_t threshold, uint8_t party_id, const uint8_t* ranks, size_t ranks_len, const uint8_t* seed, size_t seed_len, GoError** err_out);
 extern ByteBuffer dkls_keygen_to_bytes(const KeygenSessionHandle handle);
-extern KeygenSessionHandle dkls_keygen_from_bytes(const uint8_t* bytes, size_t len);
+extern KeygenSessionHandle dkls_keygen_from_bytes(const uint8_t* bytes, size_t len, GoError** err_out);
 extern KeygenSessionHandle dkls_keygen_init_key_rotation(const KeyshareHandle oldshare, const uint8_t* seed, size_t seed_len, GoError** err_out);
 extern KeygenSessionHandle dkls_keygen_init_key_recovery(const KeyshareHandle oldshare, const uint8_t* lost_shares, size_t lost_shares_len, const uint8_t* seed, size_t seed_len, GoError** err_out);
-extern KeygenSessionHandle dkls_keygen_init_lost_share_recovery(uint8_t participants, uint8_t threshold, uint8_t party_id, const uint8_t* pk, size_t pk_len, const uint8_t* lost_shares, size_t lost_shares_len, const uint8_t* seed, size_t seed_len, GoError** err_out);
+extern KeygenSessionHandle dkls_keygen_init_lost_share_recovery(uint8_t participants, uint8_t threshold, uint8_t party_id, const uint8_t* ranks, size_t ranks_len, const uint8_t* pk, size_t pk_len, const uint8_t* lost_shares, size_t lost_shares_len, const uint8_t* seed, size_t seed_len, GoError** err_out);
 extern Message* dkls_keygen_create_first_message(KeygenSessionHandle handle, GoError** err_out);
 extern int dkls_keygen_calculate_commitment_2(const KeygenSessionHandle handle, uint8_t* out);
 // dkls_keygen_handle_messages is defined in dkls_wrapper.c
@@ -74,34 +82,56 @@ extern void dkls_keygen_free(KeygenSessionHandle handle);
 typedef void* SignSessionHandle;
 extern SignSessionHandle dkls_sign_new(const KeyshareHandle keyshare, const char* chain_path, const uint8_t* seed, size_t seed_len, GoError** err_out);
 extern ByteBuffer dkls_sign_to_bytes(const SignSessionHandle handle);
-extern SignSessionHandle dkls_sign_from_bytes(const uint8_t* bytes, size_t len);
+extern SignSessionHandle dkls_sign_from_bytes(const uint8_t* bytes, size_t len, GoError** err_out);
 extern Message* dkls_sign_create_first_message(SignSessionHandle handle, GoError** err_out);
 // dkls_sign_handle_messages is defined in dkls_wrapper.c
 extern int dkls_sign_handle_messages(SignSessionHandle handle, const Message* msgs, size_t msgs_len, const uint8_t* seed, size_t seed_len, GoError** err_out, MessageArray* out);
 extern Message* dkls_sign_last_message(SignSessionHandle handle, const uint8_t* message_hash, size_t message_hash_len, GoError** err_out);
-extern int dkls_sign_combine(SignSessionHandle handle, const Message* msgs, size_t msgs_len, uint8_t* r_out, uint8_t* s_out, GoError** err_out);
+extern int dkls_sign_combine(SignSessionHandle handle, const Message* msgs, size_t msgs_len, uint8_t* r_out, uint8_t* s_out, uint8_t* recid_out, uint8_t* pk_out, GoError** err_out);
+extern int dkls_sign_presignature_id(const SignSessionHandle handle, uint8_t* id_out, uint8_t* party_out, uint8_t* hash_out);
 extern void dkls_sign_free(SignSessionHandle handle);
 
 // Sign OT Variant
 typedef void* SignSessionOTVariantHandle;
 extern SignSessionOTVariantHandle dkls_sign_ot_variant_new(const KeyshareHandle keyshare, const char* chain_path, const uint8_t* seed, size_t seed_len, GoError** err_out);
 extern ByteBuffer dkls_sign_ot_variant_to_bytes(const SignSessionOTVariantHandle handle);
-extern SignSessionOTVariantHandle dkls_sign_ot_variant_from_bytes(const uint8_t* bytes, size_t len);
+extern SignSessionOTVariantHandle dkls_sign_ot_variant_from_bytes(const uint8_t* bytes, size_t len, GoError** err_out);
 extern Message* dkls_sign_ot_variant_create_first_message(SignSessionOTVariantHandle handle, GoError** err_out);
 // dkls_sign_ot_variant_handle_messages is defined in dkls_wrapper.c
 extern int dkls_sign_ot_variant_handle_messages(SignSessionOTVariantHandle handle, const Message* msgs, size_t msgs_len, const uint8_t* seed, size_t seed_len, GoError** err_out, MessageArray* out);
 extern Message* dkls_sign_ot_variant_last_message(SignSessionOTVariantHandle handle, const uint8_t* message_hash, size_t message_hash_len, GoError** err_out);
-extern int dkls_sign_ot_variant_combine(SignSessionOTVariantHandle handle, const Message* msgs, size_t msgs_len, uint8_t* r_out, uint8_t* s_out, GoError** err_out);
+extern int dkls_sign_ot_variant_combine(SignSessionOTVariantHandle handle, const Message* msgs, size_t msgs_len, uint8_t* r_out, uint8_t* s_out, uint8_t* recid_out, uint8_t* pk_out, GoError** err_out);
+extern int dkls_sign_ot_variant_presignature_id(const SignSessionOTVariantHandle handle, uint8_t* id_out, uint8_t* party_out, uint8_t* hash_out);
 extern void dkls_sign_ot_variant_free(SignSessionOTVariantHandle handle);
+
+// Presignature
+typedef void* PreSignatureHandle;
+typedef void* PartialSignatureHandle;
+extern PreSignatureHandle dkls_sign_presignature(SignSessionHandle handle, GoError** err_out);
+extern PreSignatureHandle dkls_sign_ot_variant_presignature(SignSessionOTVariantHandle handle, GoError** err_out);
+extern ByteBuffer dkls_presignature_to_bytes(const PreSignatureHandle handle);
+extern PreSignatureHandle dkls_presignature_from_bytes(const uint8_t* bytes, size_t len, GoError** err_out);
+extern int dkls_presignature_final_session_id(const PreSignatureHandle handle, uint8_t* out);
+extern uint8_t dkls_presignature_party_id(const PreSignatureHandle handle);
+extern int dkls_presignature_public_key(const PreSignatureHandle handle, uint8_t* out);
+extern PartialSignatureHandle dkls_presignature_sign(PreSignatureHandle handle, const uint8_t* message_hash, size_t message_hash_len, GoError** err_out);
+extern void dkls_presignature_free(PreSignatureHandle handle);
+extern ByteBuffer dkls_partial_signature_to_bytes(const PartialSignatureHandle handle);
+extern PartialSignatureHandle dkls_partial_signature_from_bytes(const uint8_t* bytes, size_t len, GoError** err_out);
+extern Message* dkls_partial_signature_message(const PartialSignatureHandle handle, GoError** err_out);
+extern int dkls_partial_signature_combine(PartialSignatureHandle handle, const Message* msgs, size_t msgs_len, uint8_t* r_out, uint8_t* s_out, uint8_t* recid_out, uint8_t* pk_out, GoError** err_out);
+extern void dkls_partial_signature_free(PartialSignatureHandle handle);
 */
 import "C"
 
 import (
 	"errors"
+	"runtime"
+	"sync"
 	"unsafe"
 )
 
-// Error represents a DKLS error
+// Error represents a DKLS error. Code is one of the Code constants.
 type Error struct {
 	Message string
 	Code    int32
@@ -111,7 +141,9 @@ func (e *Error) Error() string {
 	return e.Message
 }
 
-func getError(errPtr *C.GoError) *Error {
+// getError converts a library error. It returns an *AbortError if the
+// error names a party to ban, an *Error otherwise, or nil.
+func getError(errPtr *C.GoError) error {
 	if errPtr == nil {
 		return nil
 	}
@@ -121,10 +153,23 @@ func getError(errPtr *C.GoError) *Error {
 		msgStr = C.GoString(msg)
 	}
 	code := C.dkls_error_code(errPtr)
-	return &Error{
+	err := &Error{
 		Message: msgStr,
 		Code:    int32(code),
 	}
+	if party := C.dkls_error_party(errPtr); party >= 0 {
+		return &AbortError{BannedParty: uint8(party), Err: err}
+	}
+	return err
+}
+
+// checkSeed rejects seeds the library can not use. A seed is optional;
+// when given it must be 32 bytes.
+func checkSeed(seed []byte) error {
+	if len(seed) != 0 && len(seed) != 32 {
+		return ErrInvalidSeed
+	}
+	return nil
 }
 
 func freeError(errPtr *C.GoError) {
@@ -156,6 +201,9 @@ type Message struct {
 	FromID  uint8
 	ToID    *uint8 // nil means broadcast
 	Payload []byte
+	// Header is set on the messages of a session bound with Bind, and
+	// on messages taken out of an Envelope
+	Header *Header
 }
 
 func cMessageToGo(msg *C.Message) *Message {
@@ -232,25 +280,51 @@ func goMessagesToC(msgs []*Message) ([]C.Message, func()) {
 
 // Keyshare represents a key share
 type Keyshare struct {
+	mu     sync.RWMutex
 	handle C.KeyshareHandle
+	leak   *leakRecord
+}
+
+func newKeyshare(handle C.KeyshareHandle) *Keyshare {
+	k := &Keyshare{handle: handle, leak: trackHandle("Keyshare")}
+	runtime.SetFinalizer(k, func(k *Keyshare) {
+		k.mu.Lock()
+		if k.handle != nil {
+			k.leak.leaked()
+		}
+		k.mu.Unlock()
+		k.Free()
+	})
+	return k
 }
 
-// NewKeyshareFromBytes creates a keyshare from serialized bytes
+// NewKeyshareFromBytes creates a keyshare from serialized bytes. It reads
+// the container written by ToBytes as well as the bare CBOR keyshares of
+// older releases, migrating them to the current layout.
 func NewKeyshareFromBytes(data []byte) (*Keyshare, error) {
 	if len(data) == 0 {
 		return nil, errors.New("empty data")
 	}
-	handle := C.dkls_keyshare_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)))
+	var errPtr *C.GoError
+	handle := C.dkls_keyshare_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)), &errPtr)
 	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
 		return nil, errors.New("failed to deserialize keyshare")
 	}
-	return &Keyshare{handle: handle}, nil
+	return newKeyshare(handle), nil
 }
 
-// ToBytes serializes the keyshare
+// ToBytes serializes the keyshare into a self-describing container, see
+// ParseKeyshareHeader
 func (k *Keyshare) ToBytes() ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	if k.handle == nil {
-		return nil, errors.New("nil keyshare")
+		return nil, ErrHandleFreed
 	}
 	buf := C.dkls_keyshare_to_bytes(k.handle)
 	defer freeByteBuffer(buf)
@@ -259,8 +333,10 @@ func (k *Keyshare) ToBytes() ([]byte, error) {
 
 // PublicKey returns the public key (33 bytes)
 func (k *Keyshare) PublicKey() ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	if k.handle == nil {
-		return nil, errors.New("nil keyshare")
+		return nil, ErrHandleFreed
 	}
 	out := make([]byte, 33)
 	if C.dkls_keyshare_public_key(k.handle, (*C.uint8_t)(&out[0])) != 0 {
@@ -271,6 +347,8 @@ func (k *Keyshare) PublicKey() ([]byte, error) {
 
 // Participants returns the number of participants
 func (k *Keyshare) Participants() uint8 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	if k.handle == nil {
 		return 0
 	}
@@ -279,6 +357,8 @@ func (k *Keyshare) Participants() uint8 {
 
 // Threshold returns the threshold
 func (k *Keyshare) Threshold() uint8 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	if k.handle == nil {
 		return 0
 	}
@@ -287,64 +367,242 @@ func (k *Keyshare) Threshold() uint8 {
 
 // PartyID returns the party ID
 func (k *Keyshare) PartyID() uint8 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	if k.handle == nil {
 		return 0
 	}
 	return uint8(C.dkls_keyshare_party_id(k.handle))
 }
 
+// Ranks returns the rank of every party of the key, indexed by party ID
+func (k *Keyshare) Ranks() ([]uint8, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	buf := C.dkls_keyshare_ranks(k.handle)
+	defer freeByteBuffer(buf)
+	if buf.data == nil {
+		return nil, errors.New("failed to get ranks")
+	}
+	return cByteBufferToGo(buf), nil
+}
+
+// FinalSessionID returns the 32-byte session ID of the DKG that produced
+// the keyshare. It changes with every key rotation or recovery.
+func (k *Keyshare) FinalSessionID() ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	out := make([]byte, 32)
+	if C.dkls_keyshare_final_session_id(k.handle, (*C.uint8_t)(&out[0])) != 0 {
+		return nil, errors.New("failed to get final session id")
+	}
+	return out, nil
+}
+
+// RootChainCode returns the 32-byte BIP32 chain code of the root key
+func (k *Keyshare) RootChainCode() ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	out := make([]byte, 32)
+	if C.dkls_keyshare_root_chain_code(k.handle, (*C.uint8_t)(&out[0])) != 0 {
+		return nil, errors.New("failed to get root chain code")
+	}
+	return out, nil
+}
+
+// DerivePublicKey returns the 33-byte compressed public key and the
+// 32-byte chain code of the child key at path, e.g. "m/0/1". Only
+// non-hardened paths can be derived from the public key.
+func (k *Keyshare) DerivePublicKey(path string) (pubKey, chainCode []byte, err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.handle == nil {
+		return nil, nil, ErrHandleFreed
+	}
+	if _, err := ParsePath(path); err != nil {
+		return nil, nil, err
+	}
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	pubKey = make([]byte, 33)
+	chainCode = make([]byte, 32)
+	var errPtr *C.GoError
+	if C.dkls_keyshare_derive_public_key(k.handle, cPath, (*C.uint8_t)(&pubKey[0]), (*C.uint8_t)(&chainCode[0]), &errPtr) != 0 {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("failed to derive public key")
+	}
+	return pubKey, chainCode, nil
+}
+
+// PublicShares returns the 33-byte public share of every party, indexed
+// by party ID
+func (k *Keyshare) PublicShares() ([][]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	buf := C.dkls_keyshare_public_shares(k.handle)
+	defer freeByteBuffer(buf)
+	data := cByteBufferToGo(buf)
+	if len(data) == 0 || len(data)%33 != 0 {
+		return nil, errors.New("failed to get public shares")
+	}
+	shares := make([][]byte, len(data)/33)
+	for i := range shares {
+		shares[i] = data[i*33 : (i+1)*33 : (i+1)*33]
+	}
+	return shares, nil
+}
+
 // Free releases the keyshare
 func (k *Keyshare) Free() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	if k.handle != nil {
 		C.dkls_keyshare_free(k.handle)
 		k.handle = nil
+		k.leak.release()
 	}
 }
 
+// Close frees the keyshare. It implements io.Closer.
+func (k *Keyshare) Close() error {
+	k.Free()
+	return nil
+}
+
 // KeygenSession represents a key generation session
 type KeygenSession struct {
+	mu     sync.Mutex
 	handle C.KeygenSessionHandle
+	leak   *leakRecord
+	env    *binding // nil until Bind
+}
+
+func newKeygenSession(handle C.KeygenSessionHandle) *KeygenSession {
+	s := &KeygenSession{handle: handle, leak: trackHandle("KeygenSession")}
+	runtime.SetFinalizer(s, func(s *KeygenSession) {
+		s.mu.Lock()
+		if s.handle != nil {
+			s.leak.leaked()
+		}
+		s.mu.Unlock()
+		s.Free()
+	})
+	return s
 }
 
-// NewKeygenSession creates a new keygen session
-func NewKeygenSession(participants, threshold, partyID uint8, seed []byte) *KeygenSession {
+// NewKeygenSession creates a new keygen session in which every party has
+// rank 0
+func NewKeygenSession(participants, threshold, partyID uint8, seed []byte) (*KeygenSession, error) {
+	return createKeygenSession(participants, threshold, partyID, nil, seed)
+}
+
+// NewKeygenSessionWithRanks creates a keygen session for a key whose
+// parties have ranks. ranks holds the rank of every party, indexed by
+// party ID; rank 0 is the most powerful. Every rank must be below the
+// threshold, and a set of parties can sign only if the i-th smallest of
+// their ranks is at most i. For example, ranks {0, 1, 1} with threshold
+// 2 let party 0 sign with any other party, but not parties 1 and 2
+// together.
+func NewKeygenSessionWithRanks(ranks []uint8, threshold, partyID uint8, seed []byte) (*KeygenSession, error) {
+	if len(ranks) == 0 || len(ranks) > 255 {
+		return nil, errors.New("invalid number of ranks")
+	}
+	return createKeygenSession(uint8(len(ranks)), threshold, partyID, ranks, seed)
+}
+
+func createKeygenSession(participants, threshold, partyID uint8, ranks []uint8, seed []byte) (*KeygenSession, error) {
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
+	var ranksPtr *C.uint8_t
+	if len(ranks) > 0 {
+		ranksPtr = (*C.uint8_t)(&ranks[0])
+	}
 	var seedPtr *C.uint8_t
 	var seedLen C.size_t
 	if len(seed) > 0 {
 		seedPtr = (*C.uint8_t)(&seed[0])
 		seedLen = C.size_t(len(seed))
 	}
-	handle := C.dkls_keygen_new(C.uint8_t(participants), C.uint8_t(threshold), C.uint8_t(partyID), seedPtr, seedLen)
-	return &KeygenSession{handle: handle}
+	var errPtr *C.GoError
+	handle := C.dkls_keygen_new(C.uint8_t(participants), C.uint8_t(threshold), C.uint8_t(partyID), ranksPtr, C.size_t(len(ranks)), seedPtr, seedLen, &errPtr)
+	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("failed to create keygen session")
+	}
+	return newKeygenSession(handle), nil
 }
 
-// NewKeygenSessionFromBytes creates a keygen session from serialized bytes
+// NewKeygenSessionFromBytes restores a keygen session serialized with
+// KeygenSession.ToBytes at any round of the protocol
 func NewKeygenSessionFromBytes(data []byte) (*KeygenSession, error) {
 	if len(data) == 0 {
 		return nil, errors.New("empty data")
 	}
-	handle := C.dkls_keygen_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)))
+	var errPtr *C.GoError
+	handle := C.dkls_keygen_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)), &errPtr)
 	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
 		return nil, errors.New("failed to deserialize session")
 	}
-	return &KeygenSession{handle: handle}, nil
+	return newKeygenSession(handle), nil
 }
 
-// ToBytes serializes the session
+// ToBytes serializes the complete session state, including the current
+// round, so that it can be restored with NewKeygenSessionFromBytes and
+// continued from the same point of the protocol.
 func (s *KeygenSession) ToBytes() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	buf := C.dkls_keygen_to_bytes(s.handle)
 	defer freeByteBuffer(buf)
+	if buf.data == nil {
+		return nil, errors.New("failed to serialize session")
+	}
 	return cByteBufferToGo(buf), nil
 }
 
 // InitKeyRotation initializes key rotation
 func InitKeyRotation(oldShare *Keyshare, seed []byte) (*KeygenSession, error) {
-	if oldShare == nil || oldShare.handle == nil {
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
+	if oldShare == nil {
 		return nil, errors.New("nil keyshare")
 	}
+	oldShare.mu.RLock()
+	defer oldShare.mu.RUnlock()
+	if oldShare.handle == nil {
+		return nil, ErrHandleFreed
+	}
 	var seedPtr *C.uint8_t
 	var seedLen C.size_t
 	if len(seed) > 0 {
@@ -361,14 +619,22 @@ func InitKeyRotation(oldShare *Keyshare, seed []byte) (*KeygenSession, error) {
 		}
 		return nil, errors.New("failed to init key rotation")
 	}
-	return &KeygenSession{handle: handle}, nil
+	return newKeygenSession(handle), nil
 }
 
 // InitKeyRecovery initializes key recovery
 func InitKeyRecovery(oldShare *Keyshare, lostShares []byte, seed []byte) (*KeygenSession, error) {
-	if oldShare == nil || oldShare.handle == nil {
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
+	if oldShare == nil {
 		return nil, errors.New("nil keyshare")
 	}
+	oldShare.mu.RLock()
+	defer oldShare.mu.RUnlock()
+	if oldShare.handle == nil {
+		return nil, ErrHandleFreed
+	}
 	var seedPtr *C.uint8_t
 	var seedLen C.size_t
 	if len(seed) > 0 {
@@ -391,14 +657,35 @@ func InitKeyRecovery(oldShare *Keyshare, lostShares []byte, seed []byte) (*Keyge
 		}
 		return nil, errors.New("failed to init key recovery")
 	}
-	return &KeygenSession{handle: handle}, nil
+	return newKeygenSession(handle), nil
 }
 
 // InitLostShareRecovery initializes lost share recovery
 func InitLostShareRecovery(participants, threshold, partyID uint8, pk []byte, lostShares []byte, seed []byte) (*KeygenSession, error) {
+	return initLostShareRecovery(participants, threshold, partyID, nil, pk, lostShares, seed)
+}
+
+// InitLostShareRecoveryWithRanks initializes lost share recovery for a
+// key whose parties have ranks. ranks must be the rank list of the key,
+// as returned by Keyshare.Ranks.
+func InitLostShareRecoveryWithRanks(ranks []uint8, threshold, partyID uint8, pk []byte, lostShares []byte, seed []byte) (*KeygenSession, error) {
+	if len(ranks) == 0 || len(ranks) > 255 {
+		return nil, errors.New("invalid number of ranks")
+	}
+	return initLostShareRecovery(uint8(len(ranks)), threshold, partyID, ranks, pk, lostShares, seed)
+}
+
+func initLostShareRecovery(participants, threshold, partyID uint8, ranks []uint8, pk []byte, lostShares []byte, seed []byte) (*KeygenSession, error) {
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
 	if len(pk) != 33 {
 		return nil, errors.New("invalid public key size")
 	}
+	var ranksPtr *C.uint8_t
+	if len(ranks) > 0 {
+		ranksPtr = (*C.uint8_t)(&ranks[0])
+	}
 	var seedPtr *C.uint8_t
 	var seedLen C.size_t
 	if len(seed) > 0 {
@@ -416,6 +703,8 @@ func InitLostShareRecovery(participants, threshold, partyID uint8, pk []byte, lo
 		C.uint8_t(participants),
 		C.uint8_t(threshold),
 		C.uint8_t(partyID),
+		ranksPtr,
+		C.size_t(len(ranks)),
 		(*C.uint8_t)(&pk[0]),
 		C.size_t(len(pk)),
 		lostSharesPtr,
@@ -432,13 +721,15 @@ func InitLostShareRecovery(participants, threshold, partyID uint8, pk []byte, lo
 		}
 		return nil, errors.New("failed to init lost share recovery")
 	}
-	return &KeygenSession{handle: handle}, nil
+	return newKeygenSession(handle), nil
 }
 
 // CreateFirstMessage creates the first message
 func (s *KeygenSession) CreateFirstMessage() (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	var errPtr *C.GoError
 	msg := C.dkls_keygen_create_first_message(s.handle, &errPtr)
@@ -451,13 +742,17 @@ func (s *KeygenSession) CreateFirstMessage() (*Message, error) {
 		return nil, errors.New("failed to create first message")
 	}
 	defer C.dkls_message_free(msg)
-	return cMessageToGo(msg), nil
+	out := cMessageToGo(msg)
+	s.env.stamp(out)
+	return out, nil
 }
 
 // CalculateCommitment2 calculates the commitment for round 2
 func (s *KeygenSession) CalculateCommitment2() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	out := make([]byte, 32)
 	if C.dkls_keygen_calculate_commitment_2(s.handle, (*C.uint8_t)(&out[0])) != 0 {
@@ -468,12 +763,20 @@ func (s *KeygenSession) CalculateCommitment2() ([]byte, error) {
 
 // HandleMessages handles incoming messages
 func (s *KeygenSession) HandleMessages(msgs []*Message, commitments []byte, seed []byte) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	if len(msgs) == 0 {
 		return nil, errors.New("empty messages")
 	}
+	if err := s.env.check(msgs); err != nil {
+		return nil, err
+	}
 
 	// Convert Go messages to C
 	cMsgs, cleanup := goMessagesToC(msgs)
@@ -537,6 +840,7 @@ func (s *KeygenSession) HandleMessages(msgs []*Message, commitments []byte, seed
 		}
 	}
 
+	s.env.next()
 	if outArray.len == 0 {
 		return nil, nil
 	}
@@ -551,17 +855,22 @@ func (s *KeygenSession) HandleMessages(msgs []*Message, commitments []byte, seed
 		C.dkls_message_free_array(outArray.msgs, outArray.len)
 	}
 
+	s.env.stamp(result...)
 	return result, nil
 }
 
-// Keyshare extracts the keyshare from a completed session
+// Keyshare extracts the keyshare from a completed session. The session
+// is consumed, also when it returns an error.
 func (s *KeygenSession) Keyshare() (*Keyshare, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	var errPtr *C.GoError
 	handle := C.dkls_keygen_keyshare(s.handle, &errPtr)
 	s.handle = nil // Session is consumed
+	s.leak.release()
 	if handle == nil {
 		err := getError(errPtr)
 		freeError(errPtr)
@@ -570,28 +879,75 @@ func (s *KeygenSession) Keyshare() (*Keyshare, error) {
 		}
 		return nil, errors.New("failed to extract keyshare")
 	}
-	return &Keyshare{handle: handle}, nil
+	return newKeyshare(handle), nil
 }
 
 // Free releases the session
 func (s *KeygenSession) Free() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle != nil {
 		C.dkls_keygen_free(s.handle)
 		s.handle = nil
+		s.leak.release()
 	}
 }
 
+// Close frees the session. It implements io.Closer.
+func (s *KeygenSession) Close() error {
+	s.Free()
+	return nil
+}
+
 // SignSession represents a signing session
 type SignSession struct {
+	mu     sync.Mutex
 	handle C.SignSessionHandle
+	leak   *leakRecord
+	env    *binding          // nil until Bind
+	guard  PresignatureGuard // nil until SetPresignatureGuard
 }
 
-// NewSignSession creates a new sign session
+func newSignSession(handle C.SignSessionHandle) *SignSession {
+	s := &SignSession{handle: handle, leak: trackHandle("SignSession")}
+	runtime.SetFinalizer(s, func(s *SignSession) {
+		s.mu.Lock()
+		if s.handle != nil {
+			s.leak.leaked()
+		}
+		s.mu.Unlock()
+		s.Free()
+	})
+	return s
+}
+
+// NewSignSession creates a new sign session. chainPath is parsed
+// with ParsePath before the library is called.
 func NewSignSession(keyshare *Keyshare, chainPath string, seed []byte) (*SignSession, error) {
-	if keyshare == nil || keyshare.handle == nil {
+	path, err := ParsePath(chainPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignSessionWithPath(keyshare, path, seed)
+}
+
+// NewSignSessionWithPath is NewSignSession for a parsed derivation path
+func NewSignSessionWithPath(keyshare *Keyshare, path DerivationPath, seed []byte) (*SignSession, error) {
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
+	if keyshare == nil {
 		return nil, errors.New("nil keyshare")
 	}
-	cPath := C.CString(chainPath)
+	keyshare.mu.RLock()
+	defer keyshare.mu.RUnlock()
+	if keyshare.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	if err := path.Validate(); err != nil {
+		return nil, err
+	}
+	cPath := C.CString(path.String())
 	defer C.free(unsafe.Pointer(cPath))
 
 	var seedPtr *C.uint8_t
@@ -611,35 +967,120 @@ func NewSignSession(keyshare *Keyshare, chainPath string, seed []byte) (*SignSes
 		}
 		return nil, errors.New("failed to create sign session")
 	}
-	return &SignSession{handle: handle}, nil
+	return newSignSession(handle), nil
 }
 
-// NewSignSessionFromBytes creates a sign session from serialized bytes
+// NewSignSessionFromBytes restores a sign session serialized with
+// SignSession.ToBytes in the first round. A later session holds a copy
+// of its presignature and is refused with ErrNoPresignatureGuard; restore
+// it with NewSignSessionFromBytesWithGuard.
 func NewSignSessionFromBytes(data []byte) (*SignSession, error) {
+	return NewSignSessionFromBytesWithGuard(data, nil)
+}
+
+// NewSignSessionFromBytesWithGuard restores a session at any round
+// and sets guard on it. A session that can still sign is refused with
+// ErrPresignatureUsed if guard has recorded its presignature, and the
+// hash of a session that has signed is recorded.
+func NewSignSessionFromBytesWithGuard(data []byte, guard PresignatureGuard) (*SignSession, error) {
 	if len(data) == 0 {
 		return nil, errors.New("empty data")
 	}
-	handle := C.dkls_sign_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)))
+	var errPtr *C.GoError
+	handle := C.dkls_sign_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)), &errPtr)
 	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
 		return nil, errors.New("failed to deserialize session")
 	}
-	return &SignSession{handle: handle}, nil
+	s := newSignSession(handle)
+	s.mu.Lock()
+	err := s.setGuard(guard)
+	s.mu.Unlock()
+	if err != nil {
+		s.Free()
+		return nil, err
+	}
+	return s, nil
 }
 
-// ToBytes serializes the session
+// ToBytes serializes the complete session state at any round, including
+// the presignature and partial signature rounds. From the second round
+// on the session needs a PresignatureGuard, or ErrNoPresignatureGuard is
+// returned.
 func (s *SignSession) ToBytes() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
+	}
+	ref, err := s.presignature()
+	if err != nil {
+		return nil, err
+	}
+	if err := ref.checkSerialize(s.guard); err != nil {
+		return nil, err
 	}
 	buf := C.dkls_sign_to_bytes(s.handle)
 	defer freeByteBuffer(buf)
+	if buf.data == nil {
+		return nil, errors.New("failed to serialize session")
+	}
 	return cByteBufferToGo(buf), nil
 }
 
+// SetPresignatureGuard sets the guard that records the presignature of
+// the session when LastMessage signs, which lets ToBytes serialize the
+// session at any round. ErrPresignatureUsed is returned if the guard has
+// recorded the presignature as used by another session.
+func (s *SignSession) SetPresignatureGuard(guard PresignatureGuard) error {
+	if guard == nil {
+		return errors.New("nil guard")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handle == nil {
+		return ErrHandleFreed
+	}
+	return s.setGuard(guard)
+}
+
+// setGuard checks the session against guard and sets it. The caller
+// holds s.mu.
+func (s *SignSession) setGuard(guard PresignatureGuard) error {
+	ref, err := s.presignature()
+	if err != nil {
+		return err
+	}
+	if err := ref.checkRestore(guard); err != nil {
+		return err
+	}
+	s.guard = guard
+	return nil
+}
+
+// presignature returns the presignature reference of the session. The
+// caller holds s.mu.
+func (s *SignSession) presignature() (presignatureRef, error) {
+	id := make([]byte, 32)
+	hash := make([]byte, 32)
+	var partyID C.uint8_t
+	round := C.dkls_sign_presignature_id(s.handle, (*C.uint8_t)(&id[0]), &partyID, (*C.uint8_t)(&hash[0]))
+	if round < 0 {
+		return presignatureRef{}, errors.New("failed to read presignature ID")
+	}
+	return presignatureRef{round: int(round), id: id, partyID: uint8(partyID), hash: hash}, nil
+}
+
 // CreateFirstMessage creates the first message
 func (s *SignSession) CreateFirstMessage() (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	var errPtr *C.GoError
 	msg := C.dkls_sign_create_first_message(s.handle, &errPtr)
@@ -652,17 +1093,27 @@ func (s *SignSession) CreateFirstMessage() (*Message, error) {
 		return nil, errors.New("failed to create first message")
 	}
 	defer C.dkls_message_free(msg)
-	return cMessageToGo(msg), nil
+	out := cMessageToGo(msg)
+	s.env.stamp(out)
+	return out, nil
 }
 
 // HandleMessages handles incoming messages
 func (s *SignSession) HandleMessages(msgs []*Message, seed []byte) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	if len(msgs) == 0 {
 		return nil, errors.New("empty messages")
 	}
+	if err := s.env.check(msgs); err != nil {
+		return nil, err
+	}
 
 	// Convert Go messages to C
 	cMsgs, cleanup := goMessagesToC(msgs)
@@ -715,6 +1166,7 @@ func (s *SignSession) HandleMessages(msgs []*Message, seed []byte) ([]*Message,
 		}
 	}
 
+	s.env.next()
 	if outArray.len == 0 {
 		return nil, nil
 	}
@@ -729,17 +1181,31 @@ func (s *SignSession) HandleMessages(msgs []*Message, seed []byte) ([]*Message,
 		C.dkls_message_free_array(outArray.msgs, outArray.len)
 	}
 
+	s.env.stamp(result...)
 	return result, nil
 }
 
 // LastMessage creates the last message with the message hash
 func (s *SignSession) LastMessage(messageHash []byte) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	if len(messageHash) != 32 {
 		return nil, errors.New("message hash must be 32 bytes")
 	}
+	if s.guard != nil {
+		ref, err := s.presignature()
+		if err != nil {
+			return nil, err
+		}
+		if ref.round == presignatureReady {
+			if err := s.guard.Use(ref.id, ref.partyID, messageHash); err != nil {
+				return nil, err
+			}
+		}
+	}
 	var errPtr *C.GoError
 	msg := C.dkls_sign_last_message(s.handle, (*C.uint8_t)(&messageHash[0]), C.size_t(len(messageHash)), &errPtr)
 	if msg == nil {
@@ -751,16 +1217,52 @@ func (s *SignSession) LastMessage(messageHash []byte) (*Message, error) {
 		return nil, errors.New("failed to create last message")
 	}
 	defer C.dkls_message_free(msg)
-	return cMessageToGo(msg), nil
+	out := cMessageToGo(msg)
+	s.env.stamp(out)
+	return out, nil
+}
+
+// PreSignature extracts the presignature from a session that has
+// completed the interactive rounds, before LastMessage is called. The
+// session is consumed; the presignature can be exported and used later
+// to sign a single message hash. A session with a PresignatureGuard
+// signs with LastMessage and can not export its presignature.
+func (s *SignSession) PreSignature() (*PreSignature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	if s.guard != nil {
+		return nil, errors.New("session with a PresignatureGuard must sign with LastMessage")
+	}
+	var errPtr *C.GoError
+	handle := C.dkls_sign_presignature(s.handle, &errPtr)
+	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("failed to extract presignature")
+	}
+	s.handle = nil // Session is consumed
+	s.leak.release()
+	return newPreSignature(handle), nil
 }
 
 // Combine combines partial signatures and returns the final signature
-func (s *SignSession) Combine(msgs []*Message) (r, s_out []byte, err error) {
+func (s *SignSession) Combine(msgs []*Message) (*Signature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	if len(msgs) == 0 {
-		return nil, nil, errors.New("empty messages")
+		return nil, errors.New("empty messages")
+	}
+	if err := s.env.check(msgs); err != nil {
+		return nil, err
 	}
 
 	// Convert Go messages to C
@@ -769,6 +1271,8 @@ func (s *SignSession) Combine(msgs []*Message) (r, s_out []byte, err error) {
 
 	rOut := make([]byte, 32)
 	sOut := make([]byte, 32)
+	pkOut := make([]byte, 33)
+	var recid uint8
 
 	var errPtr *C.GoError
 	if len(cMsgs) > 0 {
@@ -778,15 +1282,18 @@ func (s *SignSession) Combine(msgs []*Message) (r, s_out []byte, err error) {
 			C.size_t(len(cMsgs)),
 			(*C.uint8_t)(&rOut[0]),
 			(*C.uint8_t)(&sOut[0]),
+			(*C.uint8_t)(&recid),
+			(*C.uint8_t)(&pkOut[0]),
 			&errPtr,
 		) != 0 {
 			s.handle = nil // Session is consumed
+			s.leak.release()
 			err := getError(errPtr)
 			freeError(errPtr)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
-			return nil, nil, errors.New("failed to combine signatures")
+			return nil, errors.New("failed to combine signatures")
 		}
 	} else {
 		// Empty messages case
@@ -796,41 +1303,93 @@ func (s *SignSession) Combine(msgs []*Message) (r, s_out []byte, err error) {
 			0,
 			(*C.uint8_t)(&rOut[0]),
 			(*C.uint8_t)(&sOut[0]),
+			(*C.uint8_t)(&recid),
+			(*C.uint8_t)(&pkOut[0]),
 			&errPtr,
 		) != 0 {
 			s.handle = nil // Session is consumed
+			s.leak.release()
 			err := getError(errPtr)
 			freeError(errPtr)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
-			return nil, nil, errors.New("failed to combine signatures")
+			return nil, errors.New("failed to combine signatures")
 		}
 	}
 
 	s.handle = nil // Session is consumed
-	return rOut, sOut, nil
+	s.leak.release()
+	return &Signature{R: rOut, S: sOut, RecoveryID: recid, PublicKey: pkOut}, nil
 }
 
 // Free releases the session
 func (s *SignSession) Free() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle != nil {
 		C.dkls_sign_free(s.handle)
 		s.handle = nil
+		s.leak.release()
 	}
 }
 
+// Close frees the session. It implements io.Closer.
+func (s *SignSession) Close() error {
+	s.Free()
+	return nil
+}
+
 // SignSessionOTVariant represents an OT variant signing session
 type SignSessionOTVariant struct {
+	mu     sync.Mutex
 	handle C.SignSessionOTVariantHandle
+	leak   *leakRecord
+	env    *binding          // nil until Bind
+	guard  PresignatureGuard // nil until SetPresignatureGuard
+}
+
+func newSignSessionOTVariant(handle C.SignSessionOTVariantHandle) *SignSessionOTVariant {
+	s := &SignSessionOTVariant{handle: handle, leak: trackHandle("SignSessionOTVariant")}
+	runtime.SetFinalizer(s, func(s *SignSessionOTVariant) {
+		s.mu.Lock()
+		if s.handle != nil {
+			s.leak.leaked()
+		}
+		s.mu.Unlock()
+		s.Free()
+	})
+	return s
 }
 
-// NewSignSessionOTVariant creates a new OT variant sign session
+// NewSignSessionOTVariant creates a new OT variant sign session.
+// chainPath is parsed with ParsePath before the library is called.
 func NewSignSessionOTVariant(keyshare *Keyshare, chainPath string, seed []byte) (*SignSessionOTVariant, error) {
-	if keyshare == nil || keyshare.handle == nil {
+	path, err := ParsePath(chainPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignSessionOTVariantWithPath(keyshare, path, seed)
+}
+
+// NewSignSessionOTVariantWithPath is NewSignSessionOTVariant for a
+// parsed derivation path
+func NewSignSessionOTVariantWithPath(keyshare *Keyshare, path DerivationPath, seed []byte) (*SignSessionOTVariant, error) {
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
+	if keyshare == nil {
 		return nil, errors.New("nil keyshare")
 	}
-	cPath := C.CString(chainPath)
+	keyshare.mu.RLock()
+	defer keyshare.mu.RUnlock()
+	if keyshare.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	if err := path.Validate(); err != nil {
+		return nil, err
+	}
+	cPath := C.CString(path.String())
 	defer C.free(unsafe.Pointer(cPath))
 
 	var seedPtr *C.uint8_t
@@ -850,35 +1409,119 @@ func NewSignSessionOTVariant(keyshare *Keyshare, chainPath string, seed []byte)
 		}
 		return nil, errors.New("failed to create sign session")
 	}
-	return &SignSessionOTVariant{handle: handle}, nil
+	return newSignSessionOTVariant(handle), nil
 }
 
-// NewSignSessionOTVariantFromBytes creates an OT variant sign session from serialized bytes
+// NewSignSessionOTVariantFromBytes restores an OT variant sign session
+// serialized with SignSessionOTVariant.ToBytes. The same presignature
+// reuse rules as for NewSignSessionFromBytes apply.
 func NewSignSessionOTVariantFromBytes(data []byte) (*SignSessionOTVariant, error) {
+	return NewSignSessionOTVariantFromBytesWithGuard(data, nil)
+}
+
+// NewSignSessionOTVariantFromBytesWithGuard restores a session at any round
+// and sets guard on it. A session that can still sign is refused with
+// ErrPresignatureUsed if guard has recorded its presignature, and the
+// hash of a session that has signed is recorded.
+func NewSignSessionOTVariantFromBytesWithGuard(data []byte, guard PresignatureGuard) (*SignSessionOTVariant, error) {
 	if len(data) == 0 {
 		return nil, errors.New("empty data")
 	}
-	handle := C.dkls_sign_ot_variant_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)))
+	var errPtr *C.GoError
+	handle := C.dkls_sign_ot_variant_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)), &errPtr)
 	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
 		return nil, errors.New("failed to deserialize session")
 	}
-	return &SignSessionOTVariant{handle: handle}, nil
+	s := newSignSessionOTVariant(handle)
+	s.mu.Lock()
+	err := s.setGuard(guard)
+	s.mu.Unlock()
+	if err != nil {
+		s.Free()
+		return nil, err
+	}
+	return s, nil
 }
 
-// ToBytes serializes the session
+// ToBytes serializes the complete session state at any round, including
+// the presignature and partial signature rounds. From the second round
+// on the session needs a PresignatureGuard, or ErrNoPresignatureGuard is
+// returned.
 func (s *SignSessionOTVariant) ToBytes() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
+	}
+	ref, err := s.presignature()
+	if err != nil {
+		return nil, err
+	}
+	if err := ref.checkSerialize(s.guard); err != nil {
+		return nil, err
 	}
 	buf := C.dkls_sign_ot_variant_to_bytes(s.handle)
 	defer freeByteBuffer(buf)
+	if buf.data == nil {
+		return nil, errors.New("failed to serialize session")
+	}
 	return cByteBufferToGo(buf), nil
 }
 
+// SetPresignatureGuard sets the guard that records the presignature of
+// the session when LastMessage signs, which lets ToBytes serialize the
+// session at any round. ErrPresignatureUsed is returned if the guard has
+// recorded the presignature as used by another session.
+func (s *SignSessionOTVariant) SetPresignatureGuard(guard PresignatureGuard) error {
+	if guard == nil {
+		return errors.New("nil guard")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handle == nil {
+		return ErrHandleFreed
+	}
+	return s.setGuard(guard)
+}
+
+// setGuard checks the session against guard and sets it. The caller
+// holds s.mu.
+func (s *SignSessionOTVariant) setGuard(guard PresignatureGuard) error {
+	ref, err := s.presignature()
+	if err != nil {
+		return err
+	}
+	if err := ref.checkRestore(guard); err != nil {
+		return err
+	}
+	s.guard = guard
+	return nil
+}
+
+// presignature returns the presignature reference of the session. The
+// caller holds s.mu.
+func (s *SignSessionOTVariant) presignature() (presignatureRef, error) {
+	id := make([]byte, 32)
+	hash := make([]byte, 32)
+	var partyID C.uint8_t
+	round := C.dkls_sign_ot_variant_presignature_id(s.handle, (*C.uint8_t)(&id[0]), &partyID, (*C.uint8_t)(&hash[0]))
+	if round < 0 {
+		return presignatureRef{}, errors.New("failed to read presignature ID")
+	}
+	return presignatureRef{round: int(round), id: id, partyID: uint8(partyID), hash: hash}, nil
+}
+
 // CreateFirstMessage creates the first message
 func (s *SignSessionOTVariant) CreateFirstMessage() (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	var errPtr *C.GoError
 	msg := C.dkls_sign_ot_variant_create_first_message(s.handle, &errPtr)
@@ -891,17 +1534,27 @@ func (s *SignSessionOTVariant) CreateFirstMessage() (*Message, error) {
 		return nil, errors.New("failed to create first message")
 	}
 	defer C.dkls_message_free(msg)
-	return cMessageToGo(msg), nil
+	out := cMessageToGo(msg)
+	s.env.stamp(out)
+	return out, nil
 }
 
 // HandleMessages handles incoming messages
 func (s *SignSessionOTVariant) HandleMessages(msgs []*Message, seed []byte) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkSeed(seed); err != nil {
+		return nil, err
+	}
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	if len(msgs) == 0 {
 		return nil, errors.New("empty messages")
 	}
+	if err := s.env.check(msgs); err != nil {
+		return nil, err
+	}
 
 	// Convert Go messages to C
 	cMsgs, cleanup := goMessagesToC(msgs)
@@ -954,6 +1607,7 @@ func (s *SignSessionOTVariant) HandleMessages(msgs []*Message, seed []byte) ([]*
 		}
 	}
 
+	s.env.next()
 	if outArray.len == 0 {
 		return nil, nil
 	}
@@ -968,17 +1622,31 @@ func (s *SignSessionOTVariant) HandleMessages(msgs []*Message, seed []byte) ([]*
 		C.dkls_message_free_array(outArray.msgs, outArray.len)
 	}
 
+	s.env.stamp(result...)
 	return result, nil
 }
 
 // LastMessage creates the last message with the message hash
 func (s *SignSessionOTVariant) LastMessage(messageHash []byte) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	if len(messageHash) != 32 {
 		return nil, errors.New("message hash must be 32 bytes")
 	}
+	if s.guard != nil {
+		ref, err := s.presignature()
+		if err != nil {
+			return nil, err
+		}
+		if ref.round == presignatureReady {
+			if err := s.guard.Use(ref.id, ref.partyID, messageHash); err != nil {
+				return nil, err
+			}
+		}
+	}
 	var errPtr *C.GoError
 	msg := C.dkls_sign_ot_variant_last_message(s.handle, (*C.uint8_t)(&messageHash[0]), C.size_t(len(messageHash)), &errPtr)
 	if msg == nil {
@@ -990,16 +1658,52 @@ func (s *SignSessionOTVariant) LastMessage(messageHash []byte) (*Message, error)
 		return nil, errors.New("failed to create last message")
 	}
 	defer C.dkls_message_free(msg)
-	return cMessageToGo(msg), nil
+	out := cMessageToGo(msg)
+	s.env.stamp(out)
+	return out, nil
+}
+
+// PreSignature extracts the presignature from a session that has
+// completed the interactive rounds, before LastMessage is called. The
+// session is consumed; the presignature can be exported and used later
+// to sign a single message hash. A session with a PresignatureGuard
+// signs with LastMessage and can not export its presignature.
+func (s *SignSessionOTVariant) PreSignature() (*PreSignature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	if s.guard != nil {
+		return nil, errors.New("session with a PresignatureGuard must sign with LastMessage")
+	}
+	var errPtr *C.GoError
+	handle := C.dkls_sign_ot_variant_presignature(s.handle, &errPtr)
+	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("failed to extract presignature")
+	}
+	s.handle = nil // Session is consumed
+	s.leak.release()
+	return newPreSignature(handle), nil
 }
 
 // Combine combines partial signatures and returns the final signature
-func (s *SignSessionOTVariant) Combine(msgs []*Message) (r, s_out []byte, err error) {
+func (s *SignSessionOTVariant) Combine(msgs []*Message) (*Signature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle == nil {
-		return nil, nil, errors.New("nil session")
+		return nil, ErrHandleFreed
 	}
 	if len(msgs) == 0 {
-		return nil, nil, errors.New("empty messages")
+		return nil, errors.New("empty messages")
+	}
+	if err := s.env.check(msgs); err != nil {
+		return nil, err
 	}
 
 	// Convert Go messages to C
@@ -1008,6 +1712,8 @@ func (s *SignSessionOTVariant) Combine(msgs []*Message) (r, s_out []byte, err er
 
 	rOut := make([]byte, 32)
 	sOut := make([]byte, 32)
+	pkOut := make([]byte, 33)
+	var recid uint8
 
 	var errPtr *C.GoError
 	if len(cMsgs) > 0 {
@@ -1017,15 +1723,18 @@ func (s *SignSessionOTVariant) Combine(msgs []*Message) (r, s_out []byte, err er
 			C.size_t(len(cMsgs)),
 			(*C.uint8_t)(&rOut[0]),
 			(*C.uint8_t)(&sOut[0]),
+			(*C.uint8_t)(&recid),
+			(*C.uint8_t)(&pkOut[0]),
 			&errPtr,
 		) != 0 {
 			s.handle = nil // Session is consumed
+			s.leak.release()
 			err := getError(errPtr)
 			freeError(errPtr)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
-			return nil, nil, errors.New("failed to combine signatures")
+			return nil, errors.New("failed to combine signatures")
 		}
 	} else {
 		// Empty messages case
@@ -1035,26 +1744,326 @@ func (s *SignSessionOTVariant) Combine(msgs []*Message) (r, s_out []byte, err er
 			0,
 			(*C.uint8_t)(&rOut[0]),
 			(*C.uint8_t)(&sOut[0]),
+			(*C.uint8_t)(&recid),
+			(*C.uint8_t)(&pkOut[0]),
 			&errPtr,
 		) != 0 {
 			s.handle = nil // Session is consumed
+			s.leak.release()
 			err := getError(errPtr)
 			freeError(errPtr)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
-			return nil, nil, errors.New("failed to combine signatures")
+			return nil, errors.New("failed to combine signatures")
 		}
 	}
 
 	s.handle = nil // Session is consumed
-	return rOut, sOut, nil
+	s.leak.release()
+	return &Signature{R: rOut, S: sOut, RecoveryID: recid, PublicKey: pkOut}, nil
 }
 
 // Free releases the session
 func (s *SignSessionOTVariant) Free() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.handle != nil {
 		C.dkls_sign_ot_variant_free(s.handle)
 		s.handle = nil
+		s.leak.release()
 	}
 }
+
+// Close frees the session. It implements io.Closer.
+func (s *SignSessionOTVariant) Close() error {
+	s.Free()
+	return nil
+}
+
+// PreSignature is the result of the three interactive rounds of the sign
+// protocol. It signs exactly one message hash and must never be reused:
+// two signatures from the same presignature reveal the private key.
+type PreSignature struct {
+	mu     sync.Mutex
+	handle C.PreSignatureHandle
+	leak   *leakRecord
+}
+
+func newPreSignature(handle C.PreSignatureHandle) *PreSignature {
+	p := &PreSignature{handle: handle, leak: trackHandle("PreSignature")}
+	runtime.SetFinalizer(p, func(p *PreSignature) {
+		p.mu.Lock()
+		if p.handle != nil {
+			p.leak.leaked()
+		}
+		p.mu.Unlock()
+		p.Free()
+	})
+	return p
+}
+
+// NewPreSignatureFromBytes restores a presignature serialized with
+// PreSignature.ToBytes. A presignature already used by this process is
+// refused, see NewSignSessionFromBytes.
+func NewPreSignatureFromBytes(data []byte) (*PreSignature, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+	var errPtr *C.GoError
+	handle := C.dkls_presignature_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)), &errPtr)
+	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("failed to deserialize presignature")
+	}
+	return newPreSignature(handle), nil
+}
+
+// ToBytes serializes the presignature. The output contains secret
+// material and must be stored as carefully as a keyshare.
+func (p *PreSignature) ToBytes() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	buf := C.dkls_presignature_to_bytes(p.handle)
+	defer freeByteBuffer(buf)
+	if buf.data == nil {
+		return nil, errors.New("failed to serialize presignature")
+	}
+	return cByteBufferToGo(buf), nil
+}
+
+// FinalSessionID returns the 32-byte session ID shared by all parties
+// that computed this presignature
+func (p *PreSignature) FinalSessionID() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	out := make([]byte, 32)
+	if C.dkls_presignature_final_session_id(p.handle, (*C.uint8_t)(&out[0])) != 0 {
+		return nil, errors.New("failed to get final session id")
+	}
+	return out, nil
+}
+
+// PartyID returns the party ID of the presignature owner
+func (p *PreSignature) PartyID() uint8 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return 0
+	}
+	return uint8(C.dkls_presignature_party_id(p.handle))
+}
+
+// PublicKey returns the derived public key (33 bytes) the final
+// signature will verify against
+func (p *PreSignature) PublicKey() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	out := make([]byte, 33)
+	if C.dkls_presignature_public_key(p.handle, (*C.uint8_t)(&out[0])) != 0 {
+		return nil, errors.New("failed to get public key")
+	}
+	return out, nil
+}
+
+// Sign turns the presignature into a partial signature of the 32-byte
+// message hash. It returns the partial signature and the message that
+// must be broadcast to the other parties. The presignature is consumed.
+func (p *PreSignature) Sign(messageHash []byte) (*PartialSignature, *Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return nil, nil, ErrHandleFreed
+	}
+	if len(messageHash) != 32 {
+		return nil, nil, errors.New("message hash must be 32 bytes")
+	}
+	var errPtr *C.GoError
+	handle := C.dkls_presignature_sign(p.handle, (*C.uint8_t)(&messageHash[0]), C.size_t(len(messageHash)), &errPtr)
+	p.handle = nil // Presignature is consumed
+	p.leak.release()
+	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("failed to create partial signature")
+	}
+	partial := newPartialSignature(handle)
+	msg, err := partial.Message()
+	if err != nil {
+		partial.Free()
+		return nil, nil, err
+	}
+	return partial, msg, nil
+}
+
+// Free releases the presignature
+func (p *PreSignature) Free() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle != nil {
+		C.dkls_presignature_free(p.handle)
+		p.handle = nil
+		p.leak.release()
+	}
+}
+
+// Close frees the presignature. It implements io.Closer.
+func (p *PreSignature) Close() error {
+	p.Free()
+	return nil
+}
+
+// PartialSignature is this party's share of a signature of one message
+// hash, waiting for the partial signatures of the other parties.
+type PartialSignature struct {
+	mu     sync.Mutex
+	handle C.PartialSignatureHandle
+	leak   *leakRecord
+}
+
+func newPartialSignature(handle C.PartialSignatureHandle) *PartialSignature {
+	p := &PartialSignature{handle: handle, leak: trackHandle("PartialSignature")}
+	runtime.SetFinalizer(p, func(p *PartialSignature) {
+		p.mu.Lock()
+		if p.handle != nil {
+			p.leak.leaked()
+		}
+		p.mu.Unlock()
+		p.Free()
+	})
+	return p
+}
+
+// NewPartialSignatureFromBytes restores a partial signature serialized
+// with PartialSignature.ToBytes
+func NewPartialSignatureFromBytes(data []byte) (*PartialSignature, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+	var errPtr *C.GoError
+	handle := C.dkls_partial_signature_from_bytes((*C.uint8_t)(&data[0]), C.size_t(len(data)), &errPtr)
+	if handle == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("failed to deserialize partial signature")
+	}
+	return newPartialSignature(handle), nil
+}
+
+// ToBytes serializes the partial signature
+func (p *PartialSignature) ToBytes() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	buf := C.dkls_partial_signature_to_bytes(p.handle)
+	defer freeByteBuffer(buf)
+	if buf.data == nil {
+		return nil, errors.New("failed to serialize partial signature")
+	}
+	return cByteBufferToGo(buf), nil
+}
+
+// Message returns the message to broadcast to the other parties, the
+// same one returned by PreSignature.Sign
+func (p *PartialSignature) Message() (*Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	var errPtr *C.GoError
+	msg := C.dkls_partial_signature_message(p.handle, &errPtr)
+	if msg == nil {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("failed to create partial signature message")
+	}
+	defer C.dkls_message_free(msg)
+	return cMessageToGo(msg), nil
+}
+
+// Combine combines the partial signature with the messages of the other
+// parties and returns the final signature. The partial signature is
+// consumed.
+func (p *PartialSignature) Combine(msgs []*Message) (*Signature, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle == nil {
+		return nil, ErrHandleFreed
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("empty messages")
+	}
+
+	cMsgs, cleanup := goMessagesToC(msgs)
+	defer cleanup()
+
+	rOut := make([]byte, 32)
+	sOut := make([]byte, 32)
+	pkOut := make([]byte, 33)
+	var recid uint8
+
+	var errPtr *C.GoError
+	rc := C.dkls_partial_signature_combine(
+		p.handle,
+		&cMsgs[0],
+		C.size_t(len(cMsgs)),
+		(*C.uint8_t)(&rOut[0]),
+		(*C.uint8_t)(&sOut[0]),
+		(*C.uint8_t)(&recid),
+		(*C.uint8_t)(&pkOut[0]),
+		&errPtr,
+	)
+	p.handle = nil // Partial signature is consumed
+	p.leak.release()
+	if rc != 0 {
+		err := getError(errPtr)
+		freeError(errPtr)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("failed to combine signatures")
+	}
+	return &Signature{R: rOut, S: sOut, RecoveryID: recid, PublicKey: pkOut}, nil
+}
+
+// Free releases the partial signature
+func (p *PartialSignature) Free() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.handle != nil {
+		C.dkls_partial_signature_free(p.handle)
+		p.handle = nil
+		p.leak.release()
+	}
+}
+
+// Close frees the partial signature. It implements io.Closer.
+func (p *PartialSignature) Close() error {
+	p.Free()
+	return nil
+}
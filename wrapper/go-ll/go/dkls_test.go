@@ -5,6 +5,10 @@ package dkls
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -33,7 +37,29 @@ func selectMessages(msgs []*Message, partyID uint8) []*Message {
 func runDKG(n, t uint8) ([]*Keyshare, error) {
 	parties := make([]*KeygenSession, n)
 	for i := uint8(0); i < n; i++ {
-		parties[i] = NewKeygenSession(n, t, i, nil)
+		var err error
+		parties[i], err = NewKeygenSession(n, t, i, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return runKeygenParties(parties, nil)
+}
+
+// runKeygenParties drives the keygen protocol for the given sessions.
+// If afterRound is not nil, it is called after every round and may
+// replace the sessions in the slice.
+func runKeygenParties(parties []*KeygenSession, afterRound func([]*KeygenSession) error) ([]*Keyshare, error) {
+	n := len(parties)
+	nextRound := func() error {
+		if afterRound == nil {
+			return nil
+		}
+		return afterRound(parties)
+	}
+
+	if err := nextRound(); err != nil {
+		return nil, err
 	}
 
 	// Round 1: Create first messages
@@ -45,6 +71,9 @@ func runDKG(n, t uint8) ([]*Keyshare, error) {
 			return nil, err
 		}
 	}
+	if err := nextRound(); err != nil {
+		return nil, err
+	}
 
 	// Round 2: Handle first messages
 	msg2 := make([]*Message, 0)
@@ -56,6 +85,9 @@ func runDKG(n, t uint8) ([]*Keyshare, error) {
 		}
 		msg2 = append(msg2, out...)
 	}
+	if err := nextRound(); err != nil {
+		return nil, err
+	}
 
 	// Calculate commitments
 	commitments := make([]byte, n*32)
@@ -77,6 +109,9 @@ func runDKG(n, t uint8) ([]*Keyshare, error) {
 		}
 		msg3 = append(msg3, out...)
 	}
+	if err := nextRound(); err != nil {
+		return nil, err
+	}
 
 	// Round 4: Handle third messages with commitments
 	msg4 := make([]*Message, 0)
@@ -88,6 +123,9 @@ func runDKG(n, t uint8) ([]*Keyshare, error) {
 		}
 		msg4 = append(msg4, out...)
 	}
+	if err := nextRound(); err != nil {
+		return nil, err
+	}
 
 	// Round 5: Handle fourth messages
 	for i, party := range parties {
@@ -97,6 +135,9 @@ func runDKG(n, t uint8) ([]*Keyshare, error) {
 			return nil, err
 		}
 	}
+	if err := nextRound(); err != nil {
+		return nil, err
+	}
 
 	// Extract keyshares
 	shares := make([]*Keyshare, n)
@@ -112,29 +153,79 @@ func runDKG(n, t uint8) ([]*Keyshare, error) {
 }
 
 func runDSG(shares []*Keyshare, t int, messageHash []byte) ([][]byte, error) {
+	parties := make([]signer, t)
+	for i := 0; i < t; i++ {
+		party, err := NewSignSession(shares[i], "m", nil)
+		if err != nil {
+			return nil, err
+		}
+		defer party.Free()
+		parties[i] = party
+	}
+	return runSigners(parties, messageHash, nil)
+}
+
+// runSigners drives the sign protocol for the given sessions. If
+// afterRound is not nil, it is called after every round and may replace
+// the sessions in the slice.
+func runSigners(parties []signer, messageHash []byte, afterRound func([]signer) error) ([][]byte, error) {
 	if len(messageHash) != 32 {
 		messageHash = make([]byte, 32)
 	}
+	t := len(parties)
+	nextRound := func() error {
+		if afterRound == nil {
+			return nil
+		}
+		return afterRound(parties)
+	}
 
-	parties := make([]*SignSession, t)
-	for i := 0; i < t; i++ {
+	if err := runPresign(parties, nextRound); err != nil {
+		return nil, err
+	}
+
+	// Create last messages
+	msg4 := make([]*Message, t)
+	for i, party := range parties {
 		var err error
-		parties[i], err = NewSignSession(shares[i], "m", nil)
+		msg4[i], err = party.LastMessage(messageHash)
 		if err != nil {
 			return nil, err
 		}
-		defer parties[i].Free()
+	}
+	if err := nextRound(); err != nil {
+		return nil, err
 	}
 
+	// Combine signatures
+	signatures := make([][]byte, t)
+	for i, party := range parties {
+		batch := filterMessages(msg4, uint8(i))
+		sig, err := party.Combine(batch)
+		if err != nil {
+			return nil, err
+		}
+		signatures[i] = sig.Compact()
+	}
+
+	return signatures, nil
+}
+
+// runPresign runs the interactive rounds of the sign protocol, leaving
+// every session holding a presignature.
+func runPresign(parties []signer, nextRound func() error) error {
 	// Round 1: Create first messages
-	msg1 := make([]*Message, t)
+	msg1 := make([]*Message, len(parties))
 	for i, party := range parties {
 		var err error
 		msg1[i], err = party.CreateFirstMessage()
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
+	if err := nextRound(); err != nil {
+		return err
+	}
 
 	// Round 2: Handle first messages
 	msg2 := make([]*Message, 0)
@@ -142,10 +233,13 @@ func runDSG(shares []*Keyshare, t int, messageHash []byte) ([][]byte, error) {
 		batch := filterMessages(msg1, uint8(i))
 		out, err := party.HandleMessages(batch, nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		msg2 = append(msg2, out...)
 	}
+	if err := nextRound(); err != nil {
+		return err
+	}
 
 	// Round 3: Handle second messages
 	msg3 := make([]*Message, 0)
@@ -153,42 +247,23 @@ func runDSG(shares []*Keyshare, t int, messageHash []byte) ([][]byte, error) {
 		batch := selectMessages(msg2, uint8(i))
 		out, err := party.HandleMessages(batch, nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		msg3 = append(msg3, out...)
 	}
+	if err := nextRound(); err != nil {
+		return err
+	}
 
 	// Round 4: Handle third messages
 	for i, party := range parties {
 		batch := selectMessages(msg3, uint8(i))
 		_, err := party.HandleMessages(batch, nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
-
-	// Create last messages
-	msg4 := make([]*Message, t)
-	for i, party := range parties {
-		var err error
-		msg4[i], err = party.LastMessage(messageHash)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// Combine signatures
-	signatures := make([][]byte, t)
-	for i, party := range parties {
-		batch := filterMessages(msg4, uint8(i))
-		r, s, err := party.Combine(batch)
-		if err != nil {
-			return nil, err
-		}
-		signatures[i] = append(r, s...)
-	}
-
-	return signatures, nil
+	return nextRound()
 }
 
 // Tests
@@ -464,6 +539,466 @@ func TestKeyshareSerialization(t *testing.T) {
 	}
 }
 
+// restoreKeygenSessions replaces every session with a copy restored
+// from its serialized form.
+func restoreKeygenSessions(parties []*KeygenSession) error {
+	for i, party := range parties {
+		data, err := party.ToBytes()
+		if err != nil {
+			return err
+		}
+		restored, err := NewKeygenSessionFromBytes(data)
+		if err != nil {
+			return err
+		}
+		party.Free()
+		parties[i] = restored
+	}
+	return nil
+}
+
+func TestKeygenSessionSerialization(t *testing.T) {
+	parties := make([]*KeygenSession, 3)
+	for i := range parties {
+		var err error
+		parties[i], err = NewKeygenSession(3, 2, uint8(i), nil)
+		if err != nil {
+			t.Fatalf("failed to create keygen session: %v", err)
+		}
+	}
+
+	shares, err := runKeygenParties(parties, restoreKeygenSessions)
+	if err != nil {
+		t.Fatalf("DKG with restored sessions failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	pk0, err := shares[0].PublicKey()
+	if err != nil {
+		t.Fatalf("failed to get public key: %v", err)
+	}
+	for i := 1; i < len(shares); i++ {
+		pk, err := shares[i].PublicKey()
+		if err != nil {
+			t.Fatalf("failed to get public key: %v", err)
+		}
+		if !bytes.Equal(pk0, pk) {
+			t.Errorf("public keys don't match: share 0 vs share %d", i)
+		}
+	}
+
+	if _, err := runDSG(shares, 2, nil); err != nil {
+		t.Fatalf("DSG with keyshares from restored sessions failed: %v", err)
+	}
+}
+
+func TestKeygenSessionFromBytesInvalid(t *testing.T) {
+	session, err := NewKeygenSession(2, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to create keygen session: %v", err)
+	}
+	defer session.Free()
+
+	data, err := session.ToBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize session: %v", err)
+	}
+
+	// Unknown format version
+	bad := append([]byte{}, data...)
+	bad[1] = 0xFF
+	if _, err := NewKeygenSessionFromBytes(bad); err == nil {
+		t.Error("expected error for unsupported session version")
+	}
+
+	// Truncated data
+	if _, err := NewKeygenSessionFromBytes(data[:len(data)/2]); err == nil {
+		t.Error("expected error for truncated session data")
+	}
+}
+
+// restoreSigners replaces every session with a copy restored from its
+// serialized form, guarded by a MemoryPresignatureGuard.
+func restoreSigners(parties []signer) error {
+	guard := NewMemoryPresignatureGuard()
+	for i, party := range parties {
+		err := party.(interface {
+			SetPresignatureGuard(PresignatureGuard) error
+		}).SetPresignatureGuard(guard)
+		if err != nil {
+			return err
+		}
+		data, err := party.ToBytes()
+		if err != nil {
+			return err
+		}
+		var restored signer
+		switch party.(type) {
+		case *SignSession:
+			restored, err = NewSignSessionFromBytesWithGuard(data, guard)
+		case *SignSessionOTVariant:
+			restored, err = NewSignSessionOTVariantFromBytesWithGuard(data, guard)
+		}
+		if err != nil {
+			return err
+		}
+		party.Free()
+		parties[i] = restored
+	}
+	return nil
+}
+
+func TestSignSessionSerialization(t *testing.T) {
+	shares, err := runDKG(3, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	parties := make([]signer, 2)
+	for i := range parties {
+		parties[i], err = NewSignSession(shares[i], "m", nil)
+		if err != nil {
+			t.Fatalf("failed to create sign session: %v", err)
+		}
+	}
+	defer func() {
+		for _, party := range parties {
+			party.Free()
+		}
+	}()
+
+	signatures, err := runSigners(parties, nil, restoreSigners)
+	if err != nil {
+		t.Fatalf("DSG with restored sessions failed: %v", err)
+	}
+	if !bytes.Equal(signatures[0], signatures[1]) {
+		t.Error("signatures don't match")
+	}
+}
+
+func TestSignSessionOTVariantSerialization(t *testing.T) {
+	shares, err := runDKG(3, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	parties := make([]signer, 2)
+	for i := range parties {
+		parties[i], err = NewSignSessionOTVariant(shares[i], "m", nil)
+		if err != nil {
+			t.Fatalf("failed to create sign session: %v", err)
+		}
+	}
+	defer func() {
+		for _, party := range parties {
+			party.Free()
+		}
+	}()
+
+	signatures, err := runSigners(parties, nil, restoreSigners)
+	if err != nil {
+		t.Fatalf("DSG with restored sessions failed: %v", err)
+	}
+	if !bytes.Equal(signatures[0], signatures[1]) {
+		t.Error("signatures don't match")
+	}
+}
+
+func TestSignSessionPresignatureReuse(t *testing.T) {
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	parties := make([]signer, 2)
+	for i := range parties {
+		parties[i], err = NewSignSession(shares[i], "m", nil)
+		if err != nil {
+			t.Fatalf("failed to create sign session: %v", err)
+		}
+	}
+	defer func() {
+		for _, party := range parties {
+			party.Free()
+		}
+	}()
+
+	if err := runPresign(parties, func() error { return nil }); err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	// The presignature can only be serialized with a guard
+	session := parties[0].(*SignSession)
+	if _, err := session.ToBytes(); !errors.Is(err, ErrNoPresignatureGuard) {
+		t.Fatalf("expected ErrNoPresignatureGuard, got %v", err)
+	}
+	guard := NewMemoryPresignatureGuard()
+	if err := session.SetPresignatureGuard(guard); err != nil {
+		t.Fatalf("failed to set guard: %v", err)
+	}
+
+	// Snapshot the session while it holds the presignature, then use it.
+	data, err := session.ToBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize session: %v", err)
+	}
+	hash := make([]byte, 32)
+	if _, err := session.LastMessage(hash); err != nil {
+		t.Fatalf("failed to create last message: %v", err)
+	}
+
+	if _, err := NewSignSessionFromBytes(data); !errors.Is(err, ErrNoPresignatureGuard) {
+		t.Errorf("expected ErrNoPresignatureGuard without a guard, got %v", err)
+	}
+	if _, err := NewSignSessionFromBytesWithGuard(data, guard); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed when restoring a used presignature, got %v", err)
+	}
+
+	// After the last message the session restores with the same hash only
+	signed, err := session.ToBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize signed session: %v", err)
+	}
+	restored, err := NewSignSessionFromBytesWithGuard(signed, guard)
+	if err != nil {
+		t.Fatalf("failed to restore signed session: %v", err)
+	}
+	restored.Free()
+	other := NewMemoryPresignatureGuard()
+	id, partyID := guardEntry(t, guard)
+	if err := other.Use(id, partyID, []byte("another hash")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSignSessionFromBytesWithGuard(signed, other); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed for a guard with another hash, got %v", err)
+	}
+}
+
+// guardEntry returns the only presignature recorded by guard
+func guardEntry(t *testing.T, guard *MemoryPresignatureGuard) ([]byte, uint8) {
+	t.Helper()
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if len(guard.used) != 1 {
+		t.Fatalf("guard holds %d presignatures, want 1", len(guard.used))
+	}
+	for key := range guard.used {
+		return []byte(key.id), key.partyID
+	}
+	return nil, 0
+}
+
+// TestSignSessionRestoreAfterRestart checks that a presignature used
+// before a restart can not sign again in a new process, which starts
+// with an empty registry of used presignatures
+func TestSignSessionRestoreAfterRestart(t *testing.T) {
+	if dir := os.Getenv("DKLS_TEST_RESTART_DIR"); dir != "" {
+		restoreAfterRestart(t, dir)
+		return
+	}
+
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	parties := make([]signer, 2)
+	for i := range parties {
+		parties[i], err = NewSignSession(shares[i], "m", nil)
+		if err != nil {
+			t.Fatalf("failed to create sign session: %v", err)
+		}
+	}
+	defer func() {
+		for _, party := range parties {
+			party.Free()
+		}
+	}()
+
+	if err := runPresign(parties, func() error { return nil }); err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	guard, err := NewFilePresignatureGuard(filepath.Join(dir, "guard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := parties[0].(*SignSession)
+	if err := session.SetPresignatureGuard(guard); err != nil {
+		t.Fatalf("failed to set guard: %v", err)
+	}
+	data, err := session.ToBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize session: %v", err)
+	}
+	if _, err := session.LastMessage(make([]byte, 32)); err != nil {
+		t.Fatalf("failed to create last message: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "session"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSignSessionRestoreAfterRestart$")
+	cmd.Env = append(os.Environ(), "DKLS_TEST_RESTART_DIR="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("restarted process failed: %v\n%s", err, out)
+	}
+}
+
+// restoreAfterRestart runs in the restarted process
+func restoreAfterRestart(t *testing.T, dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, "session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSignSessionFromBytes(data); !errors.Is(err, ErrNoPresignatureGuard) {
+		t.Errorf("expected ErrNoPresignatureGuard without a guard, got %v", err)
+	}
+	guard, err := NewFilePresignatureGuard(filepath.Join(dir, "guard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSignSessionFromBytesWithGuard(data, guard); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed after restart, got %v", err)
+	}
+
+	// Only the guard remembers the presignature: with an empty one the
+	// session restores and signs another hash
+	empty, err := NewFilePresignatureGuard(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := NewSignSessionFromBytesWithGuard(data, empty)
+	if err != nil {
+		t.Fatalf("failed to restore with an empty guard: %v", err)
+	}
+	defer session.Free()
+	hash := bytes.Repeat([]byte{1}, 32)
+	if _, err := session.LastMessage(hash); err != nil {
+		t.Errorf("expected the registry to be empty after restart, got %v", err)
+	}
+}
+
+func TestPreSignatureOfflineOnline(t *testing.T) {
+	shares, err := runDKG(3, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	parties := make([]signer, 2)
+	for i := range parties {
+		parties[i], err = NewSignSessionOTVariant(shares[i], "m", nil)
+		if err != nil {
+			t.Fatalf("failed to create sign session: %v", err)
+		}
+	}
+	defer func() {
+		for _, party := range parties {
+			party.Free()
+		}
+	}()
+
+	if err := runPresign(parties, func() error { return nil }); err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+
+	// Offline phase: extract and store the presignatures.
+	stored := make([][]byte, len(parties))
+	for i, party := range parties {
+		pre, err := party.(*SignSessionOTVariant).PreSignature()
+		if err != nil {
+			t.Fatalf("failed to extract presignature: %v", err)
+		}
+		if pre.PartyID() != uint8(i) {
+			t.Errorf("party %d: unexpected party ID %d", i, pre.PartyID())
+		}
+		stored[i], err = pre.ToBytes()
+		pre.Free()
+		if err != nil {
+			t.Fatalf("failed to serialize presignature: %v", err)
+		}
+	}
+
+	// Online phase: sign a hash with the restored presignatures.
+	messageHash := make([]byte, 32)
+	for i := range messageHash {
+		messageHash[i] = byte(i)
+	}
+
+	var sessionID []byte
+	partials := make([]*PartialSignature, len(stored))
+	msg4 := make([]*Message, len(stored))
+	for i, data := range stored {
+		pre, err := NewPreSignatureFromBytes(data)
+		if err != nil {
+			t.Fatalf("failed to restore presignature: %v", err)
+		}
+		id, err := pre.FinalSessionID()
+		if err != nil {
+			t.Fatalf("failed to get final session id: %v", err)
+		}
+		if sessionID == nil {
+			sessionID = id
+		} else if !bytes.Equal(sessionID, id) {
+			t.Errorf("party %d: final session id mismatch", i)
+		}
+		partials[i], msg4[i], err = pre.Sign(messageHash)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+	}
+
+	signatures := make([][]byte, len(partials))
+	for i, partial := range partials {
+		sig, err := partial.Combine(filterMessages(msg4, uint8(i)))
+		if err != nil {
+			t.Fatalf("failed to combine: %v", err)
+		}
+		signatures[i] = sig.Bytes()
+	}
+	if !bytes.Equal(signatures[0], signatures[1]) {
+		t.Error("signatures from different parties do not match")
+	}
+
+	// A presignature that has signed must not be restored again, for
+	// either party, although both share the final session ID.
+	for i, data := range stored {
+		if _, err := NewPreSignatureFromBytes(data); !errors.Is(err, ErrPresignatureUsed) {
+			t.Errorf("party %d: expected ErrPresignatureUsed when restoring a used presignature, got %v", i, err)
+		}
+	}
+}
+
 func TestKeyRotation(t *testing.T) {
 	// Create initial shares
 	oldShares, err := runDKG(3, 2)
@@ -591,8 +1126,77 @@ func TestKeyRecovery(t *testing.T) {
 	// and verify the new public key matches the old one
 }
 
+func TestInvalidSeed(t *testing.T) {
+	seed := make([]byte, 16)
+	if _, err := NewKeygenSession(2, 2, 0, seed); !errors.Is(err, ErrInvalidSeed) {
+		t.Errorf("expected ErrInvalidSeed from NewKeygenSession, got %v", err)
+	}
+	if _, err := NewSignSession(nil, "m", seed); !errors.Is(err, ErrInvalidSeed) {
+		t.Errorf("expected ErrInvalidSeed from NewSignSession, got %v", err)
+	}
+	if _, err := InitKeyRotation(nil, seed); !errors.Is(err, ErrInvalidSeed) {
+		t.Errorf("expected ErrInvalidSeed from InitKeyRotation, got %v", err)
+	}
+}
+
+func TestNewKeygenSessionInvalidParameters(t *testing.T) {
+	if _, err := NewKeygenSession(2, 3, 0, nil); err == nil {
+		t.Error("expected error for threshold above participants")
+	}
+	if _, err := NewKeygenSession(3, 2, 3, nil); err == nil {
+		t.Error("expected error for party id out of range")
+	}
+}
+
+func TestRankedKeygenAndSign(t *testing.T) {
+	for _, ranks := range [][]uint8{{1, 1, 1}, {0, 2, 0}} {
+		if _, err := NewKeygenSessionWithRanks(ranks, 2, 0, nil); !errors.Is(err, ErrKeygenInvalidRanks) {
+			t.Errorf("expected ErrKeygenInvalidRanks for ranks %v, got %v", ranks, err)
+		}
+	}
+
+	// Party 0 can sign with any other party, but parties 1 and 2 can
+	// not sign together
+	ranks := []uint8{0, 1, 1}
+	parties := make([]*KeygenSession, len(ranks))
+	for i := range parties {
+		var err error
+		parties[i], err = NewKeygenSessionWithRanks(ranks, 2, uint8(i), nil)
+		if err != nil {
+			t.Fatalf("failed to create keygen session: %v", err)
+		}
+	}
+	shares, err := runKeygenParties(parties, nil)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	got, err := shares[2].Ranks()
+	if err != nil {
+		t.Fatalf("failed to get ranks: %v", err)
+	}
+	if !bytes.Equal(got, ranks) {
+		t.Errorf("expected ranks %v, got %v", ranks, got)
+	}
+
+	if _, err := runDSG([]*Keyshare{shares[0], shares[2]}, 2, nil); err != nil {
+		t.Errorf("DSG with parties 0 and 2 failed: %v", err)
+	}
+	if _, err := runDSG(shares[1:], 2, nil); !errors.Is(err, ErrSignInvalidQuorum) {
+		t.Errorf("expected ErrSignInvalidQuorum for parties 1 and 2, got %v", err)
+	}
+}
+
 func TestKeygenSessionErrorHandling(t *testing.T) {
-	session := NewKeygenSession(3, 2, 0, nil)
+	session, err := NewKeygenSession(3, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to create keygen session: %v", err)
+	}
 	defer session.Free()
 
 	// Create first message
@@ -657,6 +1261,39 @@ func TestSignSessionErrorHandling(t *testing.T) {
 	}
 }
 
+func TestSignSessionDerivationPath(t *testing.T) {
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	if _, err := NewSignSession(shares[0], "m/44'/60", nil); !errors.Is(err, ErrHardenedPath) {
+		t.Errorf("expected ErrHardenedPath, got %v", err)
+	}
+	if _, err := NewSignSessionOTVariant(shares[0], "44/60", nil); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath, got %v", err)
+	}
+	if _, err := NewSignSessionWithPath(shares[0], DerivationPath{HardenedOffset}, nil); !errors.Is(err, ErrHardenedPath) {
+		t.Errorf("expected ErrHardenedPath, got %v", err)
+	}
+
+	session, err := NewSignSessionWithPath(shares[0], BIP44(60, 0, 0, 0), nil)
+	if err != nil {
+		t.Fatalf("failed to create sign session: %v", err)
+	}
+	session.Free()
+	otSession, err := NewSignSessionOTVariantWithPath(shares[0], BIP44(60, 0, 0, 0), nil)
+	if err != nil {
+		t.Fatalf("failed to create OT variant sign session: %v", err)
+	}
+	otSession.Free()
+}
+
 func TestPublicKeyFormat(t *testing.T) {
 	shares, err := runDKG(2, 2)
 	if err != nil {
@@ -679,6 +1316,110 @@ func TestPublicKeyFormat(t *testing.T) {
 	}
 }
 
+func TestKeysharePublicInfo(t *testing.T) {
+	shares, err := runDKG(3, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	first, err := shares[0].PublicInfo()
+	if err != nil {
+		t.Fatalf("failed to get public info: %v", err)
+	}
+	if len(first.RootChainCode) != 32 || len(first.Fingerprint) != 32 {
+		t.Errorf("unexpected chain code or fingerprint length")
+	}
+	if first.TotalParties != 3 || first.Threshold != 2 || !bytes.Equal(first.Ranks, []uint8{0, 0, 0}) {
+		t.Errorf("unexpected parameters: %+v", first)
+	}
+	if len(first.PublicShares) != 3 {
+		t.Fatalf("expected 3 public shares, got %d", len(first.PublicShares))
+	}
+
+	for i, share := range shares {
+		info, err := share.PublicInfo()
+		if err != nil {
+			t.Fatalf("failed to get public info: %v", err)
+		}
+		if info.PartyID != uint8(i) {
+			t.Errorf("expected party ID %d, got %d", i, info.PartyID)
+		}
+		if !bytes.Equal(info.PublicKey, first.PublicKey) || !bytes.Equal(info.Fingerprint, first.Fingerprint) {
+			t.Errorf("party %d has a different key", i)
+		}
+		for j := range info.PublicShares {
+			if !bytes.Equal(info.PublicShares[j], first.PublicShares[j]) {
+				t.Errorf("party %d has a different public share for party %d", i, j)
+			}
+		}
+	}
+}
+
+func TestKeyshareDerivePublicKey(t *testing.T) {
+	shares, err := runDKG(3, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	root, rootChainCode, err := shares[0].DerivePublicKey("m")
+	if err != nil {
+		t.Fatalf("failed to derive root key: %v", err)
+	}
+	pk, _ := shares[0].PublicKey()
+	chainCode, _ := shares[0].RootChainCode()
+	if !bytes.Equal(root, pk) || !bytes.Equal(rootChainCode, chainCode) {
+		t.Error("root key does not match the keyshare")
+	}
+
+	child, childChainCode, err := shares[0].DerivePublicKey("m/0/1")
+	if err != nil {
+		t.Fatalf("failed to derive child key: %v", err)
+	}
+	if len(child) != 33 || bytes.Equal(child, pk) || bytes.Equal(childChainCode, chainCode) {
+		t.Error("unexpected child key")
+	}
+	for i, share := range shares[1:] {
+		other, otherChainCode, err := share.DerivePublicKey("m/0/1")
+		if err != nil {
+			t.Fatalf("failed to derive child key: %v", err)
+		}
+		if !bytes.Equal(other, child) || !bytes.Equal(otherChainCode, childChainCode) {
+			t.Errorf("party %d derived a different child key", i+1)
+		}
+	}
+	if _, _, err := shares[0].DerivePublicKey("m/0'/1"); err == nil {
+		t.Error("expected an error for a hardened path")
+	}
+
+	for _, tc := range []struct {
+		path    string
+		network Network
+		prefix  string
+	}{
+		{"m", Mainnet, "xpub"},
+		{"m/0/1", Mainnet, "xpub"},
+		{"m/0/1", Testnet, "tpub"},
+	} {
+		xpub, err := shares[0].ExtendedPublicKey(tc.path, tc.network)
+		if err != nil {
+			t.Fatalf("failed to get extended key for %s: %v", tc.path, err)
+		}
+		if len(xpub) != 111 || xpub[:4] != tc.prefix {
+			t.Errorf("unexpected extended key for %s: %s", tc.path, xpub)
+		}
+	}
+}
+
 func TestMessageRouting(t *testing.T) {
 	shares, err := runDKG(3, 2)
 	if err != nil {
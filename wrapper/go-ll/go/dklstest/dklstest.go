@@ -0,0 +1,298 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+// Package dklstest runs every party of a DKLs23 protocol inside one
+// process, connected by an in-memory Network. It is meant for tests and
+// examples of code built on the dkls package.
+//
+// All helpers take an optional seed. When it is set, the seed of every
+// party and round is derived from it and the run is deterministic.
+package dklstest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+)
+
+// partySeed derives the seed of one party from the seed of the run, or
+// returns nil if the run uses random seeds
+func partySeed(seed []byte, label string, party uint8) []byte {
+	if len(seed) == 0 {
+		return nil
+	}
+	h := sha256.New()
+	h.Write(seed)
+	h.Write([]byte(label))
+	h.Write([]byte{party})
+	return h.Sum(nil)
+}
+
+// runParties calls run for every party concurrently and returns the
+// first error. The context passed to run is cancelled as soon as one
+// party fails, so that the others stop waiting for its messages.
+func runParties(ctx context.Context, ids []uint8, run func(ctx context.Context, i int, id uint8) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id uint8) {
+			defer wg.Done()
+			if err := run(ctx, i, id); err != nil {
+				errs[i] = fmt.Errorf("party %d: %w", id, err)
+				cancel()
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	// Report the failure that cancelled the others rather than their
+	// context errors
+	var first error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func freeAll(shares []*dkls.Keyshare) {
+	for _, share := range shares {
+		if share != nil {
+			share.Free()
+		}
+	}
+}
+
+// RunKeygen runs a keygen with n parties and threshold t and returns the
+// keyshares ordered by party ID
+func RunKeygen(ctx context.Context, n, t uint8, seed []byte) ([]*dkls.Keyshare, error) {
+	net := NewNetwork(int(n))
+	ids := make([]uint8, n)
+	for i := range ids {
+		ids[i] = uint8(i)
+	}
+	shares := make([]*dkls.Keyshare, n)
+	err := runParties(ctx, ids, func(ctx context.Context, i int, id uint8) error {
+		var err error
+		shares[i], err = dkls.RunKeygen(ctx, net.Transport(id), "keygen", n, t, id, partySeed(seed, "keygen", id))
+		return err
+	})
+	if err != nil {
+		freeAll(shares)
+		return nil, err
+	}
+	return shares, nil
+}
+
+// RotateKeys runs a key rotation with all the keyshares of a key and
+// returns the new keyshares ordered like shares. The old keyshares are
+// not freed.
+func RotateKeys(ctx context.Context, shares []*dkls.Keyshare, seed []byte) ([]*dkls.Keyshare, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no keyshares")
+	}
+	net := NewNetwork(len(shares))
+	ids := make([]uint8, len(shares))
+	for i, share := range shares {
+		ids[i] = share.PartyID()
+	}
+	rotated := make([]*dkls.Keyshare, len(shares))
+	err := runParties(ctx, ids, func(ctx context.Context, i int, id uint8) error {
+		session, err := dkls.InitKeyRotation(shares[i], partySeed(seed, "rotate", id))
+		if err != nil {
+			return err
+		}
+		rotated[i], err = dkls.RunKeygenSession(ctx, net.Transport(id), "rotate", session, uint8(len(shares)), partySeed(seed, "rotate-rounds", id))
+		return err
+	})
+	if err != nil {
+		freeAll(rotated)
+		return nil, err
+	}
+	return rotated, nil
+}
+
+// RecoverKeys recovers lost keyshares. shares is indexed by party ID and
+// holds nil for every party that lost its keyshare. It returns a new
+// keyshare for every party, ordered by party ID. The old keyshares are
+// not freed.
+func RecoverKeys(ctx context.Context, shares []*dkls.Keyshare, seed []byte) ([]*dkls.Keyshare, error) {
+	var known *dkls.Keyshare
+	lost := make([]byte, 0)
+	ids := make([]uint8, len(shares))
+	for i, share := range shares {
+		ids[i] = uint8(i)
+		if share == nil {
+			lost = append(lost, uint8(i))
+		} else if known == nil {
+			known = share
+		}
+	}
+	if known == nil {
+		return nil, errors.New("no keyshares left")
+	}
+	pk, err := known.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	ranks, err := known.Ranks()
+	if err != nil {
+		return nil, err
+	}
+	n, t := uint8(len(shares)), known.Threshold()
+
+	net := NewNetwork(len(shares))
+	recovered := make([]*dkls.Keyshare, len(shares))
+	err = runParties(ctx, ids, func(ctx context.Context, i int, id uint8) error {
+		var session *dkls.KeygenSession
+		var err error
+		if shares[i] == nil {
+			session, err = dkls.InitLostShareRecoveryWithRanks(ranks, t, id, pk, lost, partySeed(seed, "recover", id))
+		} else {
+			session, err = dkls.InitKeyRecovery(shares[i], lost, partySeed(seed, "recover", id))
+		}
+		if err != nil {
+			return err
+		}
+		recovered[i], err = dkls.RunKeygenSession(ctx, net.Transport(id), "recover", session, n, partySeed(seed, "recover-rounds", id))
+		return err
+	})
+	if err != nil {
+		freeAll(recovered)
+		return nil, err
+	}
+	return recovered, nil
+}
+
+// signers returns the party IDs of shares and a network large enough
+// for them
+func signers(shares []*dkls.Keyshare) ([]uint8, *Network) {
+	size := 0
+	ids := make([]uint8, len(shares))
+	for i, share := range shares {
+		ids[i] = share.PartyID()
+		if int(ids[i]) >= size {
+			size = int(ids[i]) + 1
+		}
+	}
+	return ids, NewNetwork(size)
+}
+
+type signFunc func(ctx context.Context, transport dkls.Transport, sessionID string, keyshare *dkls.Keyshare, chainPath string, messageHash []byte, seed []byte) (*dkls.Signature, error)
+
+func sign(ctx context.Context, run signFunc, shares []*dkls.Keyshare, chainPath string, messageHash []byte, seed []byte) (*dkls.Signature, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no keyshares")
+	}
+	ids, net := signers(shares)
+	sigs := make([]*dkls.Signature, len(shares))
+	err := runParties(ctx, ids, func(ctx context.Context, i int, id uint8) error {
+		var err error
+		sigs[i], err = run(ctx, net.Transport(id), "sign", shares[i], chainPath, messageHash, partySeed(seed, "sign", id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sameSignature(sigs)
+}
+
+func sameSignature(sigs []*dkls.Signature) (*dkls.Signature, error) {
+	for _, sig := range sigs[1:] {
+		if !bytes.Equal(sig.Bytes(), sigs[0].Bytes()) {
+			return nil, errors.New("parties computed different signatures")
+		}
+	}
+	return sigs[0], nil
+}
+
+// Sign signs the 32-byte message hash with SignSession and returns the
+// signature. shares must hold exactly threshold keyshares of one key.
+func Sign(ctx context.Context, shares []*dkls.Keyshare, chainPath string, messageHash []byte, seed []byte) (*dkls.Signature, error) {
+	return sign(ctx, dkls.RunSign, shares, chainPath, messageHash, seed)
+}
+
+// SignOTVariant signs the 32-byte message hash with SignSessionOTVariant
+// and returns the signature
+func SignOTVariant(ctx context.Context, shares []*dkls.Keyshare, chainPath string, messageHash []byte, seed []byte) (*dkls.Signature, error) {
+	return sign(ctx, dkls.RunSignOTVariant, shares, chainPath, messageHash, seed)
+}
+
+// Presign runs the interactive rounds of the sign protocol and returns
+// the presignature of every party, ordered like shares. shares must hold
+// exactly threshold keyshares of one key.
+func Presign(ctx context.Context, shares []*dkls.Keyshare, chainPath string, seed []byte) ([]*dkls.PreSignature, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no keyshares")
+	}
+	ids, net := signers(shares)
+	pres := make([]*dkls.PreSignature, len(shares))
+	err := runParties(ctx, ids, func(ctx context.Context, i int, id uint8) error {
+		var err error
+		pres[i], err = dkls.RunPresign(ctx, net.Transport(id), "presign", shares[i], chainPath, partySeed(seed, "presign", id))
+		return err
+	})
+	if err != nil {
+		for _, pre := range pres {
+			if pre != nil {
+				pre.Free()
+			}
+		}
+		return nil, err
+	}
+	return pres, nil
+}
+
+// SignPresigned signs the 32-byte message hash with the presignatures of
+// one Presign and returns the signature. The presignatures are consumed.
+func SignPresigned(pres []*dkls.PreSignature, messageHash []byte) (*dkls.Signature, error) {
+	if len(pres) == 0 {
+		return nil, errors.New("no presignatures")
+	}
+	partials := make([]*dkls.PartialSignature, len(pres))
+	msgs := make([]*dkls.Message, len(pres))
+	defer func() {
+		for _, partial := range partials {
+			if partial != nil {
+				partial.Free()
+			}
+		}
+	}()
+	for i, pre := range pres {
+		id := pre.PartyID()
+		var err error
+		partials[i], msgs[i], err = pre.Sign(messageHash)
+		if err != nil {
+			return nil, fmt.Errorf("party %d: %w", id, err)
+		}
+	}
+
+	sigs := make([]*dkls.Signature, len(pres))
+	for i, partial := range partials {
+		others := make([]*dkls.Message, 0, len(msgs)-1)
+		for j, msg := range msgs {
+			if j != i {
+				others = append(others, msg)
+			}
+		}
+		var err error
+		sigs[i], err = partial.Combine(others)
+		if err != nil {
+			return nil, fmt.Errorf("party %d: %w", msgs[i].FromID, err)
+		}
+	}
+	return sameSignature(sigs)
+}
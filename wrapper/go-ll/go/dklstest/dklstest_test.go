@@ -0,0 +1,179 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dklstest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+)
+
+func TestNetworkRouting(t *testing.T) {
+	ctx := context.Background()
+	net := NewNetwork(3)
+	to := uint8(2)
+
+	if err := net.Transport(0).Send(ctx, "s", &dkls.Message{FromID: 0, Payload: []byte("b")}); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if err := net.Transport(1).Send(ctx, "s", &dkls.Message{FromID: 1, ToID: &to, Payload: []byte("p")}); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	for _, want := range []string{"b", "p"} {
+		msg, err := net.Transport(2).Receive(ctx, "s")
+		if err != nil {
+			t.Fatalf("failed to receive: %v", err)
+		}
+		if string(msg.Payload) != want {
+			t.Errorf("expected %q, got %q", want, msg.Payload)
+		}
+	}
+
+	msg, err := net.Transport(1).Receive(ctx, "s")
+	if err != nil || string(msg.Payload) != "b" {
+		t.Errorf("expected broadcast at party 1, got %v, %v", msg, err)
+	}
+
+	// Nothing is left for party 0 and nothing leaks into another session
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := net.Transport(0).Receive(ctx, "s"); err == nil {
+		t.Error("expected party 0 to receive nothing")
+	}
+	if _, err := net.Transport(2).Receive(ctx, "other"); err == nil {
+		t.Error("expected no messages in another session")
+	}
+}
+
+func publicKeys(t *testing.T, shares []*dkls.Keyshare) []byte {
+	t.Helper()
+	pk, err := shares[0].PublicKey()
+	if err != nil {
+		t.Fatalf("failed to get public key: %v", err)
+	}
+	for i, share := range shares[1:] {
+		other, err := share.PublicKey()
+		if err != nil {
+			t.Fatalf("failed to get public key: %v", err)
+		}
+		if !bytes.Equal(pk, other) {
+			t.Fatalf("party %d has a different public key", i+1)
+		}
+	}
+	return pk
+}
+
+func TestSimulator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	seed := bytes.Repeat([]byte{42}, 32)
+	hash := bytes.Repeat([]byte{1}, 32)
+
+	shares, err := RunKeygen(ctx, 3, 2, seed)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	defer freeAll(shares)
+	pk := publicKeys(t, shares)
+
+	again, err := RunKeygen(ctx, 3, 2, seed)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	defer freeAll(again)
+	if !bytes.Equal(pk, publicKeys(t, again)) {
+		t.Error("keygen with the same seed produced a different key")
+	}
+
+	sig, err := Sign(ctx, shares[:2], "m", hash, seed)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	sig2, err := Sign(ctx, shares[:2], "m", hash, seed)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !bytes.Equal(sig.Bytes(), sig2.Bytes()) {
+		t.Error("signing with the same seed produced a different signature")
+	}
+	if err := dkls.VerifySignature(pk, hash, sig); err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+	if _, err := SignOTVariant(ctx, shares[1:], "m", hash, nil); err != nil {
+		t.Fatalf("OT variant sign failed: %v", err)
+	}
+
+	pres, err := Presign(ctx, shares[:2], "m", nil)
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+	sig, err = SignPresigned(pres, hash)
+	if err != nil {
+		t.Fatalf("sign with presignatures failed: %v", err)
+	}
+	if err := dkls.VerifySignature(pk, hash, sig); err != nil {
+		t.Errorf("invalid presigned signature: %v", err)
+	}
+
+	// Presignatures stored as bytes are restored and signed once
+	pres, err = Presign(ctx, []*dkls.Keyshare{shares[0], shares[2]}, "m", nil)
+	if err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+	stored := make([][]byte, len(pres))
+	for i, pre := range pres {
+		if stored[i], err = pre.ToBytes(); err != nil {
+			t.Fatalf("failed to serialize presignature: %v", err)
+		}
+		pre.Free()
+	}
+	restore := func() []*dkls.PreSignature {
+		t.Helper()
+		restored := make([]*dkls.PreSignature, len(stored))
+		for i, data := range stored {
+			if restored[i], err = dkls.NewPreSignatureFromBytes(data); err != nil {
+				t.Fatalf("failed to restore presignature: %v", err)
+			}
+		}
+		return restored
+	}
+	sig, err = SignPresigned(restore(), hash)
+	if err != nil {
+		t.Fatalf("sign with restored presignatures failed: %v", err)
+	}
+	if err := dkls.VerifySignature(pk, hash, sig); err != nil {
+		t.Errorf("invalid restored signature: %v", err)
+	}
+	for i, data := range stored {
+		if _, err := dkls.NewPreSignatureFromBytes(data); !errors.Is(err, dkls.ErrPresignatureUsed) {
+			t.Errorf("party %d: expected ErrPresignatureUsed, got %v", i, err)
+		}
+	}
+
+	rotated, err := RotateKeys(ctx, shares, nil)
+	if err != nil {
+		t.Fatalf("rotation failed: %v", err)
+	}
+	defer freeAll(rotated)
+	if !bytes.Equal(pk, publicKeys(t, rotated)) {
+		t.Error("rotation changed the public key")
+	}
+
+	recovered, err := RecoverKeys(ctx, []*dkls.Keyshare{nil, rotated[1], rotated[2]}, nil)
+	if err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+	defer freeAll(recovered)
+	if !bytes.Equal(pk, publicKeys(t, recovered)) {
+		t.Error("recovery changed the public key")
+	}
+	if _, err := Sign(ctx, []*dkls.Keyshare{recovered[0], recovered[2]}, "m", hash, nil); err != nil {
+		t.Fatalf("sign with recovered share failed: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dklstest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+)
+
+// Network is an in-process network connecting parties 0..n-1. Messages
+// are queued without limit, so Send never blocks.
+type Network struct {
+	n int
+
+	mu        sync.Mutex
+	mailboxes map[mailboxKey]*mailbox
+}
+
+type mailboxKey struct {
+	sessionID string
+	party     uint8
+}
+
+type mailbox struct {
+	mu     sync.Mutex
+	queue  []*dkls.Message
+	signal chan struct{}
+}
+
+// NewNetwork creates a network of n parties
+func NewNetwork(n int) *Network {
+	return &Network{
+		n:         n,
+		mailboxes: make(map[mailboxKey]*mailbox),
+	}
+}
+
+func (net *Network) mailbox(sessionID string, party uint8) *mailbox {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	key := mailboxKey{sessionID, party}
+	box, ok := net.mailboxes[key]
+	if !ok {
+		box = &mailbox{signal: make(chan struct{}, 1)}
+		net.mailboxes[key] = box
+	}
+	return box
+}
+
+// Transport returns the endpoint of party id
+func (net *Network) Transport(id uint8) dkls.Transport {
+	return &transport{net: net, self: id}
+}
+
+type transport struct {
+	net  *Network
+	self uint8
+}
+
+func (t *transport) Send(ctx context.Context, sessionID string, msg *dkls.Message) error {
+	if msg == nil {
+		return errors.New("nil message")
+	}
+	if msg.ToID != nil && int(*msg.ToID) >= t.net.n {
+		return errors.New("unknown recipient")
+	}
+	for i := 0; i < t.net.n; i++ {
+		id := uint8(i)
+		if id == t.self || (msg.ToID != nil && *msg.ToID != id) {
+			continue
+		}
+		box := t.net.mailbox(sessionID, id)
+		box.mu.Lock()
+		box.queue = append(box.queue, msg)
+		box.mu.Unlock()
+		select {
+		case box.signal <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (t *transport) Receive(ctx context.Context, sessionID string) (*dkls.Message, error) {
+	box := t.net.mailbox(sessionID, t.self)
+	for {
+		box.mu.Lock()
+		if len(box.queue) > 0 {
+			msg := box.queue[0]
+			box.queue = box.queue[1:]
+			box.mu.Unlock()
+			return msg, nil
+		}
+		box.mu.Unlock()
+
+		select {
+		case <-box.signal:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// WireVersion is the version of the Envelope encoding
+const WireVersion = 1
+
+// Protocol is the kind of protocol a message belongs to
+type Protocol uint8
+
+const (
+	ProtocolKeygen Protocol = iota + 1
+	ProtocolKeyRotation
+	ProtocolKeyRecovery
+	ProtocolSign
+	ProtocolSignOT
+)
+
+// String returns the name of the protocol
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolKeygen:
+		return "keygen"
+	case ProtocolKeyRotation:
+		return "key rotation"
+	case ProtocolKeyRecovery:
+		return "key recovery"
+	case ProtocolSign:
+		return "sign"
+	case ProtocolSignOT:
+		return "sign OT variant"
+	}
+	return fmt.Sprintf("Protocol(%d)", uint8(p))
+}
+
+var (
+	// ErrInvalidEnvelope is returned by Envelope.UnmarshalBinary for
+	// malformed data
+	ErrInvalidEnvelope = errors.New("invalid message envelope")
+	// ErrEnvelopeMismatch is returned by HandleMessages and Combine of a
+	// bound session for a message without a header, or with the header
+	// of another session, protocol or round
+	ErrEnvelopeMismatch = errors.New("message envelope does not match the session")
+)
+
+// Header identifies the session and round of a message. Sessions bound
+// with Bind set it on the messages they create.
+type Header struct {
+	// SessionID is at most 255 bytes
+	SessionID []byte
+	Protocol  Protocol
+	// Round is the protocol round, starting at 1
+	Round uint8
+}
+
+// Envelope is a message with its header, as carried by a relay
+type Envelope struct {
+	// Version is the wire version, WireVersion
+	Version uint8
+	Header
+	FromID  uint8
+	ToID    *uint8 // nil means broadcast
+	Payload []byte
+}
+
+// NewEnvelope wraps a message created by a bound session
+func NewEnvelope(msg *Message) (*Envelope, error) {
+	if msg == nil || msg.Header == nil {
+		return nil, errors.New("message has no header")
+	}
+	return &Envelope{
+		Version: WireVersion,
+		Header:  *msg.Header,
+		FromID:  msg.FromID,
+		ToID:    msg.ToID,
+		Payload: msg.Payload,
+	}, nil
+}
+
+// Message returns the message of the envelope, with its header set
+func (e *Envelope) Message() *Message {
+	header := e.Header
+	return &Message{FromID: e.FromID, ToID: e.ToID, Payload: e.Payload, Header: &header}
+}
+
+// MarshalBinary encodes the envelope as
+//
+//	version | protocol | round | from ID | to ID (255 for broadcast) |
+//	session ID length (1) | session ID | payload length (uvarint) | payload
+func (e *Envelope) MarshalBinary() ([]byte, error) {
+	if e.Version != WireVersion {
+		return nil, fmt.Errorf("unsupported wire version %d", e.Version)
+	}
+	if len(e.SessionID) > 255 {
+		return nil, errors.New("session ID longer than 255 bytes")
+	}
+	to := uint8(255)
+	if e.ToID != nil {
+		if *e.ToID == 255 {
+			return nil, errors.New("invalid recipient 255")
+		}
+		to = *e.ToID
+	}
+	out := make([]byte, 0, 6+len(e.SessionID)+binary.MaxVarintLen64+len(e.Payload))
+	out = append(out, e.Version, byte(e.Protocol), e.Round, e.FromID, to, byte(len(e.SessionID)))
+	out = append(out, e.SessionID...)
+	var n [binary.MaxVarintLen64]byte
+	out = append(out, n[:binary.PutUvarint(n[:], uint64(len(e.Payload)))]...)
+	return append(out, e.Payload...), nil
+}
+
+// UnmarshalBinary decodes an envelope encoded by MarshalBinary. Data of
+// another wire version is rejected.
+func (e *Envelope) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return ErrInvalidEnvelope
+	}
+	if data[0] != WireVersion {
+		return fmt.Errorf("%w: unsupported wire version %d", ErrInvalidEnvelope, data[0])
+	}
+	idLen := int(data[5])
+	rest := data[6:]
+	if len(rest) < idLen {
+		return ErrInvalidEnvelope
+	}
+	sessionID, rest := rest[:idLen], rest[idLen:]
+	payloadLen, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) != payloadLen {
+		return ErrInvalidEnvelope
+	}
+
+	var to *uint8
+	if data[4] != 255 {
+		id := data[4]
+		to = &id
+	}
+	*e = Envelope{
+		Version: data[0],
+		Header: Header{
+			SessionID: append([]byte{}, sessionID...),
+			Protocol:  Protocol(data[1]),
+			Round:     data[2],
+		},
+		FromID:  data[3],
+		ToID:    to,
+		Payload: append([]byte{}, rest[n:]...),
+	}
+	return nil
+}
+
+// binding holds the header of a bound session. Round is the round of
+// the messages the session takes next; it is also the round of the
+// messages it creates before taking them.
+type binding struct {
+	Header
+}
+
+// bind checks a header passed to Bind against the protocols a session
+// can run
+func bind(h Header, protocols ...Protocol) (*binding, error) {
+	if len(h.SessionID) == 0 || len(h.SessionID) > 255 {
+		return nil, errors.New("session ID must be 1 to 255 bytes")
+	}
+	ok := false
+	for _, p := range protocols {
+		ok = ok || h.Protocol == p
+	}
+	if !ok {
+		return nil, fmt.Errorf("session can not run protocol %v", h.Protocol)
+	}
+	if h.Round == 0 {
+		h.Round = 1
+	}
+	h.SessionID = append([]byte{}, h.SessionID...)
+	return &binding{h}, nil
+}
+
+// check rejects messages that are not for the session and its current
+// round. An unbound session takes any message.
+func (b *binding) check(msgs []*Message) error {
+	if b == nil {
+		return nil
+	}
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		h := msg.Header
+		switch {
+		case h == nil:
+			return fmt.Errorf("%w: message from party %d has no header", ErrEnvelopeMismatch, msg.FromID)
+		case !bytes.Equal(h.SessionID, b.SessionID):
+			return fmt.Errorf("%w: message from party %d is for session %x", ErrEnvelopeMismatch, msg.FromID, h.SessionID)
+		case h.Protocol != b.Protocol:
+			return fmt.Errorf("%w: message from party %d is for protocol %v", ErrEnvelopeMismatch, msg.FromID, h.Protocol)
+		case h.Round != b.Round:
+			return fmt.Errorf("%w: message from party %d is for round %d, expected %d", ErrEnvelopeMismatch, msg.FromID, h.Round, b.Round)
+		}
+	}
+	return nil
+}
+
+// header returns the header of messages created in the current round,
+// or nil for an unbound session
+func (b *binding) header() *Header {
+	if b == nil {
+		return nil
+	}
+	h := b.Header
+	return &h
+}
+
+// stamp sets the header of the current round on msgs
+func (b *binding) stamp(msgs ...*Message) {
+	for _, msg := range msgs {
+		if msg != nil {
+			msg.Header = b.header()
+		}
+	}
+}
+
+// next moves the session to the following round
+func (b *binding) next() {
+	if b != nil {
+		b.Round++
+	}
+}
+
+// Bind binds the session to the session ID and protocol of h, one of
+// keygen, key rotation or key recovery. Its messages then carry a
+// header, and HandleMessages rejects messages of any other session,
+// protocol or round before they reach the library. h.Round is the round
+// of the messages the session takes next: 1, or 0, for a new session,
+// and the round it stopped at for a session restored from bytes.
+func (s *KeygenSession) Bind(h Header) error {
+	b, err := bind(h, ProtocolKeygen, ProtocolKeyRotation, ProtocolKeyRecovery)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handle == nil {
+		return ErrHandleFreed
+	}
+	s.env = b
+	return nil
+}
+
+// header returns the header for messages of the current round, such as
+// the commitment broadcast by RunKeygenSession
+func (s *KeygenSession) header() *Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.env.header()
+}
+
+// Bind binds the session to the session ID of h, with protocol sign.
+// See KeygenSession.Bind. LastMessage and Combine use the round after
+// the last HandleMessages.
+func (s *SignSession) Bind(h Header) error {
+	b, err := bind(h, ProtocolSign)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handle == nil {
+		return ErrHandleFreed
+	}
+	s.env = b
+	return nil
+}
+
+// Bind binds the session to the session ID of h, with protocol sign OT
+// variant. See SignSession.Bind.
+func (s *SignSessionOTVariant) Bind(h Header) error {
+	b, err := bind(h, ProtocolSignOT)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handle == nil {
+		return ErrHandleFreed
+	}
+	s.env = b
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeBinary(t *testing.T) {
+	to := uint8(2)
+	env := &Envelope{
+		Version: WireVersion,
+		Header:  Header{SessionID: []byte("sid"), Protocol: ProtocolSign, Round: 3},
+		FromID:  1,
+		ToID:    &to,
+		Payload: []byte{0xaa, 0xbb},
+	}
+	data, err := env.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if got := hex.EncodeToString(data); got != "01040301020373696402aabb" {
+		t.Errorf("unexpected encoding %s", got)
+	}
+
+	var decoded Envelope
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if decoded.Version != WireVersion || !bytes.Equal(decoded.SessionID, env.SessionID) || decoded.Protocol != ProtocolSign ||
+		decoded.Round != 3 || decoded.FromID != 1 || decoded.ToID == nil || *decoded.ToID != 2 || !bytes.Equal(decoded.Payload, env.Payload) {
+		t.Errorf("unexpected envelope %+v", decoded)
+	}
+
+	env.ToID = nil
+	data, _ = env.MarshalBinary()
+	if err := decoded.UnmarshalBinary(data); err != nil || decoded.ToID != nil {
+		t.Errorf("expected a broadcast envelope, got %+v, %v", decoded, err)
+	}
+
+	newer := append([]byte{}, data...)
+	newer[0] = WireVersion + 1
+	if err := decoded.UnmarshalBinary(newer); !errors.Is(err, ErrInvalidEnvelope) {
+		t.Errorf("expected ErrInvalidEnvelope for another wire version, got %v", err)
+	}
+	for _, bad := range [][]byte{data[:5], data[:len(data)-1], append(data, 0)} {
+		if err := decoded.UnmarshalBinary(bad); !errors.Is(err, ErrInvalidEnvelope) {
+			t.Errorf("expected ErrInvalidEnvelope for %x, got %v", bad, err)
+		}
+	}
+}
+
+func TestBinding(t *testing.T) {
+	if _, err := bind(Header{SessionID: []byte("sid"), Protocol: ProtocolSign}, ProtocolKeygen); err == nil {
+		t.Error("expected an error for a protocol the session can not run")
+	}
+	if _, err := bind(Header{Protocol: ProtocolKeygen}, ProtocolKeygen); err == nil {
+		t.Error("expected an error for an empty session ID")
+	}
+
+	b, err := bind(Header{SessionID: []byte("sid"), Protocol: ProtocolKeygen}, ProtocolKeygen)
+	if err != nil {
+		t.Fatalf("failed to bind: %v", err)
+	}
+	msg := &Message{FromID: 1}
+	b.stamp(msg)
+	if msg.Header == nil || msg.Header.Round != 1 {
+		t.Fatalf("unexpected header %+v", msg.Header)
+	}
+	if err := b.check([]*Message{msg}); err != nil {
+		t.Errorf("expected the message to pass: %v", err)
+	}
+
+	other := func(h Header) *Message { return &Message{FromID: 1, Header: &h} }
+	for name, m := range map[string]*Message{
+		"no header":     {FromID: 1},
+		"other session": other(Header{SessionID: []byte("other"), Protocol: ProtocolKeygen, Round: 1}),
+		"other proto":   other(Header{SessionID: []byte("sid"), Protocol: ProtocolKeyRotation, Round: 1}),
+		"other round":   other(Header{SessionID: []byte("sid"), Protocol: ProtocolKeygen, Round: 2}),
+	} {
+		if err := b.check([]*Message{msg, m}); !errors.Is(err, ErrEnvelopeMismatch) {
+			t.Errorf("%s: expected ErrEnvelopeMismatch, got %v", name, err)
+		}
+	}
+
+	b.next()
+	if err := b.check([]*Message{msg}); !errors.Is(err, ErrEnvelopeMismatch) {
+		t.Errorf("expected a message of the previous round to be rejected, got %v", err)
+	}
+
+	var unbound *binding
+	if err := unbound.check([]*Message{{FromID: 1}}); err != nil {
+		t.Errorf("expected an unbound session to take any message: %v", err)
+	}
+}
+
+// relay passes messages through their binary envelope
+func relay(t *testing.T, msgs []*Message) []*Message {
+	out := make([]*Message, len(msgs))
+	for i, msg := range msgs {
+		env, err := NewEnvelope(msg)
+		if err != nil {
+			t.Fatalf("failed to wrap message: %v", err)
+		}
+		data, err := env.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal envelope: %v", err)
+		}
+		var decoded Envelope
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("failed to unmarshal envelope: %v", err)
+		}
+		out[i] = decoded.Message()
+	}
+	return out
+}
+
+func TestBoundSessions(t *testing.T) {
+	parties := make([]*KeygenSession, 2)
+	for i := range parties {
+		var err error
+		parties[i], err = NewKeygenSession(2, 2, uint8(i), nil)
+		if err != nil {
+			t.Fatalf("failed to create keygen session: %v", err)
+		}
+	}
+	bound := false
+	shares, err := runKeygenParties(parties, func(parties []*KeygenSession) error {
+		if bound {
+			return nil
+		}
+		bound = true
+		for _, party := range parties {
+			if err := party.Bind(Header{SessionID: []byte("keygen"), Protocol: ProtocolKeygen}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DKG with bound sessions failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	sign := func(sessionID string) *SignSession {
+		s, err := NewSignSession(shares[0], "m", nil)
+		if err != nil {
+			t.Fatalf("failed to create sign session: %v", err)
+		}
+		if err := s.Bind(Header{SessionID: []byte(sessionID), Protocol: ProtocolSign}); err != nil {
+			t.Fatalf("failed to bind: %v", err)
+		}
+		return s
+	}
+	a, b := sign("a"), sign("b")
+	defer a.Free()
+	defer b.Free()
+	peer, err := NewSignSession(shares[1], "m", nil)
+	if err != nil {
+		t.Fatalf("failed to create sign session: %v", err)
+	}
+	defer peer.Free()
+	if err := peer.Bind(Header{SessionID: []byte("a"), Protocol: ProtocolSign}); err != nil {
+		t.Fatalf("failed to bind: %v", err)
+	}
+
+	msgA, err := a.CreateFirstMessage()
+	if err != nil {
+		t.Fatalf("failed to create first message: %v", err)
+	}
+	msgB, err := b.CreateFirstMessage()
+	if err != nil {
+		t.Fatalf("failed to create first message: %v", err)
+	}
+	if _, err := peer.CreateFirstMessage(); err != nil {
+		t.Fatalf("failed to create first message: %v", err)
+	}
+	if _, err := peer.HandleMessages(relay(t, []*Message{msgB}), nil); !errors.Is(err, ErrEnvelopeMismatch) {
+		t.Errorf("expected ErrEnvelopeMismatch for another session, got %v", err)
+	}
+	out, err := peer.HandleMessages(relay(t, []*Message{msgA}), nil)
+	if err != nil {
+		t.Fatalf("failed to handle messages of the session: %v", err)
+	}
+	if len(out) == 0 || out[0].Header == nil || out[0].Header.Round != 2 {
+		t.Errorf("expected messages of round 2, got %+v", out)
+	}
+	if _, err := peer.HandleMessages(relay(t, []*Message{msgA}), nil); !errors.Is(err, ErrEnvelopeMismatch) {
+		t.Errorf("expected ErrEnvelopeMismatch for a replayed round, got %v", err)
+	}
+}
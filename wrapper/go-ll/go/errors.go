@@ -0,0 +1,117 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidSeed is returned when a seed is neither empty nor 32 bytes
+var ErrInvalidSeed = errors.New("seed must be 32 bytes")
+
+// ErrHandleFreed is returned when a handle is used after Free or Close,
+// or after a method that consumes it, such as KeygenSession.Keyshare
+var ErrHandleFreed = errors.New("handle already freed or consumed")
+
+// Error codes reported in Error.Code. They are stable across releases.
+// The sign codes are shared by SignSession and SignSessionOTVariant.
+const (
+	CodeGeneric          int32 = 1
+	CodePanic            int32 = 10
+	CodePresignatureUsed int32 = 11
+	CodeInvalidState     int32 = 12
+
+	CodeKeygenInvalidMessage         int32 = 100
+	CodeKeygenInvalidCommitmentHash  int32 = 101
+	CodeKeygenInvalidDLogProof       int32 = 102
+	CodeKeygenInvalidPolynomialPoint int32 = 103
+	CodeKeygenNotUniqueXiValues      int32 = 104
+	CodeKeygenBigFVecMismatch        int32 = 105
+	CodeKeygenFailedFeldmanVerify    int32 = 106
+	CodeKeygenPublicKeyMismatch      int32 = 107
+	CodeKeygenBigSMismatch           int32 = 108
+	CodeKeygenPPRF                   int32 = 109
+	CodeKeygenMissingMessage         int32 = 110
+	CodeKeygenInvalidKeyRefresh      int32 = 111
+	CodeKeygenInvalidRanks           int32 = 112
+
+	CodeSignInvalidCommitment     int32 = 200
+	CodeSignInvalidDigest         int32 = 201
+	CodeSignInvalidFinalSessionID int32 = 202
+	CodeSignFailedCheck           int32 = 203
+	CodeSignK256                  int32 = 204
+	CodeSignMissingMessage        int32 = 205
+	CodeSignAbortProtocolBanParty int32 = 206
+	CodeSignRvole                 int32 = 207
+	CodeSignInvalidQuorum         int32 = 208
+)
+
+// Sentinel errors for use with errors.Is. An *Error matches the
+// sentinel with the same code, whatever its message.
+var (
+	// ErrPanic is returned when the library panicked. The handle
+	// involved may be in an inconsistent state and should be freed.
+	ErrPanic            = &Error{Code: CodePanic, Message: "panic"}
+	ErrPresignatureUsed = &Error{Code: CodePresignatureUsed, Message: "presignature already used"}
+	// ErrInvalidState is returned when a session method is called in a
+	// round where it is not allowed, such as a second CreateFirstMessage
+	ErrInvalidState = &Error{Code: CodeInvalidState, Message: "invalid state"}
+
+	ErrKeygenInvalidMessage         = &Error{Code: CodeKeygenInvalidMessage, Message: "invalid message"}
+	ErrKeygenInvalidCommitmentHash  = &Error{Code: CodeKeygenInvalidCommitmentHash, Message: "invalid commitment hash"}
+	ErrKeygenInvalidDLogProof       = &Error{Code: CodeKeygenInvalidDLogProof, Message: "invalid DLog proof"}
+	ErrKeygenInvalidPolynomialPoint = &Error{Code: CodeKeygenInvalidPolynomialPoint, Message: "invalid polynomial point"}
+	ErrKeygenNotUniqueXiValues      = &Error{Code: CodeKeygenNotUniqueXiValues, Message: "not unique x_i values"}
+	ErrKeygenBigFVecMismatch        = &Error{Code: CodeKeygenBigFVecMismatch, Message: "big F vec mismatch"}
+	ErrKeygenFailedFeldmanVerify    = &Error{Code: CodeKeygenFailedFeldmanVerify, Message: "failed Feldman verify"}
+	ErrKeygenPublicKeyMismatch      = &Error{Code: CodeKeygenPublicKeyMismatch, Message: "public key mismatch"}
+	ErrKeygenBigSMismatch           = &Error{Code: CodeKeygenBigSMismatch, Message: "big S value mismatch"}
+	ErrKeygenPPRF                   = &Error{Code: CodeKeygenPPRF, Message: "PPRF error"}
+	ErrKeygenMissingMessage         = &Error{Code: CodeKeygenMissingMessage, Message: "missing message"}
+	ErrKeygenInvalidKeyRefresh      = &Error{Code: CodeKeygenInvalidKeyRefresh, Message: "invalid key refresh"}
+	ErrKeygenInvalidRanks           = &Error{Code: CodeKeygenInvalidRanks, Message: "invalid ranks"}
+
+	ErrSignInvalidCommitment     = &Error{Code: CodeSignInvalidCommitment, Message: "invalid commitment"}
+	ErrSignInvalidDigest         = &Error{Code: CodeSignInvalidDigest, Message: "invalid digest"}
+	ErrSignInvalidFinalSessionID = &Error{Code: CodeSignInvalidFinalSessionID, Message: "invalid final_session_id"}
+	ErrSignFailedCheck           = &Error{Code: CodeSignFailedCheck, Message: "failed check"}
+	ErrSignK256                  = &Error{Code: CodeSignK256, Message: "k256 error"}
+	ErrSignMissingMessage        = &Error{Code: CodeSignMissingMessage, Message: "missing message"}
+	ErrSignAbortProtocol         = &Error{Code: CodeSignAbortProtocolBanParty, Message: "abort the protocol and ban the party"}
+	ErrSignRvole                 = &Error{Code: CodeSignRvole, Message: "invalid RVOLE"}
+	// ErrSignInvalidQuorum is returned when the ranks of the signing
+	// parties do not allow them to sign together
+	ErrSignInvalidQuorum = &Error{Code: CodeSignInvalidQuorum, Message: "signing parties do not satisfy the rank rules"}
+)
+
+// Is reports whether target is an *Error with the same code. Generic
+// errors only match themselves.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if e.Code == CodeGeneric {
+		return e == t
+	}
+	return e.Code == t.Code
+}
+
+// AbortError is returned when a party misbehaved during signing. The
+// protocol can not complete with that party; retry without it. It
+// matches ErrSignAbortProtocol with errors.Is.
+type AbortError struct {
+	BannedParty uint8
+	Err         *Error
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("%s (banned party %d)", e.Err.Message, e.BannedParty)
+}
+
+// Unwrap returns the underlying *Error
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("sign: %w", &Error{Code: CodeSignInvalidDigest, Message: "Invalid digest"})
+	if !errors.Is(err, ErrSignInvalidDigest) {
+		t.Error("expected error to match ErrSignInvalidDigest")
+	}
+	if errors.Is(err, ErrSignInvalidCommitment) {
+		t.Error("expected error not to match ErrSignInvalidCommitment")
+	}
+
+	generic := &Error{Code: CodeGeneric, Message: "empty data"}
+	if errors.Is(generic, &Error{Code: CodeGeneric, Message: "nil session"}) {
+		t.Error("expected generic errors not to match each other")
+	}
+}
+
+func TestAbortError(t *testing.T) {
+	var err error = &AbortError{
+		BannedParty: 2,
+		Err:         &Error{Code: CodeSignAbortProtocolBanParty, Message: "Abort the protocol and ban the party 2"},
+	}
+	err = fmt.Errorf("round 3: %w", err)
+
+	var abort *AbortError
+	if !errors.As(err, &abort) {
+		t.Fatal("expected errors.As to find the AbortError")
+	}
+	if abort.BannedParty != 2 {
+		t.Errorf("expected banned party 2, got %d", abort.BannedParty)
+	}
+	if !errors.Is(err, ErrSignAbortProtocol) {
+		t.Error("expected error to match ErrSignAbortProtocol")
+	}
+}
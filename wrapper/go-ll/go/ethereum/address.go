@@ -0,0 +1,95 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+// Package ethereum derives Ethereum addresses from a keyshare and signs
+// transactions with the distributed sign protocol.
+package ethereum
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/secp256k1"
+)
+
+// ErrInvalidAddress is returned by ParseAddress for a malformed address
+// or one with a wrong EIP-55 checksum
+var ErrInvalidAddress = errors.New("invalid Ethereum address")
+
+// Address is a 20-byte Ethereum account address
+type Address [20]byte
+
+// Keccak256 returns the Keccak-256 hash of the concatenated data
+func Keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, b := range data {
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
+
+// PubkeyToAddress returns the address of a 33- or 65-byte SEC1 public
+// key
+func PubkeyToAddress(pubKey []byte) (Address, error) {
+	key, err := secp256k1.ParsePublicKey(pubKey)
+	if err != nil {
+		return Address{}, err
+	}
+	var addr Address
+	copy(addr[:], Keccak256(key.SerializeUncompressed()[1:])[12:])
+	return addr, nil
+}
+
+// DeriveAddress returns the address of the child key at a non-hardened
+// path, e.g. "m/44/60/0/0/0"
+func DeriveAddress(keyshare *dkls.Keyshare, path string) (Address, error) {
+	pubKey, _, err := keyshare.DerivePublicKey(path)
+	if err != nil {
+		return Address{}, err
+	}
+	return PubkeyToAddress(pubKey)
+}
+
+// ParseAddress parses a hex address with or without the 0x prefix. A
+// mixed case address must have a valid EIP-55 checksum.
+func ParseAddress(s string) (Address, error) {
+	hexPart := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	var addr Address
+	if len(hexPart) != 40 {
+		return addr, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	if _, err := hex.Decode(addr[:], []byte(hexPart)); err != nil {
+		return addr, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+	if hexPart != strings.ToLower(hexPart) && hexPart != strings.ToUpper(hexPart) && addr.Hex()[2:] != hexPart {
+		return addr, fmt.Errorf("%w: bad checksum %q", ErrInvalidAddress, s)
+	}
+	return addr, nil
+}
+
+// Hex returns the EIP-55 checksummed address with the 0x prefix
+func (a Address) Hex() string {
+	lower := hex.EncodeToString(a[:])
+	hash := Keccak256([]byte(lower))
+	out := []byte("0x" + lower)
+	for i := 0; i < len(lower); i++ {
+		nibble := hash[i/2] >> 4
+		if i%2 == 1 {
+			nibble = hash[i/2] & 0x0f
+		}
+		if lower[i] >= 'a' && nibble >= 8 {
+			out[i+2] = lower[i] - 'a' + 'A'
+		}
+	}
+	return string(out)
+}
+
+// String returns the checksummed address
+func (a Address) String() string {
+	return a.Hex()
+}
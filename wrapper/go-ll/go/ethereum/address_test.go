@@ -0,0 +1,74 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package ethereum
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestKeccak256(t *testing.T) {
+	if got := hex.EncodeToString(Keccak256()); got != "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470" {
+		t.Errorf("unexpected hash of the empty string %s", got)
+	}
+}
+
+func TestPubkeyToAddress(t *testing.T) {
+	// The public key of private key 1 is the generator
+	compressed := mustHex(t, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	uncompressed := mustHex(t, "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+	for _, pk := range [][]byte{compressed, uncompressed} {
+		addr, err := PubkeyToAddress(pk)
+		if err != nil {
+			t.Fatalf("failed to derive address: %v", err)
+		}
+		if got := addr.Hex(); got != "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf" {
+			t.Errorf("unexpected address %s", got)
+		}
+	}
+	if _, err := PubkeyToAddress(compressed[1:]); err == nil {
+		t.Error("expected an error for a truncated key")
+	}
+}
+
+// EIP-55 test vectors
+func TestAddressChecksum(t *testing.T) {
+	for _, want := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		addr, err := ParseAddress(strings.ToLower(want))
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", want, err)
+		}
+		if addr.Hex() != want {
+			t.Errorf("expected %s, got %s", want, addr.Hex())
+		}
+		if _, err := ParseAddress(want); err != nil {
+			t.Errorf("checksummed address rejected: %v", err)
+		}
+		if _, err := ParseAddress(strings.ToUpper(want[2:])); err != nil {
+			t.Errorf("upper case address rejected: %v", err)
+		}
+	}
+
+	for _, bad := range []string{"", "0x1234", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", "0xzaaeb6053f3e94c9b9a09f33669435e7ef1beaed"} {
+		if _, err := ParseAddress(bad); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("expected ErrInvalidAddress for %q, got %v", bad, err)
+		}
+	}
+}
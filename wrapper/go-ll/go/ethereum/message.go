@@ -0,0 +1,79 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/secp256k1"
+)
+
+// PersonalMessageHash returns the EIP-191 digest signed by personal_sign,
+// Keccak-256("\x19Ethereum Signed Message:\n" || len(message) || message)
+func PersonalMessageHash(message []byte) []byte {
+	prefix := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message))
+	return Keccak256([]byte(prefix), message)
+}
+
+// EncodeMessageSignature returns the 65-byte [R || S || V] signature with
+// V 27 or 28, as returned by personal_sign and eth_signTypedData_v4
+func EncodeMessageSignature(sig *dkls.Signature) ([]byte, error) {
+	if sig == nil || len(sig.R) != 32 || len(sig.S) != 32 {
+		return nil, errors.New("invalid signature")
+	}
+	if sig.RecoveryID > 1 {
+		return nil, errors.New("recovery ID can not be encoded in a message signature")
+	}
+	out := sig.Bytes()
+	out[64] += 27
+	return out, nil
+}
+
+// RecoverAddress returns the address that made a 65-byte [R || S || V]
+// signature of hash. V may be 0, 1, 27 or 28.
+func RecoverAddress(hash, signature []byte) (Address, error) {
+	if len(signature) != 65 {
+		return Address{}, errors.New("signature must be 65 bytes")
+	}
+	v := signature[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return Address{}, secp256k1.ErrInvalidSignature
+	}
+	pubKey, err := secp256k1.RecoverPublicKey(hash, &dkls.Signature{R: signature[:32], S: signature[32:64], RecoveryID: v})
+	if err != nil {
+		return Address{}, err
+	}
+	return PubkeyToAddress(pubKey)
+}
+
+// SignPersonalMessage runs the sign protocol for the EIP-191 digest of
+// message and returns the 65-byte signature, as personal_sign would
+func SignPersonalMessage(ctx context.Context, transport dkls.Transport, sessionID string, keyshare *dkls.Keyshare, path string, message []byte, seed []byte) ([]byte, error) {
+	sig, err := dkls.RunSign(ctx, transport, sessionID, keyshare, path, PersonalMessageHash(message), seed)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeMessageSignature(sig)
+}
+
+// SignTypedData runs the sign protocol for the EIP-712 digest of a
+// typed-data JSON document and returns the 65-byte signature, as
+// eth_signTypedData_v4 would
+func SignTypedData(ctx context.Context, transport dkls.Transport, sessionID string, keyshare *dkls.Keyshare, path string, typedData []byte, seed []byte) ([]byte, error) {
+	hash, err := TypedDataHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := dkls.RunSign(ctx, transport, sessionID, keyshare, path, hash, seed)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeMessageSignature(sig)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package ethereum
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/dklstest"
+)
+
+// The example of EIP-712
+const mailTypedData = `{
+  "types": {
+    "EIP712Domain": [
+      {"name": "name", "type": "string"},
+      {"name": "version", "type": "string"},
+      {"name": "chainId", "type": "uint256"},
+      {"name": "verifyingContract", "type": "address"}
+    ],
+    "Person": [
+      {"name": "name", "type": "string"},
+      {"name": "wallet", "type": "address"}
+    ],
+    "Mail": [
+      {"name": "from", "type": "Person"},
+      {"name": "to", "type": "Person"},
+      {"name": "contents", "type": "string"}
+    ]
+  },
+  "primaryType": "Mail",
+  "domain": {
+    "name": "Ether Mail",
+    "version": "1",
+    "chainId": 1,
+    "verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+  },
+  "message": {
+    "from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+    "to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+    "contents": "Hello, Bob!"
+  }
+}`
+
+func TestTypedDataHash(t *testing.T) {
+	td, err := ParseTypedData([]byte(mailTypedData))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if got := td.EncodeType("Mail"); got != "Mail(Person from,Person to,string contents)Person(string name,address wallet)" {
+		t.Errorf("unexpected type encoding %s", got)
+	}
+	domain, _ := td.HashStruct("EIP712Domain", td.Domain)
+	if got := hex.EncodeToString(domain); got != "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f" {
+		t.Errorf("unexpected domain separator %s", got)
+	}
+	hash, err := TypedDataHash([]byte(mailTypedData))
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if got := hex.EncodeToString(hash); got != "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2" {
+		t.Errorf("unexpected digest %s", got)
+	}
+
+	// The signature of the example recovers to Cow's wallet
+	sig := mustHex(t, "4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c")
+	addr, err := RecoverAddress(hash, sig)
+	if err != nil {
+		t.Fatalf("failed to recover: %v", err)
+	}
+	if addr.Hex() != "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826" {
+		t.Errorf("unexpected signer %s", addr.Hex())
+	}
+}
+
+func TestTypedDataValues(t *testing.T) {
+	td := &TypedData{Types: map[string][]TypedDataField{"S": {}}}
+	for _, tc := range []struct {
+		typ   string
+		value interface{}
+		want  string
+	}{
+		{"uint8", "255", "00000000000000000000000000000000000000000000000000000000000000ff"},
+		{"int8", "-1", "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"uint256", "0x10", "0000000000000000000000000000000000000000000000000000000000000010"},
+		{"bool", true, "0000000000000000000000000000000000000000000000000000000000000001"},
+		{"bytes4", "0x01020304", "0102030400000000000000000000000000000000000000000000000000000000"},
+		{"S", nil, "0000000000000000000000000000000000000000000000000000000000000000"},
+	} {
+		got, err := td.encodeValue(tc.typ, tc.value)
+		if err != nil {
+			t.Errorf("%s %v: %v", tc.typ, tc.value, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tc.want {
+			t.Errorf("%s %v: got %x", tc.typ, tc.value, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		typ   string
+		value interface{}
+	}{
+		{"uint8", "256"},
+		{"int8", "128"},
+		{"uint256", "-1"},
+		{"bytes2", "0x010203"},
+		{"address", "0x1234"},
+		{"uint7", "1"},
+		{"float", "1"},
+		{"string[]", "a"},
+	} {
+		if _, err := td.encodeValue(tc.typ, tc.value); err == nil {
+			t.Errorf("expected an error for %s %v", tc.typ, tc.value)
+		}
+	}
+
+	if _, err := TypedDataHash([]byte(`{"types": {"EIP712Domain": []}, "primaryType": "Mail"}`)); err == nil {
+		t.Error("expected an error for an unknown primary type")
+	}
+}
+
+func TestPersonalMessageHash(t *testing.T) {
+	if got := hex.EncodeToString(PersonalMessageHash([]byte("hello"))); got != "50b2c43fd39106bafbba0da34fc430e1f91e3c96ea2acee2bc34119f92b37750" {
+		t.Errorf("unexpected digest %s", got)
+	}
+}
+
+func TestSignMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	shares, err := dklstest.RunKeygen(ctx, 2, 2, nil)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+	path := "m/0"
+	addr, err := DeriveAddress(shares[0], path)
+	if err != nil {
+		t.Fatalf("failed to derive address: %v", err)
+	}
+
+	message := []byte("hello")
+	typedHash, _ := TypedDataHash([]byte(mailTypedData))
+	for _, tc := range []struct {
+		name string
+		hash []byte
+		sign func(context.Context, dkls.Transport, string, *dkls.Keyshare, string, []byte, []byte) ([]byte, error)
+		data []byte
+	}{
+		{"personal_sign", PersonalMessageHash(message), SignPersonalMessage, message},
+		{"eth_signTypedData_v4", typedHash, SignTypedData, []byte(mailTypedData)},
+	} {
+		net := dklstest.NewNetwork(2)
+		sigs := make([][]byte, 2)
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i, share := range shares {
+			wg.Add(1)
+			go func(i int, share *dkls.Keyshare) {
+				defer wg.Done()
+				sigs[i], errs[i] = tc.sign(ctx, net.Transport(uint8(i)), tc.name, share, path, tc.data, nil)
+			}(i, share)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("%s: party %d: sign failed: %v", tc.name, i, err)
+			}
+		}
+		if v := sigs[0][64]; v != 27 && v != 28 {
+			t.Errorf("%s: unexpected v %d", tc.name, v)
+		}
+		signer, err := RecoverAddress(tc.hash, sigs[0])
+		if err != nil {
+			t.Fatalf("%s: failed to recover: %v", tc.name, err)
+		}
+		if signer != addr {
+			t.Errorf("%s: signature recovers to %s, expected %s", tc.name, signer, addr)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package ethereum
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// Minimal RLP encoding of the values that appear in transactions
+
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpHeader(0x80, len(b)), b...)
+}
+
+func rlpUint(v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	i := 0
+	for i < 8 && buf[i] == 0 {
+		i++
+	}
+	return rlpBytes(buf[i:])
+}
+
+// rlpBig encodes a non-negative integer; nil is zero
+func rlpBig(v *big.Int) []byte {
+	if v == nil {
+		return rlpBytes(nil)
+	}
+	return rlpBytes(v.Bytes())
+}
+
+func rlpList(items ...[]byte) []byte {
+	n := 0
+	for _, item := range items {
+		n += len(item)
+	}
+	out := rlpHeader(0xc0, n)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func rlpHeader(offset byte, n int) []byte {
+	if n <= 55 {
+		return []byte{offset + byte(n)}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	i := 0
+	for buf[i] == 0 {
+		i++
+	}
+	return append([]byte{offset + 55 + byte(8-i)}, buf[i:]...)
+}
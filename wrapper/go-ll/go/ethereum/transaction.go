@@ -0,0 +1,200 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+)
+
+// Transaction is an unsigned Ethereum transaction. Pass SigningHash to
+// SignSession.LastMessage and the result of Combine to EncodeSigned.
+type Transaction interface {
+	// SigningHash returns the 32-byte Keccak-256 hash to sign
+	SigningHash() []byte
+	// EncodeSigned returns the signed transaction, as sent with
+	// eth_sendRawTransaction
+	EncodeSigned(sig *dkls.Signature) ([]byte, error)
+}
+
+// AccessTuple is an entry of an EIP-2930 access list
+type AccessTuple struct {
+	Address     Address
+	StorageKeys [][32]byte
+}
+
+// AccessList is an EIP-2930 access list
+type AccessList []AccessTuple
+
+func (l AccessList) rlp() []byte {
+	tuples := make([][]byte, len(l))
+	for i, tuple := range l {
+		keys := make([][]byte, len(tuple.StorageKeys))
+		for j := range tuple.StorageKeys {
+			keys[j] = rlpBytes(tuple.StorageKeys[j][:])
+		}
+		tuples[i] = rlpList(rlpBytes(tuple.Address[:]), rlpList(keys...))
+	}
+	return rlpList(tuples...)
+}
+
+// rlpTo encodes the recipient; nil creates a contract
+func rlpTo(to *Address) []byte {
+	if to == nil {
+		return rlpBytes(nil)
+	}
+	return rlpBytes(to[:])
+}
+
+// signatureValues returns r and s as RLP integers
+func signatureValues(sig *dkls.Signature) (r, s []byte, err error) {
+	if sig == nil || len(sig.R) != 32 || len(sig.S) != 32 {
+		return nil, nil, errors.New("invalid signature")
+	}
+	if sig.RecoveryID > 1 {
+		return nil, nil, errors.New("recovery ID can not be encoded in a transaction")
+	}
+	return rlpBig(new(big.Int).SetBytes(sig.R)), rlpBig(new(big.Int).SetBytes(sig.S)), nil
+}
+
+// LegacyTx is a pre-EIP-2718 transaction. With a ChainID it is signed
+// with EIP-155 replay protection; ChainID 0 signs without it.
+type LegacyTx struct {
+	ChainID  uint64
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       *Address
+	Value    *big.Int
+	Data     []byte
+}
+
+func (tx *LegacyTx) fields() [][]byte {
+	return [][]byte{
+		rlpUint(tx.Nonce),
+		rlpBig(tx.GasPrice),
+		rlpUint(tx.Gas),
+		rlpTo(tx.To),
+		rlpBig(tx.Value),
+		rlpBytes(tx.Data),
+	}
+}
+
+// SigningHash implements Transaction
+func (tx *LegacyTx) SigningHash() []byte {
+	fields := tx.fields()
+	if tx.ChainID != 0 {
+		fields = append(fields, rlpUint(tx.ChainID), rlpUint(0), rlpUint(0))
+	}
+	return Keccak256(rlpList(fields...))
+}
+
+// EncodeSigned implements Transaction
+func (tx *LegacyTx) EncodeSigned(sig *dkls.Signature) ([]byte, error) {
+	r, s, err := signatureValues(sig)
+	if err != nil {
+		return nil, err
+	}
+	v := uint64(sig.RecoveryID) + 27
+	if tx.ChainID != 0 {
+		v = sig.EIP155V(tx.ChainID)
+	}
+	return rlpList(append(tx.fields(), rlpUint(v), r, s)...), nil
+}
+
+// AccessListTx is an EIP-2930 transaction
+type AccessListTx struct {
+	ChainID    uint64
+	Nonce      uint64
+	GasPrice   *big.Int
+	Gas        uint64
+	To         *Address
+	Value      *big.Int
+	Data       []byte
+	AccessList AccessList
+}
+
+func (tx *AccessListTx) fields() [][]byte {
+	return [][]byte{
+		rlpUint(tx.ChainID),
+		rlpUint(tx.Nonce),
+		rlpBig(tx.GasPrice),
+		rlpUint(tx.Gas),
+		rlpTo(tx.To),
+		rlpBig(tx.Value),
+		rlpBytes(tx.Data),
+		tx.AccessList.rlp(),
+	}
+}
+
+// SigningHash implements Transaction
+func (tx *AccessListTx) SigningHash() []byte {
+	return Keccak256([]byte{0x01}, rlpList(tx.fields()...))
+}
+
+// EncodeSigned implements Transaction
+func (tx *AccessListTx) EncodeSigned(sig *dkls.Signature) ([]byte, error) {
+	r, s, err := signatureValues(sig)
+	if err != nil {
+		return nil, err
+	}
+	fields := append(tx.fields(), rlpUint(uint64(sig.RecoveryID)), r, s)
+	return append([]byte{0x01}, rlpList(fields...)...), nil
+}
+
+// DynamicFeeTx is an EIP-1559 transaction
+type DynamicFeeTx struct {
+	ChainID    uint64
+	Nonce      uint64
+	GasTipCap  *big.Int // max priority fee per gas
+	GasFeeCap  *big.Int // max fee per gas
+	Gas        uint64
+	To         *Address
+	Value      *big.Int
+	Data       []byte
+	AccessList AccessList
+}
+
+func (tx *DynamicFeeTx) fields() [][]byte {
+	return [][]byte{
+		rlpUint(tx.ChainID),
+		rlpUint(tx.Nonce),
+		rlpBig(tx.GasTipCap),
+		rlpBig(tx.GasFeeCap),
+		rlpUint(tx.Gas),
+		rlpTo(tx.To),
+		rlpBig(tx.Value),
+		rlpBytes(tx.Data),
+		tx.AccessList.rlp(),
+	}
+}
+
+// SigningHash implements Transaction
+func (tx *DynamicFeeTx) SigningHash() []byte {
+	return Keccak256([]byte{0x02}, rlpList(tx.fields()...))
+}
+
+// EncodeSigned implements Transaction
+func (tx *DynamicFeeTx) EncodeSigned(sig *dkls.Signature) ([]byte, error) {
+	r, s, err := signatureValues(sig)
+	if err != nil {
+		return nil, err
+	}
+	fields := append(tx.fields(), rlpUint(uint64(sig.RecoveryID)), r, s)
+	return append([]byte{0x02}, rlpList(fields...)...), nil
+}
+
+// SignTransaction runs the sign protocol for tx over the transport, like
+// dkls.RunSign, and returns the signed transaction. All parties must
+// sign the same transaction with the same path.
+func SignTransaction(ctx context.Context, transport dkls.Transport, sessionID string, keyshare *dkls.Keyshare, path string, tx Transaction, seed []byte) ([]byte, error) {
+	sig, err := dkls.RunSign(ctx, transport, sessionID, keyshare, path, tx.SigningHash(), seed)
+	if err != nil {
+		return nil, err
+	}
+	return tx.EncodeSigned(sig)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package ethereum
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	dkls "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go"
+	"github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/dklstest"
+)
+
+const (
+	testR = "28ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276"
+	testS = "67cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+)
+
+var testTo = Address{0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35, 0x35}
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9))
+}
+
+// The example of EIP-155
+func TestLegacyTx(t *testing.T) {
+	tx := &LegacyTx{
+		ChainID:  1,
+		Nonce:    9,
+		GasPrice: gwei(20),
+		Gas:      21000,
+		To:       &testTo,
+		Value:    gwei(1e9),
+	}
+	if got := hex.EncodeToString(tx.SigningHash()); got != "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53" {
+		t.Errorf("unexpected signing hash %s", got)
+	}
+	signed, err := tx.EncodeSigned(&dkls.Signature{R: mustHex(t, testR), S: mustHex(t, testS), RecoveryID: 0})
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	want := "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a0" + testR + "a0" + testS
+	if got := hex.EncodeToString(signed); got != want {
+		t.Errorf("unexpected signed transaction\n got %s\nwant %s", got, want)
+	}
+
+	// Without a chain ID the hash covers only the six fields and v is 27
+	// or 28
+	tx.ChainID = 0
+	if got := hex.EncodeToString(tx.SigningHash()); got == "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53" {
+		t.Error("expected a different hash without a chain ID")
+	}
+	signed, _ = tx.EncodeSigned(&dkls.Signature{R: mustHex(t, testR), S: mustHex(t, testS), RecoveryID: 1})
+	if !bytes.Contains(signed, []byte{0x80, 0x1c, 0xa0}) {
+		t.Errorf("expected v 28 in %x", signed)
+	}
+
+	if _, err := tx.EncodeSigned(&dkls.Signature{R: mustHex(t, testR), S: mustHex(t, testS), RecoveryID: 2}); err == nil {
+		t.Error("expected an error for recovery ID 2")
+	}
+}
+
+// Expected encodings computed with an independent RLP implementation
+func TestTypedTransactions(t *testing.T) {
+	sig := &dkls.Signature{R: mustHex(t, testR), S: mustHex(t, testS), RecoveryID: 1}
+	var key [32]byte
+	key[31] = 1
+	dynamic := &DynamicFeeTx{
+		ChainID:    1,
+		Nonce:      3,
+		GasTipCap:  gwei(2),
+		GasFeeCap:  gwei(100),
+		Gas:        21000,
+		To:         &testTo,
+		Value:      gwei(1e9),
+		Data:       []byte{0x12, 0x34},
+		AccessList: AccessList{{Address: testTo, StorageKeys: [][32]byte{key}}},
+	}
+	payload := "02f86b0103847735940085174876e800825208943535353535353535353535353535353535353535880de0b6b3a7640000821234f838f7943535353535353535353535353535353535353535e1a00000000000000000000000000000000000000000000000000000000000000001"
+	if !bytes.Equal(dynamic.SigningHash(), Keccak256(mustHex(t, payload))) {
+		t.Error("unexpected EIP-1559 signing hash")
+	}
+	signed, err := dynamic.EncodeSigned(sig)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	want := "02f8ae0103847735940085174876e800825208943535353535353535353535353535353535353535880de0b6b3a7640000821234f838f7943535353535353535353535353535353535353535e1a0000000000000000000000000000000000000000000000000000000000000000101a0" + testR + "a0" + testS
+	if got := hex.EncodeToString(signed); got != want {
+		t.Errorf("unexpected EIP-1559 transaction\n got %s\nwant %s", got, want)
+	}
+
+	// Contract creation with a long data field and an empty access list
+	accessList := &AccessListTx{
+		ChainID:  5,
+		GasPrice: gwei(20),
+		Gas:      30000,
+		Data:     bytes.Repeat([]byte{0x12, 0x34}, 30),
+	}
+	payload = "01f84c05808504a817c8008275308080b83c" + hex.EncodeToString(accessList.Data) + "c0"
+	if !bytes.Equal(accessList.SigningHash(), Keccak256(mustHex(t, payload))) {
+		t.Error("unexpected EIP-2930 signing hash")
+	}
+	sig.RecoveryID = 0
+	signed, err = accessList.EncodeSigned(sig)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	want = "01f88f05808504a817c8008275308080b83c" + hex.EncodeToString(accessList.Data) + "c080a0" + testR + "a0" + testS
+	if got := hex.EncodeToString(signed); got != want {
+		t.Errorf("unexpected EIP-2930 transaction\n got %s\nwant %s", got, want)
+	}
+}
+
+// decodeList returns the contents of the items of an RLP list of
+// strings and lists shorter than 56 bytes
+func decodeList(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+	if len(b) < 2 || b[0] < 0xf8 {
+		t.Fatalf("expected a long list, got %x", b)
+	}
+	n := int(b[0] - 0xf7)
+	b = b[1+n:]
+	var items [][]byte
+	for len(b) > 0 {
+		switch {
+		case b[0] < 0x80:
+			items, b = append(items, b[:1]), b[1:]
+		case b[0] < 0xb8:
+			n := int(b[0] - 0x80)
+			items, b = append(items, b[1:1+n]), b[1+n:]
+		case b[0] >= 0xc0 && b[0] < 0xf8:
+			n := int(b[0] - 0xc0)
+			items, b = append(items, b[1:1+n]), b[1+n:]
+		default:
+			t.Fatalf("unexpected item %x", b)
+		}
+	}
+	return items
+}
+
+func TestSignTransaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	shares, err := dklstest.RunKeygen(ctx, 2, 2, nil)
+	if err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	path := dkls.BIP44(60, 0, 0, 0).String()
+	addr, err := DeriveAddress(shares[0], path)
+	if err != nil {
+		t.Fatalf("failed to derive address: %v", err)
+	}
+	tx := &DynamicFeeTx{ChainID: 1, GasTipCap: gwei(1), GasFeeCap: gwei(50), Gas: 21000, To: &testTo, Value: big.NewInt(1)}
+
+	net := dklstest.NewNetwork(2)
+	signed := make([][]byte, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, share := range shares {
+		wg.Add(1)
+		go func(i int, share *dkls.Keyshare) {
+			defer wg.Done()
+			signed[i], errs[i] = SignTransaction(ctx, net.Transport(uint8(i)), "tx", share, path, tx, nil)
+		}(i, share)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("party %d: sign failed: %v", i, err)
+		}
+	}
+	if !bytes.Equal(signed[0], signed[1]) {
+		t.Error("parties produced different transactions")
+	}
+
+	// The signature at the end of the transaction verifies against the
+	// derived key, whose address is the sender
+	items := decodeList(t, signed[0][1:])
+	if len(items) != 12 {
+		t.Fatalf("expected 12 fields, got %d", len(items))
+	}
+	sig := &dkls.Signature{
+		R: new(big.Int).SetBytes(items[10]).FillBytes(make([]byte, 32)),
+		S: new(big.Int).SetBytes(items[11]).FillBytes(make([]byte, 32)),
+	}
+	pubKey, _, _ := shares[0].DerivePublicKey(path)
+	if err := dkls.VerifySignature(pubKey, tx.SigningHash(), sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if sender, _ := PubkeyToAddress(pubKey); sender != addr {
+		t.Errorf("expected sender %s, got %s", addr, sender)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package ethereum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TypedDataField is a member of an EIP-712 struct type
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TypedData is an EIP-712 document as passed to eth_signTypedData_v4
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+// ParseTypedData parses a typed-data JSON document. Integers may be JSON
+// numbers, decimal strings or 0x-prefixed hex strings.
+func ParseTypedData(doc []byte) (*TypedData, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var td TypedData
+	if err := dec.Decode(&td); err != nil {
+		return nil, fmt.Errorf("invalid typed data: %w", err)
+	}
+	if _, ok := td.Types["EIP712Domain"]; !ok {
+		return nil, fmt.Errorf("invalid typed data: missing EIP712Domain type")
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok {
+		return nil, fmt.Errorf("invalid typed data: unknown primary type %q", td.PrimaryType)
+	}
+	return &td, nil
+}
+
+// TypedDataHash returns the EIP-712 digest of a typed-data JSON document,
+// the message hash for eth_signTypedData_v4
+func TypedDataHash(doc []byte) ([]byte, error) {
+	td, err := ParseTypedData(doc)
+	if err != nil {
+		return nil, err
+	}
+	return td.Hash()
+}
+
+// Hash returns Keccak-256("\x19\x01" || domainSeparator || hashStruct(message)).
+// The message hash is left out if the primary type is EIP712Domain.
+func (td *TypedData) Hash() ([]byte, error) {
+	domain, err := td.HashStruct("EIP712Domain", td.Domain)
+	if err != nil {
+		return nil, err
+	}
+	if td.PrimaryType == "EIP712Domain" {
+		return Keccak256([]byte{0x19, 0x01}, domain), nil
+	}
+	message, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, err
+	}
+	return Keccak256([]byte{0x19, 0x01}, domain, message), nil
+}
+
+// HashStruct returns hashStruct of the data as the given struct type
+func (td *TypedData) HashStruct(typ string, data map[string]interface{}) ([]byte, error) {
+	encoded, err := td.encodeData(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	return Keccak256(encoded), nil
+}
+
+// EncodeType returns the type string of a struct type followed by the
+// struct types it references, in alphabetical order
+func (td *TypedData) EncodeType(typ string) string {
+	deps := make(map[string]bool)
+	td.dependencies(typ, deps)
+	delete(deps, typ)
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range append([]string{typ}, names...) {
+		b.WriteString(name)
+		b.WriteByte('(')
+		for i, field := range td.Types[name] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(field.Type + " " + field.Name)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+func (td *TypedData) dependencies(typ string, found map[string]bool) {
+	if i := strings.IndexByte(typ, '['); i >= 0 {
+		typ = typ[:i]
+	}
+	if _, ok := td.Types[typ]; !ok || found[typ] {
+		return
+	}
+	found[typ] = true
+	for _, field := range td.Types[typ] {
+		td.dependencies(field.Type, found)
+	}
+}
+
+func (td *TypedData) encodeData(typ string, data map[string]interface{}) ([]byte, error) {
+	fields, ok := td.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	out := Keccak256([]byte(td.EncodeType(typ)))
+	for _, field := range fields {
+		value, ok := data[field.Name]
+		if !ok {
+			if _, isStruct := td.Types[field.Type]; !isStruct {
+				return nil, fmt.Errorf("missing value for field %s of type %s", field.Name, field.Type)
+			}
+		}
+		encoded, err := td.encodeValue(field.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		out = append(out, encoded...)
+	}
+	return out, nil
+}
+
+// encodeValue returns the 32-byte encoding of one member value
+func (td *TypedData) encodeValue(typ string, value interface{}) ([]byte, error) {
+	if strings.HasSuffix(typ, "]") {
+		elem := typ[:strings.LastIndexByte(typ, '[')]
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array for %s", typ)
+		}
+		var concat []byte
+		for _, item := range items {
+			encoded, err := td.encodeValue(elem, item)
+			if err != nil {
+				return nil, err
+			}
+			concat = append(concat, encoded...)
+		}
+		return Keccak256(concat), nil
+	}
+
+	if _, ok := td.Types[typ]; ok {
+		if value == nil {
+			return make([]byte, 32), nil
+		}
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %s", typ)
+		}
+		return td.HashStruct(typ, data)
+	}
+
+	switch {
+	case typ == "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string")
+		}
+		return Keccak256([]byte(s)), nil
+	case typ == "bytes":
+		b, err := hexValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return Keccak256(b), nil
+	case typ == "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a bool")
+		}
+		out := make([]byte, 32)
+		if b {
+			out[31] = 1
+		}
+		return out, nil
+	case typ == "address":
+		b, err := hexValue(value)
+		if err != nil || len(b) != 20 {
+			return nil, fmt.Errorf("invalid address %v", value)
+		}
+		return append(make([]byte, 12), b...), nil
+	case strings.HasPrefix(typ, "bytes"):
+		n, err := strconv.Atoi(typ[len("bytes"):])
+		if err != nil || n < 1 || n > 32 {
+			return nil, fmt.Errorf("unknown type %q", typ)
+		}
+		b, err := hexValue(value)
+		if err != nil || len(b) > n {
+			return nil, fmt.Errorf("invalid %s value %v", typ, value)
+		}
+		return append(b, make([]byte, 32-len(b))...), nil
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		return encodeInteger(typ, value)
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+func hexValue(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("expected a 0x-prefixed hex string")
+	}
+	return hex.DecodeString(s[2:])
+}
+
+// encodeInteger returns the 32-byte two's complement encoding of an intN
+// or uintN value, checking that it fits
+func encodeInteger(typ string, value interface{}) ([]byte, error) {
+	signed := strings.HasPrefix(typ, "int")
+	bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"))
+	if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return nil, fmt.Errorf("expected an integer")
+	}
+	n, ok := new(big.Int), false
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		n, ok = n.SetString(s[2:], 16)
+	} else {
+		n, ok = n.SetString(s, 10)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %q", s)
+	}
+
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if signed {
+		limit.Rsh(limit, 1)
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, fmt.Errorf("%s out of range for %s", s, typ)
+		}
+	} else if n.Sign() < 0 || n.Cmp(limit) >= 0 {
+		return nil, fmt.Errorf("%s out of range for %s", s, typ)
+	}
+	if n.Sign() < 0 {
+		n.Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return n.FillBytes(make([]byte, 32)), nil
+}
@@ -11,8 +11,8 @@ import (
 // Example demonstrates a basic 2-of-2 key generation and signing flow
 func Example_basicFlow() {
 	// Step 1: Create keygen sessions for 2 participants
-	party0 := NewKeygenSession(2, 2, 0, nil)
-	party1 := NewKeygenSession(2, 2, 1, nil)
+	party0, _ := NewKeygenSession(2, 2, 0, nil)
+	party1, _ := NewKeygenSession(2, 2, 1, nil)
 	defer party0.Free()
 	defer party1.Free()
 
@@ -76,9 +76,10 @@ func Example_basicFlow() {
 	last1, _ := sign1.LastMessage(messageHash)
 	_ = last0 // Use last0 to avoid unused variable warning
 
-	r, s, _ := sign0.Combine([]*Message{last1})
-	fmt.Printf("Signature r: %x\n", r)
-	fmt.Printf("Signature s: %x\n", s)
+	sig, _ := sign0.Combine([]*Message{last1})
+	fmt.Printf("Signature r: %x\n", sig.R)
+	fmt.Printf("Signature s: %x\n", sig.S)
+	fmt.Printf("Recovery ID: %d\n", sig.RecoveryID)
 }
 
 func selectMessagesForParty(msgs []*Message, partyID uint8) []*Message {
@@ -95,7 +96,7 @@ func selectMessagesForParty(msgs []*Message, partyID uint8) []*Message {
 func Example_keyshareSerialization() {
 	// Create a keyshare (in practice, this would come from DKG)
 	// For this example, we'll simulate by creating a session and extracting a share
-	party := NewKeygenSession(2, 2, 0, nil)
+	party, _ := NewKeygenSession(2, 2, 0, nil)
 	defer party.Free()
 
 	// ... run DKG protocol ...
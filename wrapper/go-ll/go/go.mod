@@ -1,3 +1,5 @@
 module github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go
 
 go 1.16
+
+require golang.org/x/crypto v0.31.0
@@ -0,0 +1,191 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNoPresignatureGuard is returned when a sign session that has
+// reached the second round is serialized or restored without a
+// PresignatureGuard
+var ErrNoPresignatureGuard = errors.New("sign session state past the first round needs a PresignatureGuard")
+
+// PresignatureGuard durably records the presignatures that have signed a
+// message, so that a sign session restored from bytes can not sign a
+// second message with the same presignature, also after a restart.
+// Presignatures are identified by their final session ID and party ID.
+//
+// Implementations must be safe for concurrent use.
+type PresignatureGuard interface {
+	// Use records that the presignature signs messageHash and must be
+	// durable when it returns. It returns ErrPresignatureUsed if the
+	// presignature has already signed another hash; the same hash may
+	// be recorded again.
+	Use(id []byte, partyID uint8, messageHash []byte) error
+	// Used reports whether the presignature has signed a message
+	Used(id []byte, partyID uint8) (bool, error)
+}
+
+type guardKey struct {
+	id      string
+	partyID uint8
+}
+
+// MemoryPresignatureGuard is a PresignatureGuard that keeps the used
+// presignatures in memory. It only protects for the lifetime of the
+// process.
+type MemoryPresignatureGuard struct {
+	mu   sync.Mutex
+	used map[guardKey][]byte
+}
+
+// NewMemoryPresignatureGuard creates an empty in-memory guard
+func NewMemoryPresignatureGuard() *MemoryPresignatureGuard {
+	return &MemoryPresignatureGuard{used: make(map[guardKey][]byte)}
+}
+
+// Use records that the presignature signs messageHash
+func (g *MemoryPresignatureGuard) Use(id []byte, partyID uint8, messageHash []byte) error {
+	key := guardKey{string(id), partyID}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if hash, ok := g.used[key]; ok {
+		if !bytes.Equal(hash, messageHash) {
+			return ErrPresignatureUsed
+		}
+		return nil
+	}
+	g.used[key] = append([]byte(nil), messageHash...)
+	return nil
+}
+
+// Used reports whether the presignature has signed a message
+func (g *MemoryPresignatureGuard) Used(id []byte, partyID uint8) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.used[guardKey{string(id), partyID}]
+	return ok, nil
+}
+
+// FilePresignatureGuard is a PresignatureGuard that keeps one file per
+// used presignature under a directory:
+//
+//	<dir>/<hex id>-<party id>.used
+//
+// holding the signed hash. The file is created exclusively and synced
+// with its directory before Use returns, so only the first hash is ever
+// recorded. Files are never removed; delete the directory once the
+// keyshare is retired.
+type FilePresignatureGuard struct {
+	dir string
+}
+
+// NewFilePresignatureGuard opens a guard in dir, creating the directory
+// if needed. Temporary files left by a process that stopped in the
+// middle of Use are erased.
+func NewFilePresignatureGuard(dir string) (*FilePresignatureGuard, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), tempFilePrefix) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &FilePresignatureGuard{dir: dir}, nil
+}
+
+func (g *FilePresignatureGuard) name(id []byte, partyID uint8) string {
+	return filepath.Join(g.dir, fmt.Sprintf("%s-%d%s", hex.EncodeToString(id), partyID, presignatureUsedSuffix))
+}
+
+// Use records that the presignature signs messageHash
+func (g *FilePresignatureGuard) Use(id []byte, partyID uint8, messageHash []byte) error {
+	name := g.name(id, partyID)
+	err := createFileExclusive(g.dir, name, messageHash)
+	if err == nil {
+		return nil
+	}
+	if !os.IsExist(err) {
+		return err
+	}
+	hash, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash, messageHash) {
+		return ErrPresignatureUsed
+	}
+	return nil
+}
+
+// Used reports whether the presignature has signed a message
+func (g *FilePresignatureGuard) Used(id []byte, partyID uint8) (bool, error) {
+	_, err := os.Stat(g.name(id, partyID))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Rounds of a sign session reported by dkls_sign_presignature_id
+const (
+	presignatureUnknown = 0 // before the final session ID is known
+	presignaturePending = 1 // the presignature is being computed
+	presignatureReady   = 2 // the presignature can sign, with LastMessage
+	presignatureSigned  = 3 // the presignature has signed a hash
+)
+
+// presignatureRef identifies the presignature of a sign session
+type presignatureRef struct {
+	round   int
+	id      []byte
+	partyID uint8
+	hash    []byte // for presignatureSigned
+}
+
+// checkSerialize checks that a session can be serialized with guard
+func (r presignatureRef) checkSerialize(guard PresignatureGuard) error {
+	if r.round != presignatureUnknown && guard == nil {
+		return ErrNoPresignatureGuard
+	}
+	return nil
+}
+
+// checkRestore checks a restored session against guard. A session that
+// has signed records its hash, and one that may still sign must not
+// have been used.
+func (r presignatureRef) checkRestore(guard PresignatureGuard) error {
+	if err := r.checkSerialize(guard); err != nil || r.round == presignatureUnknown {
+		return err
+	}
+	if r.round == presignatureSigned {
+		return guard.Use(r.id, r.partyID, r.hash)
+	}
+	used, err := guard.Used(r.id, r.partyID)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrPresignatureUsed
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func testPresignatureGuard(t *testing.T, guard PresignatureGuard) {
+	id := bytes.Repeat([]byte{1}, 32)
+	hash := bytes.Repeat([]byte{2}, 32)
+
+	if used, err := guard.Used(id, 1); err != nil || used {
+		t.Fatalf("expected an unused presignature, got %v, %v", used, err)
+	}
+	if err := guard.Use(id, 1, hash); err != nil {
+		t.Fatalf("failed to use: %v", err)
+	}
+	if used, err := guard.Used(id, 1); err != nil || !used {
+		t.Errorf("expected a used presignature, got %v, %v", used, err)
+	}
+	if err := guard.Use(id, 1, hash); err != nil {
+		t.Errorf("expected the same hash to be accepted again, got %v", err)
+	}
+	if err := guard.Use(id, 1, bytes.Repeat([]byte{3}, 32)); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed for another hash, got %v", err)
+	}
+
+	// The presignature of another party is separate
+	if used, _ := guard.Used(id, 2); used {
+		t.Error("expected the presignature of another party to be unused")
+	}
+	if err := guard.Use(id, 2, bytes.Repeat([]byte{3}, 32)); err != nil {
+		t.Errorf("failed to use the presignature of another party: %v", err)
+	}
+
+	// Concurrent uses with different hashes: exactly one wins
+	id = bytes.Repeat([]byte{4}, 32)
+	var wg sync.WaitGroup
+	var won int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := guard.Use(id, 1, bytes.Repeat([]byte{byte(i)}, 32))
+			if err == nil {
+				atomic.AddInt32(&won, 1)
+			} else if !errors.Is(err, ErrPresignatureUsed) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Errorf("%d concurrent uses succeeded, want 1", won)
+	}
+}
+
+func TestMemoryPresignatureGuard(t *testing.T) {
+	testPresignatureGuard(t, NewMemoryPresignatureGuard())
+}
+
+func TestFilePresignatureGuard(t *testing.T) {
+	dir := t.TempDir()
+	guard, err := NewFilePresignatureGuard(dir)
+	if err != nil {
+		t.Fatalf("failed to open guard: %v", err)
+	}
+	testPresignatureGuard(t, guard)
+
+	// Used presignatures are remembered after a restart
+	guard, err = NewFilePresignatureGuard(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen guard: %v", err)
+	}
+	id := bytes.Repeat([]byte{1}, 32)
+	if used, err := guard.Used(id, 1); err != nil || !used {
+		t.Errorf("expected a used presignature after reopening, got %v, %v", used, err)
+	}
+	if err := guard.Use(id, 1, bytes.Repeat([]byte{3}, 32)); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed after reopening, got %v", err)
+	}
+}
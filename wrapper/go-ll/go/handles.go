@@ -0,0 +1,122 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// Every handle type has a finalizer that frees, and so zeroizes, the
+// handle if it is garbage collected without Free or Close being called.
+// Finalizers run at an unspecified time, if at all, so handles holding
+// secrets should still be freed explicitly. Methods hold the lock of
+// their handle until they return, which also keeps the handle alive so
+// that the finalizer can not free it during a call.
+//
+// All handles are safe for use by multiple goroutines. Calls on a session
+// or presignature are serialized, so concurrent calls on one session do
+// not crash but usually fail the protocol; drive each session from one
+// goroutine. Keyshare methods take a read lock, so a keyshare can be
+// shared by any number of concurrent NewSignSession calls, and Free waits
+// for them to return.
+
+// LeakReport describes a handle that was garbage collected without
+// being freed
+type LeakReport struct {
+	// Type is the Go type of the handle, e.g. "Keyshare"
+	Type string
+	// Stack is the stack trace of the goroutine that created the handle
+	Stack []byte
+}
+
+var leaks struct {
+	sync.Mutex
+	report func(LeakReport)
+	live   map[string]int
+}
+
+// EnableLeakDetection starts counting the live handles created from now
+// on and calls report for each of them that is garbage collected without
+// being freed. report runs on the finalizer goroutine and must not
+// block. Leak detection records a stack trace for every handle and is
+// meant for tests and debugging.
+func EnableLeakDetection(report func(LeakReport)) {
+	leaks.Lock()
+	defer leaks.Unlock()
+	leaks.report = report
+	if leaks.live == nil {
+		leaks.live = make(map[string]int)
+	}
+}
+
+// DisableLeakDetection stops tracking new handles. Handles created while
+// leak detection was enabled are still counted and reported.
+func DisableLeakDetection() {
+	leaks.Lock()
+	defer leaks.Unlock()
+	leaks.report = nil
+}
+
+// LiveHandles returns the number of tracked handles of each type that
+// have not been freed yet
+func LiveHandles() map[string]int {
+	leaks.Lock()
+	defer leaks.Unlock()
+	live := make(map[string]int, len(leaks.live))
+	for typ, n := range leaks.live {
+		if n > 0 {
+			live[typ] = n
+		}
+	}
+	return live
+}
+
+// leakRecord tracks one handle. A nil record means the handle was
+// created with leak detection disabled.
+type leakRecord struct {
+	typ    string
+	stack  []byte
+	report func(LeakReport)
+	done   bool
+}
+
+func trackHandle(typ string) *leakRecord {
+	leaks.Lock()
+	defer leaks.Unlock()
+	if leaks.report == nil {
+		return nil
+	}
+	leaks.live[typ]++
+	return &leakRecord{typ: typ, stack: debug.Stack(), report: leaks.report}
+}
+
+// release is called when the handle is freed or consumed
+func (r *leakRecord) release() {
+	if r == nil {
+		return
+	}
+	leaks.Lock()
+	defer leaks.Unlock()
+	if !r.done {
+		r.done = true
+		leaks.live[r.typ]--
+	}
+}
+
+// leaked is called by the finalizer of a handle that was never freed
+func (r *leakRecord) leaked() {
+	if r == nil {
+		return
+	}
+	leaks.Lock()
+	if r.done {
+		leaks.Unlock()
+		return
+	}
+	r.done = true
+	leaks.live[r.typ]--
+	leaks.Unlock()
+	r.report(LeakReport{Type: r.typ, Stack: r.stack})
+}
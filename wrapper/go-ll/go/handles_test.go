@@ -0,0 +1,194 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	_ io.Closer = (*Keyshare)(nil)
+	_ io.Closer = (*KeygenSession)(nil)
+	_ io.Closer = (*SignSession)(nil)
+	_ io.Closer = (*SignSessionOTVariant)(nil)
+	_ io.Closer = (*PreSignature)(nil)
+	_ io.Closer = (*PartialSignature)(nil)
+)
+
+func TestLeakRecords(t *testing.T) {
+	if r := trackHandle("Test"); r != nil {
+		t.Fatal("expected no record with leak detection disabled")
+	}
+	var reports []LeakReport
+	EnableLeakDetection(func(r LeakReport) { reports = append(reports, r) })
+	defer DisableLeakDetection()
+
+	freed := trackHandle("Test")
+	lost := trackHandle("Test")
+	if n := LiveHandles()["Test"]; n != 2 {
+		t.Fatalf("expected 2 live handles, got %d", n)
+	}
+
+	freed.release()
+	freed.release()
+	freed.leaked()
+	if n := LiveHandles()["Test"]; n != 1 {
+		t.Fatalf("expected 1 live handle, got %d", n)
+	}
+	if len(reports) != 0 {
+		t.Fatalf("expected no leak reported for a freed handle, got %d", len(reports))
+	}
+
+	lost.leaked()
+	if _, ok := LiveHandles()["Test"]; ok {
+		t.Error("expected no live handles")
+	}
+	if len(reports) != 1 || reports[0].Type != "Test" || len(reports[0].Stack) == 0 {
+		t.Errorf("expected one leak report with a stack, got %+v", reports)
+	}
+}
+
+func TestFinalizerReportsLeak(t *testing.T) {
+	leaked := make(chan LeakReport, 1)
+	EnableLeakDetection(func(r LeakReport) { leaked <- r })
+	defer DisableLeakDetection()
+
+	session, err := NewKeygenSession(3, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatalf("failed to close session: %v", err)
+	}
+	if _, err := NewKeygenSession(3, 2, 1, nil); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case r := <-leaked:
+			if r.Type != "KeygenSession" {
+				t.Errorf("expected a leaked KeygenSession, got %s", r.Type)
+			}
+			if n := LiveHandles()["KeygenSession"]; n != 0 {
+				t.Errorf("expected no live sessions, got %d", n)
+			}
+			return
+		case <-deadline:
+			t.Fatal("leaked session was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestUseAfterFree(t *testing.T) {
+	session, err := NewKeygenSession(3, 2, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	session.Free()
+	session.Free()
+	if _, err := session.CreateFirstMessage(); !errors.Is(err, ErrHandleFreed) {
+		t.Errorf("expected ErrHandleFreed, got %v", err)
+	}
+	if _, err := session.Keyshare(); !errors.Is(err, ErrHandleFreed) {
+		t.Errorf("expected ErrHandleFreed, got %v", err)
+	}
+
+	keyshare := &Keyshare{}
+	if _, err := keyshare.PublicKey(); !errors.Is(err, ErrHandleFreed) {
+		t.Errorf("expected ErrHandleFreed, got %v", err)
+	}
+	if _, err := NewSignSession(keyshare, "m", nil); !errors.Is(err, ErrHandleFreed) {
+		t.Errorf("expected ErrHandleFreed, got %v", err)
+	}
+	if _, _, err := (&PreSignature{}).Sign(make([]byte, 32)); !errors.Is(err, ErrHandleFreed) {
+		t.Errorf("expected ErrHandleFreed, got %v", err)
+	}
+}
+
+// Run with -race
+func TestConcurrentKeyshareUse(t *testing.T) {
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer shares[1].Free()
+	keyshare := shares[0]
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, err := NewSignSession(keyshare, "m", nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer session.Free()
+			if _, err := keyshare.PublicKey(); err != nil {
+				errs <- err
+				return
+			}
+			// Concurrent calls on one session are serialized: the
+			// first message is created once, the other call finds the
+			// session in the next round
+			var inner sync.WaitGroup
+			results := make([]error, 2)
+			for j := range results {
+				inner.Add(1)
+				go func(j int) {
+					defer inner.Done()
+					_, results[j] = session.CreateFirstMessage()
+				}(j)
+			}
+			inner.Wait()
+			succeeded := 0
+			for _, err := range results {
+				if err == nil {
+					succeeded++
+				} else if !errors.Is(err, ErrInvalidState) {
+					errs <- err
+					return
+				}
+			}
+			if succeeded != 1 {
+				errs <- fmt.Errorf("%d of 2 concurrent first messages succeeded, want 1", succeeded)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent use failed: %v", err)
+	}
+
+	// Free waits for readers; later calls fail cleanly
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			session, err := NewSignSession(keyshare, "m", nil)
+			if err != nil {
+				if !errors.Is(err, ErrHandleFreed) {
+					t.Errorf("expected ErrHandleFreed, got %v", err)
+				}
+				return
+			}
+			session.Free()
+		}
+	}()
+	keyshare.Free()
+	<-done
+}
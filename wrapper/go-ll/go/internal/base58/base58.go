@@ -0,0 +1,86 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+// Package base58 implements the Bitcoin base58 and base58check encodings
+package base58
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ErrInvalid is returned for a string with characters outside the
+// alphabet or a wrong checksum
+var ErrInvalid = errors.New("invalid base58 string")
+
+// Encode encodes data in base58. Leading zero bytes become '1'.
+func Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Decode decodes a base58 string
+func Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(alphabet, c)
+		if i < 0 {
+			return nil, ErrInvalid
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(i)))
+	}
+	zeros := 0
+	for zeros < len(s) && s[zeros] == alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// CheckEncode appends the 4-byte double SHA-256 checksum and encodes the
+// result in base58
+func CheckEncode(payload []byte) string {
+	return Encode(append(append([]byte{}, payload...), checksum(payload)...))
+}
+
+// CheckDecode decodes a base58check string and verifies its checksum
+func CheckDecode(s string) ([]byte, error) {
+	data, err := Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, ErrInvalid
+	}
+	payload, sum := data[:len(data)-4], data[len(data)-4:]
+	if string(checksum(payload)) != string(sum) {
+		return nil, ErrInvalid
+	}
+	return payload, nil
+}
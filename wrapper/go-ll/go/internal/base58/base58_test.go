@@ -0,0 +1,48 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package base58
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct{ hex, want string }{
+		{"", ""},
+		{"00", "1"},
+		{"0000287fb4cd", "11233QC4"},
+		{"61", "2g"},
+		{"516b6fcd0f", "ABnLTmg"},
+		{"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+	}
+	for _, tt := range tests {
+		data, _ := hex.DecodeString(tt.hex)
+		if got := Encode(data); got != tt.want {
+			t.Errorf("Encode(%s) = %s, want %s", tt.hex, got, tt.want)
+		}
+		decoded, err := Decode(tt.want)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("Decode(%s) = %x, %v", tt.want, decoded, err)
+		}
+	}
+	if _, err := Decode("0OIl"); err != ErrInvalid {
+		t.Errorf("expected ErrInvalid, got %v", err)
+	}
+}
+
+func TestCheckEncode(t *testing.T) {
+	payload := []byte{0x00, 0x01, 0x02, 0x03}
+	s := CheckEncode(payload)
+	decoded, err := CheckDecode(s)
+	if err != nil || !bytes.Equal(decoded, payload) {
+		t.Fatalf("CheckDecode(%s) = %x, %v", s, decoded, err)
+	}
+	corrupted := []byte(s)
+	corrupted[len(corrupted)-1] ^= 1
+	if _, err := CheckDecode(string(corrupted)); err != ErrInvalid {
+		t.Errorf("expected ErrInvalid for a bad checksum, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+// Package bech32 implements the BIP173 bech32 encoding
+package bech32
+
+import (
+	"errors"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// ErrInvalid is returned for a malformed bech32 string or a wrong
+// checksum
+var ErrInvalid = errors.New("invalid bech32 string")
+
+func polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	out := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// Encode encodes 5-bit groups with the human-readable part hrp
+func Encode(hrp string, data []byte) (string, error) {
+	if hrp == "" || strings.ToLower(hrp) != hrp {
+		return "", ErrInvalid
+	}
+	values := append(hrpExpand(hrp), data...)
+	mod := polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range data {
+		if v >= 32 {
+			return "", ErrInvalid
+		}
+		b.WriteByte(charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(charset[(mod>>uint(5*(5-i)))&31])
+	}
+	return b.String(), nil
+}
+
+// Decode returns the human-readable part and the 5-bit groups of a
+// bech32 string
+func Decode(s string) (hrp string, data []byte, err error) {
+	if len(s) > 90 || (strings.ToLower(s) != s && strings.ToUpper(s) != s) {
+		return "", nil, ErrInvalid
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, ErrInvalid
+	}
+	hrp = s[:sep]
+	for _, c := range s[sep+1:] {
+		i := strings.IndexRune(charset, c)
+		if i < 0 {
+			return "", nil, ErrInvalid
+		}
+		data = append(data, byte(i))
+	}
+	if polymod(append(hrpExpand(hrp), data...)) != 1 {
+		return "", nil, ErrInvalid
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+// ConvertBits regroups data from groups of from bits to groups of to
+// bits. With pad, a final partial group is padded with zeros; without
+// it, the leftover bits must be zero padding.
+func ConvertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<to - 1
+	var out []byte
+	for _, v := range data {
+		if uint32(v)>>from != 0 {
+			return nil, ErrInvalid
+		}
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, ErrInvalid
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package bech32
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Valid checksums of BIP173
+func TestDecode(t *testing.T) {
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	} {
+		hrp, data, err := Decode(s)
+		if err != nil {
+			t.Errorf("Decode(%s): %v", s, err)
+			continue
+		}
+		encoded, err := Encode(hrp, data)
+		if err != nil || encoded != strings.ToLower(s) {
+			t.Errorf("Encode(%s) = %s, %v", hrp, encoded, err)
+		}
+	}
+
+	for _, s := range []string{
+		"pzry9x0s0muk",      // no separator
+		"1pzry9x0s0muk",     // empty human-readable part
+		"x1b4n0q5v",         // invalid character
+		"li1dgmt3",          // checksum too short
+		"A1G7SGD8",          // checksum of the upper case string
+		"a12uel5l" + "q",    // bad checksum
+		"aBcDeF1qpzry9x8gf", // mixed case
+	} {
+		if _, _, err := Decode(s); err != ErrInvalid {
+			t.Errorf("Decode(%s): expected ErrInvalid, got %v", s, err)
+		}
+	}
+}
+
+func TestConvertBits(t *testing.T) {
+	data := []byte{0xff, 0x00, 0x80}
+	five, err := ConvertBits(data, 8, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ConvertBits(five, 5, 8, false)
+	if err != nil || !bytes.Equal(back, data) {
+		t.Errorf("ConvertBits round trip = %x, %v", back, err)
+	}
+	if _, err := ConvertBits([]byte{0x20}, 5, 8, false); err != ErrInvalid {
+		t.Errorf("expected ErrInvalid for an out of range group, got %v", err)
+	}
+}
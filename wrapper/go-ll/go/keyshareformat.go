@@ -0,0 +1,91 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Keyshare container written by Keyshare.ToBytes:
+//
+//	magic "DKLS" | format version (1) | protocol version (2, big endian) |
+//	curve ID (1) | CBOR keyshare | checksum (4)
+//
+// The checksum is the first 4 bytes of the SHA-256 of everything before
+// it. Keyshares of older releases are a bare CBOR map and have no header.
+const (
+	// KeyshareFormatVersion is the container version written by ToBytes.
+	// Bare CBOR keyshares are version 0.
+	KeyshareFormatVersion = 1
+	// CurveSecp256k1 is the curve ID of secp256k1 keyshares
+	CurveSecp256k1 = 1
+
+	keyshareHeaderLen   = 8
+	keyshareChecksumLen = 4
+)
+
+var keyshareMagic = []byte("DKLS")
+
+// ErrInvalidKeyshare is returned for keyshare data that is truncated or
+// fails its checksum
+var ErrInvalidKeyshare = errors.New("invalid keyshare data")
+
+// KeyshareHeader describes serialized keyshare data
+type KeyshareHeader struct {
+	// FormatVersion is the container version, 0 for a bare CBOR keyshare
+	FormatVersion uint8
+	// ProtocolVersion is the version of the protocol that created the
+	// keyshare. It is 0 for a bare CBOR keyshare, which does not record it.
+	ProtocolVersion uint16
+	// CurveID is 0 for a bare CBOR keyshare
+	CurveID uint8
+}
+
+// Legacy reports whether the data is a bare CBOR keyshare of an older
+// release. NewKeyshareFromBytes still reads it; MigrateKeyshare rewrites
+// it in the current layout.
+func (h *KeyshareHeader) Legacy() bool {
+	return h.FormatVersion == 0
+}
+
+// ParseKeyshareHeader reads the header of serialized keyshare data and
+// verifies its checksum, without loading the keyshare. Versions newer
+// than this release supports are returned as is; NewKeyshareFromBytes
+// rejects them.
+func ParseKeyshareHeader(data []byte) (*KeyshareHeader, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+	if !bytes.HasPrefix(data, keyshareMagic) {
+		return &KeyshareHeader{}, nil
+	}
+	if len(data) < keyshareHeaderLen+keyshareChecksumLen {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidKeyshare)
+	}
+	content, checksum := data[:len(data)-keyshareChecksumLen], data[len(data)-keyshareChecksumLen:]
+	sum := sha256.Sum256(content)
+	if !bytes.Equal(sum[:keyshareChecksumLen], checksum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidKeyshare)
+	}
+	return &KeyshareHeader{
+		FormatVersion:   content[4],
+		ProtocolVersion: binary.BigEndian.Uint16(content[5:7]),
+		CurveID:         content[7],
+	}, nil
+}
+
+// MigrateKeyshare rewrites serialized keyshare data of any supported
+// version in the current layout
+func MigrateKeyshare(data []byte) ([]byte, error) {
+	keyshare, err := NewKeyshareFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	defer keyshare.Free()
+	return keyshare.ToBytes()
+}
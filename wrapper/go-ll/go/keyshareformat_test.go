@@ -0,0 +1,109 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// withChecksum returns content followed by its container checksum
+func withChecksum(content []byte) []byte {
+	sum := sha256.Sum256(content)
+	return append(append([]byte{}, content...), sum[:keyshareChecksumLen]...)
+}
+
+func TestParseKeyshareHeader(t *testing.T) {
+	// Container version 1, protocol version 1, secp256k1, empty CBOR map
+	data, _ := hex.DecodeString("444b4c5301000101a0c1ba8b09")
+	h, err := ParseKeyshareHeader(data)
+	if err != nil {
+		t.Fatalf("failed to parse header: %v", err)
+	}
+	if h.Legacy() || h.FormatVersion != KeyshareFormatVersion || h.ProtocolVersion != 1 || h.CurveID != CurveSecp256k1 {
+		t.Errorf("unexpected header %+v", h)
+	}
+
+	h, err = ParseKeyshareHeader([]byte{0xa0})
+	if err != nil {
+		t.Fatalf("failed to parse legacy data: %v", err)
+	}
+	if !h.Legacy() {
+		t.Errorf("expected bare CBOR to be legacy, got %+v", h)
+	}
+
+	bad := append([]byte{}, data...)
+	bad[8] ^= 1
+	if _, err := ParseKeyshareHeader(bad); !errors.Is(err, ErrInvalidKeyshare) {
+		t.Errorf("expected ErrInvalidKeyshare for a corrupted body, got %v", err)
+	}
+	if _, err := ParseKeyshareHeader(data[:10]); !errors.Is(err, ErrInvalidKeyshare) {
+		t.Errorf("expected ErrInvalidKeyshare for truncated data, got %v", err)
+	}
+	if _, err := ParseKeyshareHeader(nil); err == nil {
+		t.Error("expected an error for empty data")
+	}
+}
+
+func TestKeyshareMigration(t *testing.T) {
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	data, err := shares[0].ToBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize keyshare: %v", err)
+	}
+	h, err := ParseKeyshareHeader(data)
+	if err != nil {
+		t.Fatalf("failed to parse header: %v", err)
+	}
+	if h.FormatVersion != KeyshareFormatVersion || h.ProtocolVersion == 0 || h.CurveID != CurveSecp256k1 {
+		t.Errorf("unexpected header %+v", h)
+	}
+
+	// A bare CBOR keyshare of an older release is read and migrated
+	legacy := data[keyshareHeaderLen : len(data)-keyshareChecksumLen]
+	migrated, err := MigrateKeyshare(legacy)
+	if err != nil {
+		t.Fatalf("failed to migrate legacy keyshare: %v", err)
+	}
+	if !bytes.Equal(migrated, data) {
+		t.Error("migrated keyshare differs from the current serialization")
+	}
+
+	content := data[:len(data)-keyshareChecksumLen]
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 1
+	if _, err := NewKeyshareFromBytes(corrupted); err == nil {
+		t.Error("expected an error for a bad checksum")
+	}
+
+	newer := append([]byte{}, content...)
+	newer[5], newer[6] = 0xff, 0xff
+	if _, err := NewKeyshareFromBytes(withChecksum(newer)); err == nil {
+		t.Error("expected an error for a newer protocol version")
+	}
+
+	otherCurve := append([]byte{}, content...)
+	otherCurve[7] = 2
+	if _, err := NewKeyshareFromBytes(withChecksum(otherCurve)); err == nil {
+		t.Error("expected an error for an unknown curve")
+	}
+
+	newerFormat := append([]byte{}, content...)
+	newerFormat[4] = KeyshareFormatVersion + 1
+	if _, err := NewKeyshareFromBytes(withChecksum(newerFormat)); err == nil {
+		t.Error("expected an error for a newer format version")
+	}
+}
@@ -0,0 +1,669 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrKeyshareNotFound is returned when a store holds no keyshare for
+	// the requested public key, party ID and epoch
+	ErrKeyshareNotFound = errors.New("keyshare not found")
+	// ErrEpochNotCurrent is returned by Confirm when the epoch is not the
+	// current one
+	ErrEpochNotCurrent = errors.New("epoch is not current")
+)
+
+// KeyshareRecord describes the shares a store holds for one public key
+// and party ID
+type KeyshareRecord struct {
+	// PublicKey is the 33-byte compressed public key
+	PublicKey []byte
+	PartyID   uint8
+	// Epoch is the final session ID of the current share, nil if the
+	// key has been archived
+	Epoch []byte
+	// Archived holds the epochs of the archived shares, sorted
+	Archived [][]byte
+}
+
+// KeyshareStore persists keyshares by public key and party ID. The epoch
+// of a share is its final session ID, which changes with every rotation
+// or recovery while the public key stays the same.
+//
+// Put commits a new epoch atomically and archives the previous share.
+// The archived share is kept, and can be made current again with Revert,
+// until Confirm records that all parties hold the new epoch.
+//
+// Keyshares returned by Get and GetEpoch are owned by the caller, who
+// must free them. Implementations must be safe for concurrent use.
+type KeyshareStore interface {
+	// Put stores a keyshare as the current share of its public key and
+	// party ID. A current share of another epoch is archived in the same
+	// step. Storing a share that is already stored makes it current, so
+	// that a Put interrupted by a crash can be retried; storing other
+	// data under a stored epoch fails.
+	Put(keyshare *Keyshare) error
+	// Get returns the current share, or ErrKeyshareNotFound
+	Get(publicKey []byte, partyID uint8) (*Keyshare, error)
+	// GetEpoch returns the share of an epoch, current or archived
+	GetEpoch(publicKey []byte, partyID uint8, epoch []byte) (*Keyshare, error)
+	// List returns a record for every stored public key and party ID,
+	// sorted by public key and party ID
+	List() ([]KeyshareRecord, error)
+	// Archive archives the current share, after which Get fails
+	Archive(publicKey []byte, partyID uint8) error
+	// Confirm deletes the archived shares once every party holds the
+	// current epoch. It returns ErrEpochNotCurrent if epoch is not the
+	// current one.
+	Confirm(publicKey []byte, partyID uint8, epoch []byte) error
+	// Revert makes an archived epoch current again, for a rotation that
+	// did not complete. The current share is archived.
+	Revert(publicKey []byte, partyID uint8, epoch []byte) error
+}
+
+// keyshareFields returns what a store needs to file a keyshare
+func keyshareFields(keyshare *Keyshare) (pk []byte, partyID uint8, epoch, data []byte, err error) {
+	if keyshare == nil {
+		return nil, 0, nil, nil, errors.New("nil keyshare")
+	}
+	if pk, err = keyshare.PublicKey(); err != nil {
+		return nil, 0, nil, nil, err
+	}
+	if epoch, err = keyshare.FinalSessionID(); err != nil {
+		return nil, 0, nil, nil, err
+	}
+	if data, err = keyshare.ToBytes(); err != nil {
+		return nil, 0, nil, nil, err
+	}
+	return pk, keyshare.PartyID(), epoch, data, nil
+}
+
+func checkStorePublicKey(pk []byte) error {
+	if len(pk) != 33 {
+		return errors.New("public key must be 33 bytes")
+	}
+	return nil
+}
+
+func sortRecords(records []KeyshareRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if c := bytes.Compare(records[i].PublicKey, records[j].PublicKey); c != 0 {
+			return c < 0
+		}
+		return records[i].PartyID < records[j].PartyID
+	})
+}
+
+type memoryKeyshareKey struct {
+	pk      string
+	partyID uint8
+}
+
+type memoryKeyshareEntry struct {
+	current string // epoch of the current share, "" if archived
+	shares  map[string][]byte
+}
+
+// MemoryKeyshareStore is a KeyshareStore that keeps serialized
+// keyshares in memory
+type MemoryKeyshareStore struct {
+	mu      sync.Mutex
+	entries map[memoryKeyshareKey]*memoryKeyshareEntry
+}
+
+// NewMemoryKeyshareStore creates an empty in-memory store
+func NewMemoryKeyshareStore() *MemoryKeyshareStore {
+	return &MemoryKeyshareStore{entries: make(map[memoryKeyshareKey]*memoryKeyshareEntry)}
+}
+
+// Put stores a keyshare as the current share
+func (s *MemoryKeyshareStore) Put(keyshare *Keyshare) error {
+	pk, partyID, epoch, data, err := keyshareFields(keyshare)
+	if err != nil {
+		return err
+	}
+	return s.put(pk, partyID, epoch, data)
+}
+
+func (s *MemoryKeyshareStore) put(pk []byte, partyID uint8, epoch, data []byte) error {
+	if err := checkStorePublicKey(pk); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryKeyshareKey{string(pk), partyID}
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryKeyshareEntry{shares: make(map[string][]byte)}
+		s.entries[key] = entry
+	}
+	if stored, ok := entry.shares[string(epoch)]; ok {
+		if !bytes.Equal(stored, data) {
+			return errors.New("epoch already stored")
+		}
+		entry.current = string(epoch)
+		return nil
+	}
+	entry.shares[string(epoch)] = append([]byte(nil), data...)
+	entry.current = string(epoch)
+	return nil
+}
+
+// Get returns the current share
+func (s *MemoryKeyshareStore) Get(publicKey []byte, partyID uint8) (*Keyshare, error) {
+	data, err := s.get(publicKey, partyID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyshareFromBytes(data)
+}
+
+// GetEpoch returns the share of an epoch
+func (s *MemoryKeyshareStore) GetEpoch(publicKey []byte, partyID uint8, epoch []byte) (*Keyshare, error) {
+	if epoch == nil {
+		return nil, ErrKeyshareNotFound
+	}
+	data, err := s.get(publicKey, partyID, epoch)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyshareFromBytes(data)
+}
+
+// get returns the share of an epoch, or the current share if epoch is nil
+func (s *MemoryKeyshareStore) get(pk []byte, partyID uint8, epoch []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[memoryKeyshareKey{string(pk), partyID}]
+	if !ok {
+		return nil, ErrKeyshareNotFound
+	}
+	e := string(epoch)
+	if epoch == nil {
+		if entry.current == "" {
+			return nil, ErrKeyshareNotFound
+		}
+		e = entry.current
+	}
+	data, ok := entry.shares[e]
+	if !ok {
+		return nil, ErrKeyshareNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// List returns a record for every stored public key and party ID
+func (s *MemoryKeyshareStore) List() ([]KeyshareRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]KeyshareRecord, 0, len(s.entries))
+	for key, entry := range s.entries {
+		record := KeyshareRecord{PublicKey: []byte(key.pk), PartyID: key.partyID, Archived: [][]byte{}}
+		for epoch := range entry.shares {
+			if epoch == entry.current {
+				record.Epoch = []byte(epoch)
+			} else {
+				record.Archived = append(record.Archived, []byte(epoch))
+			}
+		}
+		sortIDs(record.Archived)
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// Archive archives the current share
+func (s *MemoryKeyshareStore) Archive(publicKey []byte, partyID uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[memoryKeyshareKey{string(publicKey), partyID}]
+	if !ok || entry.current == "" {
+		return ErrKeyshareNotFound
+	}
+	entry.current = ""
+	return nil
+}
+
+// Confirm deletes the archived shares
+func (s *MemoryKeyshareStore) Confirm(publicKey []byte, partyID uint8, epoch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[memoryKeyshareKey{string(publicKey), partyID}]
+	if !ok {
+		return ErrKeyshareNotFound
+	}
+	if entry.current == "" || entry.current != string(epoch) {
+		return ErrEpochNotCurrent
+	}
+	for e := range entry.shares {
+		if e != entry.current {
+			delete(entry.shares, e)
+		}
+	}
+	return nil
+}
+
+// Revert makes an archived epoch current again
+func (s *MemoryKeyshareStore) Revert(publicKey []byte, partyID uint8, epoch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[memoryKeyshareKey{string(publicKey), partyID}]
+	if !ok {
+		return ErrKeyshareNotFound
+	}
+	if _, ok := entry.shares[string(epoch)]; !ok || epoch == nil {
+		return ErrKeyshareNotFound
+	}
+	entry.current = string(epoch)
+	return nil
+}
+
+const (
+	keyshareFileSuffix  = ".share"
+	keyshareCurrentFile = "CURRENT"
+
+	// tempFilePrefix marks files of the file stores that are still being
+	// written
+	tempFilePrefix = "tmp-"
+)
+
+// FileKeyshareStore is a KeyshareStore that keeps one file per share
+// under a directory:
+//
+//	<dir>/<hex public key>/<party ID>/<hex epoch>.share
+//	<dir>/<hex public key>/<party ID>/CURRENT
+//
+// CURRENT holds the hex epoch of the current share; every other share is
+// archived. Files are written to a temporary file and renamed, so Put
+// commits a new epoch with the single rename of CURRENT.
+//
+// With a sealing key, shares are sealed with Keyshare.SealWithKey before
+// they are written.
+type FileKeyshareStore struct {
+	dir string
+	key []byte
+	mu  sync.Mutex
+}
+
+// NewFileKeyshareStore opens a store in dir, creating the directory if
+// needed. key is nil to store shares in the clear, or a 32-byte key to
+// seal them. Temporary files left by a process that stopped in the
+// middle of a write are removed.
+func NewFileKeyshareStore(dir string, key []byte) (*FileKeyshareStore, error) {
+	if key != nil && len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasPrefix(info.Name(), tempFilePrefix) {
+			return os.Remove(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FileKeyshareStore{dir: dir, key: append([]byte(nil), key...)}, nil
+}
+
+func (s *FileKeyshareStore) keyDir(pk []byte, partyID uint8) string {
+	return filepath.Join(s.dir, hex.EncodeToString(pk), strconv.Itoa(int(partyID)))
+}
+
+// Put stores a keyshare as the current share
+func (s *FileKeyshareStore) Put(keyshare *Keyshare) error {
+	pk, partyID, epoch, data, err := keyshareFields(keyshare)
+	if err != nil {
+		return err
+	}
+	if s.key != nil {
+		meta := &SealedMetadata{PublicKey: pk, PartyID: partyID, Threshold: keyshare.Threshold(), TotalParties: keyshare.Participants()}
+		sealed, err := sealPayload(kdfNone, s.key, meta, data)
+		zero(data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+	return s.put(pk, partyID, epoch, data)
+}
+
+func (s *FileKeyshareStore) put(pk []byte, partyID uint8, epoch, data []byte) error {
+	if err := checkStorePublicKey(pk); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.keyDir(pk, partyID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	current, err := s.current(dir)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(dir, hex.EncodeToString(epoch)+keyshareFileSuffix)
+	stored, err := os.ReadFile(name)
+	switch {
+	case err == nil:
+		// The share may have been written by a Put that stopped before
+		// it updated CURRENT
+		same, err := s.sameShare(stored, data)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return errors.New("epoch already stored")
+		}
+		if bytes.Equal(current, epoch) {
+			return nil
+		}
+	case os.IsNotExist(err):
+		if err := writeFileAtomic(dir, name, data); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	return writeFileAtomic(dir, filepath.Join(dir, keyshareCurrentFile), []byte(hex.EncodeToString(epoch)))
+}
+
+// sameShare reports whether two stored files hold the same share. Sealed
+// files are compared by their content, as every seal uses a new nonce.
+func (s *FileKeyshareStore) sameShare(stored, data []byte) (bool, error) {
+	if s.key == nil {
+		return bytes.Equal(stored, data), nil
+	}
+	a, err := openPayload(stored, kdfNone, s.key)
+	if err != nil {
+		return false, err
+	}
+	defer zero(a)
+	b, err := openPayload(data, kdfNone, s.key)
+	if err != nil {
+		return false, err
+	}
+	defer zero(b)
+	return bytes.Equal(a, b), nil
+}
+
+// current returns the current epoch in dir, or nil
+func (s *FileKeyshareStore) current(dir string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, keyshareCurrentFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	epoch, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt %s in %s", keyshareCurrentFile, dir)
+	}
+	return epoch, nil
+}
+
+// Get returns the current share
+func (s *FileKeyshareStore) Get(publicKey []byte, partyID uint8) (*Keyshare, error) {
+	data, err := s.get(publicKey, partyID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(data)
+}
+
+// GetEpoch returns the share of an epoch
+func (s *FileKeyshareStore) GetEpoch(publicKey []byte, partyID uint8, epoch []byte) (*Keyshare, error) {
+	if epoch == nil {
+		return nil, ErrKeyshareNotFound
+	}
+	data, err := s.get(publicKey, partyID, epoch)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(data)
+}
+
+func (s *FileKeyshareStore) open(data []byte) (*Keyshare, error) {
+	if s.key != nil {
+		return OpenKeyshareWithKey(data, s.key)
+	}
+	return NewKeyshareFromBytes(data)
+}
+
+// get returns the stored data of an epoch, or of the current share if
+// epoch is nil
+func (s *FileKeyshareStore) get(pk []byte, partyID uint8, epoch []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.keyDir(pk, partyID)
+	if epoch == nil {
+		current, err := s.current(dir)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, ErrKeyshareNotFound
+		}
+		epoch = current
+	}
+	data, err := os.ReadFile(filepath.Join(dir, hex.EncodeToString(epoch)+keyshareFileSuffix))
+	if os.IsNotExist(err) {
+		return nil, ErrKeyshareNotFound
+	}
+	return data, err
+}
+
+// epochs returns the epochs stored in dir, sorted
+func (s *FileKeyshareStore) epochs(dir string) ([][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	epochs := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, keyshareFileSuffix) {
+			continue
+		}
+		epoch, err := hex.DecodeString(strings.TrimSuffix(name, keyshareFileSuffix))
+		if err != nil {
+			continue
+		}
+		epochs = append(epochs, epoch)
+	}
+	sortIDs(epochs)
+	return epochs, nil
+}
+
+// List returns a record for every stored public key and party ID
+func (s *FileKeyshareStore) List() ([]KeyshareRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]KeyshareRecord, 0, len(keys))
+	for _, key := range keys {
+		pk, err := hex.DecodeString(key.Name())
+		if err != nil || !key.IsDir() {
+			continue
+		}
+		parties, err := os.ReadDir(filepath.Join(s.dir, key.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, party := range parties {
+			partyID, err := strconv.ParseUint(party.Name(), 10, 8)
+			if err != nil || !party.IsDir() {
+				continue
+			}
+			dir := s.keyDir(pk, uint8(partyID))
+			current, err := s.current(dir)
+			if err != nil {
+				return nil, err
+			}
+			epochs, err := s.epochs(dir)
+			if err != nil {
+				return nil, err
+			}
+			record := KeyshareRecord{PublicKey: pk, PartyID: uint8(partyID), Archived: [][]byte{}}
+			for _, epoch := range epochs {
+				if bytes.Equal(epoch, current) {
+					record.Epoch = epoch
+				} else {
+					record.Archived = append(record.Archived, epoch)
+				}
+			}
+			if record.Epoch != nil || len(record.Archived) > 0 {
+				records = append(records, record)
+			}
+		}
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// Archive archives the current share
+func (s *FileKeyshareStore) Archive(publicKey []byte, partyID uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(filepath.Join(s.keyDir(publicKey, partyID), keyshareCurrentFile))
+	if os.IsNotExist(err) {
+		return ErrKeyshareNotFound
+	}
+	return err
+}
+
+// Confirm deletes the archived shares
+func (s *FileKeyshareStore) Confirm(publicKey []byte, partyID uint8, epoch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.keyDir(publicKey, partyID)
+	current, err := s.current(dir)
+	if err != nil {
+		return err
+	}
+	if current == nil || !bytes.Equal(current, epoch) {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return ErrKeyshareNotFound
+		}
+		return ErrEpochNotCurrent
+	}
+	epochs, err := s.epochs(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range epochs {
+		if bytes.Equal(e, current) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, hex.EncodeToString(e)+keyshareFileSuffix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Revert makes an archived epoch current again
+func (s *FileKeyshareStore) Revert(publicKey []byte, partyID uint8, epoch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.keyDir(publicKey, partyID)
+	if epoch == nil {
+		return ErrKeyshareNotFound
+	}
+	if _, err := os.Stat(filepath.Join(dir, hex.EncodeToString(epoch)+keyshareFileSuffix)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrKeyshareNotFound
+		}
+		return err
+	}
+	return writeFileAtomic(dir, filepath.Join(dir, keyshareCurrentFile), []byte(hex.EncodeToString(epoch)))
+}
+
+// writeFileAtomic writes data to a temporary file in dir and renames it
+// to name, so that a crash never leaves a partially written file behind.
+// The directory is synced so that the rename survives a power loss.
+func writeFileAtomic(dir, name string, data []byte) error {
+	tmp, err := writeTempFile(dir, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// createFileExclusive is writeFileAtomic for a file that must not exist
+// yet: of concurrent callers for the same name only one succeeds, the
+// others get an error for which os.IsExist is true
+func createFileExclusive(dir, name string, data []byte) error {
+	tmp, err := writeTempFile(dir, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, name); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// writeTempFile writes data to a new temporary file in dir, synced to
+// disk, and returns its name
+func writeTempFile(dir string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// syncDir flushes the entries of dir, such as a rename, to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
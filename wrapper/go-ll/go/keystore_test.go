@@ -0,0 +1,214 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rawKeyshareStore exposes the byte-level operations of the built-in
+// stores, so that their epoch handling can be tested without keyshares
+type rawKeyshareStore interface {
+	KeyshareStore
+	put(pk []byte, partyID uint8, epoch, data []byte) error
+	get(pk []byte, partyID uint8, epoch []byte) ([]byte, error)
+}
+
+func testKeyshareStore(t *testing.T, store rawKeyshareStore) {
+	pk := bytes.Repeat([]byte{0x02}, 33)
+	epoch1 := bytes.Repeat([]byte{1}, 32)
+	epoch2 := bytes.Repeat([]byte{2}, 32)
+
+	if _, err := store.get(pk, 0, nil); !errors.Is(err, ErrKeyshareNotFound) {
+		t.Errorf("expected ErrKeyshareNotFound, got %v", err)
+	}
+	if err := store.put(pk, 0, epoch1, []byte("share1")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := store.put(pk, 0, epoch1, []byte("share1")); err != nil {
+		t.Errorf("storing the current share again failed: %v", err)
+	}
+	if err := store.put(pk, 1, epoch1, []byte("other party")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	// A rotation commits the new epoch and archives the previous share
+	if err := store.put(pk, 0, epoch2, []byte("share2")); err != nil {
+		t.Fatalf("failed to put rotated share: %v", err)
+	}
+	if data, err := store.get(pk, 0, nil); err != nil || string(data) != "share2" {
+		t.Errorf("expected the rotated share, got %q, %v", data, err)
+	}
+	if data, err := store.get(pk, 0, epoch1); err != nil || string(data) != "share1" {
+		t.Errorf("expected the archived share, got %q, %v", data, err)
+	}
+	if data, err := store.get(pk, 1, nil); err != nil || string(data) != "other party" {
+		t.Errorf("expected the share of party 1, got %q, %v", data, err)
+	}
+	if err := store.put(pk, 0, epoch1, []byte("other share")); err == nil {
+		t.Error("expected an error when storing other data under an archived epoch")
+	}
+
+	records, err := store.List()
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(records) != 2 || records[0].PartyID != 0 || records[1].PartyID != 1 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	if !bytes.Equal(records[0].PublicKey, pk) || !bytes.Equal(records[0].Epoch, epoch2) ||
+		len(records[0].Archived) != 1 || !bytes.Equal(records[0].Archived[0], epoch1) {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+
+	// An incomplete rotation is reverted, then redone and confirmed
+	if err := store.Revert(pk, 0, epoch1); err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+	if data, _ := store.get(pk, 0, nil); string(data) != "share1" {
+		t.Errorf("expected the reverted share, got %q", data)
+	}
+	if err := store.Confirm(pk, 0, epoch2); !errors.Is(err, ErrEpochNotCurrent) {
+		t.Errorf("expected ErrEpochNotCurrent, got %v", err)
+	}
+	if err := store.Revert(pk, 0, epoch2); err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+	if err := store.Confirm(pk, 0, epoch2); err != nil {
+		t.Fatalf("failed to confirm: %v", err)
+	}
+	if _, err := store.get(pk, 0, epoch1); !errors.Is(err, ErrKeyshareNotFound) {
+		t.Errorf("expected the archived share to be deleted, got %v", err)
+	}
+	if err := store.Revert(pk, 0, epoch1); !errors.Is(err, ErrKeyshareNotFound) {
+		t.Errorf("expected ErrKeyshareNotFound, got %v", err)
+	}
+
+	// An archived key has no current share
+	if err := store.Archive(pk, 1); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	if _, err := store.get(pk, 1, nil); !errors.Is(err, ErrKeyshareNotFound) {
+		t.Errorf("expected ErrKeyshareNotFound, got %v", err)
+	}
+	if err := store.Archive(pk, 1); !errors.Is(err, ErrKeyshareNotFound) {
+		t.Errorf("expected ErrKeyshareNotFound, got %v", err)
+	}
+	if data, err := store.get(pk, 1, epoch1); err != nil || string(data) != "other party" {
+		t.Errorf("expected the archived share, got %q, %v", data, err)
+	}
+	records, _ = store.List()
+	if len(records) != 2 || records[1].Epoch != nil || len(records[1].Archived) != 1 {
+		t.Errorf("unexpected records %+v", records)
+	}
+	if err := store.Confirm(bytes.Repeat([]byte{0x03}, 33), 0, epoch1); !errors.Is(err, ErrKeyshareNotFound) {
+		t.Errorf("expected ErrKeyshareNotFound, got %v", err)
+	}
+}
+
+func TestMemoryKeyshareStore(t *testing.T) {
+	testKeyshareStore(t, NewMemoryKeyshareStore())
+}
+
+func TestFileKeyshareStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileKeyshareStore(dir, nil)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	testKeyshareStore(t, store)
+
+	// A temporary file left by a crash is removed on open, and the
+	// committed state survives
+	pkDir := filepath.Join(dir, "020202020202020202020202020202020202020202020202020202020202020202", "0")
+	tmp := filepath.Join(pkDir, tempFilePrefix+"1")
+	if err := os.WriteFile(tmp, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewFileKeyshareStore(dir, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("expected the temporary file to be removed")
+	}
+	if data, err := store.get(bytes.Repeat([]byte{0x02}, 33), 0, nil); err != nil || string(data) != "share2" {
+		t.Errorf("expected the committed share after reopening, got %q, %v", data, err)
+	}
+
+	// A Put that stopped after writing the share but before updating
+	// CURRENT is retried
+	epoch3 := bytes.Repeat([]byte{3}, 32)
+	pk := bytes.Repeat([]byte{0x02}, 33)
+	if err := writeFileAtomic(pkDir, filepath.Join(pkDir, hex.EncodeToString(epoch3)+keyshareFileSuffix), []byte("share3")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := store.get(pk, 0, nil); err != nil || string(data) != "share2" {
+		t.Errorf("expected the committed share before the retry, got %q, %v", data, err)
+	}
+	if err := store.put(pk, 0, epoch3, []byte("other share")); err == nil {
+		t.Error("expected an error when storing other data under a stored epoch")
+	}
+	if err := store.put(pk, 0, epoch3, []byte("share3")); err != nil {
+		t.Fatalf("retrying the interrupted put failed: %v", err)
+	}
+	if data, err := store.get(pk, 0, nil); err != nil || string(data) != "share3" {
+		t.Errorf("expected the retried share, got %q, %v", data, err)
+	}
+	if records, _ := store.List(); len(records) == 0 || !bytes.Equal(records[0].Epoch, epoch3) {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	if _, err := NewFileKeyshareStore(dir, make([]byte, 16)); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}
+
+func TestKeyshareStore(t *testing.T) {
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+	pk, _ := shares[0].PublicKey()
+
+	fileStore, err := NewFileKeyshareStore(t.TempDir(), bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]KeyshareStore{"memory": NewMemoryKeyshareStore(), "sealed file": fileStore} {
+		for _, share := range shares {
+			if err := store.Put(share); err != nil {
+				t.Fatalf("%s: failed to put: %v", name, err)
+			}
+		}
+		if err := store.Put(shares[1]); err != nil {
+			t.Errorf("%s: storing the share again failed: %v", name, err)
+		}
+		got, err := store.Get(pk, 1)
+		if err != nil {
+			t.Fatalf("%s: failed to get: %v", name, err)
+		}
+		want, _ := shares[1].ToBytes()
+		if data, _ := got.ToBytes(); !bytes.Equal(data, want) {
+			t.Errorf("%s: stored share differs", name)
+		}
+		epoch, _ := shares[1].FinalSessionID()
+		if other, err := store.GetEpoch(pk, 1, epoch); err != nil {
+			t.Errorf("%s: failed to get epoch: %v", name, err)
+		} else {
+			other.Free()
+		}
+		got.Free()
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPath is returned for a derivation path that is not of the
+// form "m/0/1"
+var ErrInvalidPath = errors.New("invalid derivation path")
+
+// ErrHardenedPath is returned for a derivation path with a hardened
+// component. Child keys are derived from the public key, which only
+// works for non-hardened indexes.
+var ErrHardenedPath = errors.New("hardened derivation is not supported")
+
+// HardenedOffset is the first hardened child index
+const HardenedOffset uint32 = 1 << 31
+
+// maxPathDepth is the deepest path a BIP32 extended key can encode
+const maxPathDepth = 255
+
+// DerivationPath is a BIP32 path of non-hardened child indexes. The
+// empty path is the root key "m".
+type DerivationPath []uint32
+
+// ParsePath parses a path such as "m/44/60/0/0/0". Hardened components,
+// written with a ' or h suffix or at least HardenedOffset, fail with an
+// error that matches ErrHardenedPath; other malformed paths match
+// ErrInvalidPath.
+func ParsePath(s string) (DerivationPath, error) {
+	parts := strings.Split(s, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w %q: must start with \"m\"", ErrInvalidPath, s)
+	}
+	path := make(DerivationPath, 0, len(parts)-1)
+	for i, part := range parts[1:] {
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") || strings.HasSuffix(part, "H") {
+			return nil, fmt.Errorf("%q: component %d (%s): %w", s, i+1, part, ErrHardenedPath)
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: component %d (%s) is not a child index", ErrInvalidPath, s, i+1, part)
+		}
+		if uint32(index) >= HardenedOffset {
+			return nil, fmt.Errorf("%q: component %d (%s) is in the hardened range: %w", s, i+1, part, ErrHardenedPath)
+		}
+		path = append(path, uint32(index))
+	}
+	if len(path) > maxPathDepth {
+		return nil, fmt.Errorf("%w %q: deeper than %d", ErrInvalidPath, s, maxPathDepth)
+	}
+	return path, nil
+}
+
+// BIP44 returns the path m/44/coin/account/change/index. The levels
+// BIP44 hardens are not hardened here, because child keys are derived
+// from the public key, so the addresses differ from those of a single
+// key BIP44 wallet for the same coin.
+func BIP44(coin, account, change, index uint32) DerivationPath {
+	return DerivationPath{44, coin, account, change, index}
+}
+
+// Validate returns an error if the path has a hardened component or is
+// too deep
+func (p DerivationPath) Validate() error {
+	if len(p) > maxPathDepth {
+		return fmt.Errorf("%w: deeper than %d", ErrInvalidPath, maxPathDepth)
+	}
+	for i, index := range p {
+		if index >= HardenedOffset {
+			return fmt.Errorf("component %d (%d) is in the hardened range: %w", i+1, index, ErrHardenedPath)
+		}
+	}
+	return nil
+}
+
+// String returns the path in the form "m/0/1"
+func (p DerivationPath) String() string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, index := range p {
+		b.WriteString("/")
+		b.WriteString(strconv.FormatUint(uint64(index), 10))
+	}
+	return b.String()
+}
+
+// Parent returns the path without its last component. The root path is
+// its own parent.
+func (p DerivationPath) Parent() DerivationPath {
+	if len(p) == 0 {
+		return p
+	}
+	return p[:len(p)-1]
+}
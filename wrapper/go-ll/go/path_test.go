@@ -0,0 +1,52 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	for _, s := range []string{"m", "m/0", "m/44/60/0/0/7", "m/2147483647"} {
+		path, err := ParsePath(s)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", s, err)
+			continue
+		}
+		if path.String() != s {
+			t.Errorf("expected %q, got %q", s, path.String())
+		}
+	}
+
+	for _, s := range []string{"m/44'/60", "m/0/1h", "m/0H", "m/2147483648"} {
+		if _, err := ParsePath(s); !errors.Is(err, ErrHardenedPath) {
+			t.Errorf("expected ErrHardenedPath for %q, got %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "0/1", "M/0", "m/", "m//1", "m/-1", "m/x", "m/4294967296"} {
+		if _, err := ParsePath(s); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("expected ErrInvalidPath for %q, got %v", s, err)
+		}
+	}
+}
+
+func TestBIP44(t *testing.T) {
+	path := BIP44(60, 1, 0, 5)
+	if s := path.String(); s != "m/44/60/1/0/5" {
+		t.Errorf("unexpected path %s", s)
+	}
+	if err := path.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if s := path.Parent().String(); s != "m/44/60/1/0" {
+		t.Errorf("unexpected parent %s", s)
+	}
+	if len(DerivationPath{}.Parent()) != 0 {
+		t.Error("expected the root to be its own parent")
+	}
+	if err := BIP44(HardenedOffset+60, 0, 0, 0).Validate(); !errors.Is(err, ErrHardenedPath) {
+		t.Errorf("expected ErrHardenedPath, got %v", err)
+	}
+}
@@ -0,0 +1,556 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPresignatureNotFound is returned when the pool holds no
+// presignature with the requested final session ID
+var ErrPresignatureNotFound = errors.New("presignature not found")
+
+// PresignatureStore persists serialized presignatures for a
+// PresignaturePool. Entries are grouped by epoch (the final session ID
+// of the keyshare) and derivation path, and identified by the final
+// session ID of the presignature.
+//
+// Implementations must be safe for concurrent use. Take must be atomic
+// and must return an entry at most once, also after a restart: a taken
+// ID is remembered until its epoch expires and can not be stored again.
+type PresignatureStore interface {
+	// Put stores a presignature. It fails if the ID is already stored
+	// or has already been taken.
+	Put(epoch []byte, path string, id, data []byte) error
+	// Take removes a presignature and returns it. It returns
+	// ErrPresignatureUsed if the ID has already been taken and
+	// ErrPresignatureNotFound if it was never stored.
+	Take(epoch []byte, path string, id []byte) ([]byte, error)
+	// IDs returns the IDs available for the epoch and path, sorted.
+	IDs(epoch []byte, path string) ([][]byte, error)
+	// Expire removes every entry that does not belong to the epoch.
+	Expire(epoch []byte) error
+}
+
+type memoryEntryKey struct {
+	epoch string
+	path  string
+	id    string
+}
+
+// MemoryPresignatureStore is a PresignatureStore that keeps entries in
+// memory. Single use is only guaranteed for the lifetime of the process.
+type MemoryPresignatureStore struct {
+	mu      sync.Mutex
+	entries map[memoryEntryKey][]byte
+	used    map[memoryEntryKey]bool
+}
+
+// NewMemoryPresignatureStore creates an empty in-memory store
+func NewMemoryPresignatureStore() *MemoryPresignatureStore {
+	return &MemoryPresignatureStore{
+		entries: make(map[memoryEntryKey][]byte),
+		used:    make(map[memoryEntryKey]bool),
+	}
+}
+
+// Put stores a presignature
+func (s *MemoryPresignatureStore) Put(epoch []byte, path string, id, data []byte) error {
+	key := memoryEntryKey{string(epoch), path, string(id)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used[key] {
+		return ErrPresignatureUsed
+	}
+	if _, ok := s.entries[key]; ok {
+		return errors.New("presignature already stored")
+	}
+	s.entries[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Take removes a presignature and returns it
+func (s *MemoryPresignatureStore) Take(epoch []byte, path string, id []byte) ([]byte, error) {
+	key := memoryEntryKey{string(epoch), path, string(id)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used[key] {
+		return nil, ErrPresignatureUsed
+	}
+	data, ok := s.entries[key]
+	if !ok {
+		return nil, ErrPresignatureNotFound
+	}
+	delete(s.entries, key)
+	s.used[key] = true
+	return data, nil
+}
+
+// IDs returns the IDs available for the epoch and path
+func (s *MemoryPresignatureStore) IDs(epoch []byte, path string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([][]byte, 0)
+	for key := range s.entries {
+		if key.epoch == string(epoch) && key.path == path {
+			ids = append(ids, []byte(key.id))
+		}
+	}
+	sortIDs(ids)
+	return ids, nil
+}
+
+// Expire removes every entry that does not belong to the epoch
+func (s *MemoryPresignatureStore) Expire(epoch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.entries {
+		if key.epoch != string(epoch) {
+			delete(s.entries, key)
+		}
+	}
+	for key := range s.used {
+		if key.epoch != string(epoch) {
+			delete(s.used, key)
+		}
+	}
+	return nil
+}
+
+const (
+	presignatureFileSuffix = ".pre"
+	presignatureUsedSuffix = ".used"
+)
+
+// FilePresignatureStore is a PresignatureStore that keeps one file per
+// presignature under a directory:
+//
+//	<dir>/<hex epoch>/<hex sha256(path)>/<hex id>.pre
+//
+// Take links the file to <hex id>.used before reading it, which fails if
+// the .used file exists, so only one caller can ever obtain it. It then
+// removes the .pre file and empties the .used one, which is kept as a
+// tombstone until the epoch expires. Put creates the .pre file
+// exclusively, so it never replaces an entry.
+type FilePresignatureStore struct {
+	dir string
+}
+
+// NewFilePresignatureStore opens a store in dir, creating the directory
+// if needed. Presignatures left in a .used file or a temporary file by a
+// process that stopped in the middle of Take or Put are erased.
+func NewFilePresignatureStore(dir string) (*FilePresignatureStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), tempFilePrefix) {
+			return os.Remove(name)
+		}
+		if strings.HasSuffix(name, presignatureUsedSuffix) {
+			// A Take that stopped after the link may leave the .pre file
+			pre := strings.TrimSuffix(name, presignatureUsedSuffix) + presignatureFileSuffix
+			if err := os.Remove(pre); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if info.Size() > 0 {
+				return os.Truncate(name, 0)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FilePresignatureStore{dir: dir}, nil
+}
+
+func (s *FilePresignatureStore) pathDir(epoch []byte, path string) string {
+	h := sha256.Sum256([]byte(path))
+	return filepath.Join(s.dir, hex.EncodeToString(epoch), hex.EncodeToString(h[:]))
+}
+
+// Put stores a presignature
+func (s *FilePresignatureStore) Put(epoch []byte, path string, id, data []byte) error {
+	dir := s.pathDir(epoch, path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, hex.EncodeToString(id))
+	if _, err := os.Stat(base + presignatureUsedSuffix); err == nil {
+		return ErrPresignatureUsed
+	}
+	if err := createFileExclusive(dir, base+presignatureFileSuffix, data); err != nil {
+		if os.IsExist(err) {
+			return errors.New("presignature already stored")
+		}
+		return err
+	}
+	// A Take may have run between the check above and the link; its
+	// tombstone keeps the entry from being handed out again, and the
+	// file is removed
+	if _, err := os.Stat(base + presignatureUsedSuffix); err == nil {
+		os.Remove(base + presignatureFileSuffix)
+		return ErrPresignatureUsed
+	}
+	return nil
+}
+
+// Take removes a presignature and returns it
+func (s *FilePresignatureStore) Take(epoch []byte, path string, id []byte) ([]byte, error) {
+	dir := s.pathDir(epoch, path)
+	base := filepath.Join(dir, hex.EncodeToString(id))
+	pre, used := base+presignatureFileSuffix, base+presignatureUsedSuffix
+	if err := os.Link(pre, used); err != nil {
+		if os.IsExist(err) {
+			return nil, ErrPresignatureUsed
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if _, err := os.Stat(used); err == nil {
+			return nil, ErrPresignatureUsed
+		}
+		return nil, ErrPresignatureNotFound
+	}
+	// A Put that saw the tombstone may already have removed the file
+	if err := os.Remove(pre); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// The tombstone must be on disk before the presignature is handed
+	// out, or a power loss could leave only the .pre file
+	if err := syncDir(dir); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(used)
+	if terr := os.Truncate(used, 0); err == nil {
+		err = terr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// IDs returns the IDs available for the epoch and path
+func (s *FilePresignatureStore) IDs(epoch []byte, path string) ([][]byte, error) {
+	entries, err := os.ReadDir(s.pathDir(epoch, path))
+	if os.IsNotExist(err) {
+		return [][]byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, presignatureFileSuffix) {
+			continue
+		}
+		id, err := hex.DecodeString(strings.TrimSuffix(name, presignatureFileSuffix))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids, nil
+}
+
+// Expire removes every entry that does not belong to the epoch
+func (s *FilePresignatureStore) Expire(epoch []byte) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	keep := hex.EncodeToString(epoch)
+	for _, entry := range entries {
+		if entry.Name() == keep {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortIDs(ids [][]byte) {
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i], ids[j]) < 0
+	})
+}
+
+// PresignatureGenerator runs the interactive rounds of the sign protocol
+// together with the other parties and returns this party's
+// presignature, for example with SignSession.PreSignature. The other
+// parties must run their generators at the same time.
+type PresignatureGenerator func(ctx context.Context, keyshare *Keyshare, chainPath string) (*PreSignature, error)
+
+// PresignaturePool keeps presignatures for one keyshare and derivation
+// path and hands out each of them exactly once.
+//
+// Presignatures are identified by their final session ID, which is the
+// same for every party that computed them. To sign, one party picks an
+// ID from IDs and every party takes the presignature with that ID.
+// When the keyshare is rotated, call Rotate: entries computed with the
+// previous keyshare expire.
+type PresignaturePool struct {
+	store     PresignatureStore
+	chainPath string
+	generate  PresignatureGenerator
+
+	mu       sync.Mutex
+	keyshare *Keyshare
+	epoch    []byte
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPresignaturePool creates a pool for the keyshare and derivation
+// path. Entries of the store that belong to another keyshare epoch are
+// removed. The pool does not take ownership of the keyshare.
+func NewPresignaturePool(keyshare *Keyshare, chainPath string, store PresignatureStore, generate PresignatureGenerator) (*PresignaturePool, error) {
+	if store == nil {
+		return nil, errors.New("nil store")
+	}
+	p := &PresignaturePool{
+		store:     store,
+		chainPath: chainPath,
+		generate:  generate,
+		wake:      make(chan struct{}, 1),
+	}
+	if err := p.Rotate(keyshare); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Rotate switches the pool to a new keyshare, such as the result of a
+// key rotation. Presignatures of the previous keyshare expire.
+func (p *PresignaturePool) Rotate(keyshare *Keyshare) error {
+	if keyshare == nil {
+		return errors.New("nil keyshare")
+	}
+	epoch, err := keyshare.FinalSessionID()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.store.Expire(epoch); err != nil {
+		return err
+	}
+	p.keyshare = keyshare
+	p.epoch = epoch
+	return nil
+}
+
+// Add stores a presignature computed with the pool's keyshare and
+// derivation path. A presignature of another party, key or path is
+// refused. The presignature is freed.
+func (p *PresignaturePool) Add(pre *PreSignature) error {
+	p.mu.Lock()
+	epoch := p.epoch
+	p.mu.Unlock()
+	return p.add(epoch, pre)
+}
+
+func (p *PresignaturePool) add(epoch []byte, pre *PreSignature) error {
+	defer pre.Free()
+	id, err := pre.FinalSessionID()
+	if err != nil {
+		return err
+	}
+	pk, err := pre.PublicKey()
+	if err != nil {
+		return err
+	}
+	data, err := pre.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !bytes.Equal(epoch, p.epoch) {
+		return errors.New("keyshare rotated while generating presignature")
+	}
+	if pre.PartyID() != p.keyshare.PartyID() {
+		return errors.New("presignature belongs to another party")
+	}
+	want, _, err := p.keyshare.DerivePublicKey(p.chainPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pk, want) {
+		return errors.New("presignature belongs to another key or derivation path")
+	}
+	return p.store.Put(p.epoch, p.chainPath, id, data)
+}
+
+// IDs returns the final session IDs of the available presignatures
+func (p *PresignaturePool) IDs() ([][]byte, error) {
+	p.mu.Lock()
+	epoch := p.epoch
+	p.mu.Unlock()
+	return p.store.IDs(epoch, p.chainPath)
+}
+
+// Len returns the number of available presignatures
+func (p *PresignaturePool) Len() (int, error) {
+	ids, err := p.IDs()
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// Take removes the presignature with the given final session ID from the
+// pool and returns it. Every ID is handed out at most once; taking it
+// again fails with ErrPresignatureUsed.
+func (p *PresignaturePool) Take(id []byte) (*PreSignature, error) {
+	p.mu.Lock()
+	epoch := p.epoch
+	p.mu.Unlock()
+
+	data, err := p.store.Take(epoch, p.chainPath, id)
+	if err != nil {
+		return nil, err
+	}
+	p.signal()
+
+	pre, err := NewPreSignatureFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := pre.FinalSessionID()
+	if err != nil || !bytes.Equal(stored, id) {
+		pre.Free()
+		return nil, errors.New("presignature does not match its ID")
+	}
+	return pre, nil
+}
+
+// Fill generates presignatures until at least n are available
+func (p *PresignaturePool) Fill(ctx context.Context, n int) error {
+	if p.generate == nil {
+		return errors.New("pool has no generator")
+	}
+	for {
+		count, err := p.Len()
+		if err != nil {
+			return err
+		}
+		if count >= n {
+			return nil
+		}
+		if err := p.generateOne(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *PresignaturePool) generateOne(ctx context.Context) error {
+	p.mu.Lock()
+	keyshare, epoch := p.keyshare, p.epoch
+	p.mu.Unlock()
+
+	pre, err := p.generate(ctx, keyshare, p.chainPath)
+	if err != nil {
+		return err
+	}
+	if pre == nil {
+		return errors.New("generator returned nil presignature")
+	}
+	return p.add(epoch, pre)
+}
+
+// Start fills the pool in the background, keeping at least target
+// presignatures available. Generation errors are passed to onError, if
+// not nil, and generation is retried after retryDelay or after the next
+// Take. Call Stop to end it.
+func (p *PresignaturePool) Start(target int, retryDelay time.Duration, onError func(error)) error {
+	if p.generate == nil {
+		return errors.New("pool has no generator")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return errors.New("pool already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go p.run(ctx, target, retryDelay, onError, p.done)
+	return nil
+}
+
+func (p *PresignaturePool) run(ctx context.Context, target int, retryDelay time.Duration, onError func(error), done chan struct{}) {
+	defer close(done)
+	for {
+		err := p.Fill(ctx, target)
+		if ctx.Err() != nil {
+			return
+		}
+		var timer *time.Timer
+		var retry <-chan time.Time
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			timer = time.NewTimer(retryDelay)
+			retry = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-p.wake:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Stop ends background generation started with Start and waits for it
+// to finish
+func (p *PresignaturePool) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (p *PresignaturePool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testPresignatureStore(t *testing.T, store PresignatureStore) {
+	epoch := bytes.Repeat([]byte{1}, 32)
+	path := "m/44/60/0/0/0"
+	id := bytes.Repeat([]byte{2}, 32)
+
+	if err := store.Put(epoch, path, id, []byte("pre")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := store.Put(epoch, path, id, []byte("pre")); err == nil {
+		t.Error("expected error when storing the same ID twice")
+	}
+
+	ids, err := store.IDs(epoch, path)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(ids) != 1 || !bytes.Equal(ids[0], id) {
+		t.Errorf("unexpected IDs: %x", ids)
+	}
+	if ids, _ := store.IDs(epoch, "m"); len(ids) != 0 {
+		t.Errorf("expected no IDs for another path, got %d", len(ids))
+	}
+
+	data, err := store.Take(epoch, path, id)
+	if err != nil {
+		t.Fatalf("failed to take: %v", err)
+	}
+	if string(data) != "pre" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	if _, err := store.Take(epoch, path, id); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed, got %v", err)
+	}
+	if err := store.Put(epoch, path, id, []byte("pre")); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed when storing a taken ID, got %v", err)
+	}
+	if _, err := store.Take(epoch, path, []byte{3}); !errors.Is(err, ErrPresignatureNotFound) {
+		t.Errorf("expected ErrPresignatureNotFound, got %v", err)
+	}
+
+	// Entries of other epochs expire.
+	if err := store.Put(epoch, path, []byte{4}, []byte("pre")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := store.Expire(bytes.Repeat([]byte{5}, 32)); err != nil {
+		t.Fatalf("failed to expire: %v", err)
+	}
+	if ids, _ := store.IDs(epoch, path); len(ids) != 0 {
+		t.Errorf("expected no IDs after expiry, got %d", len(ids))
+	}
+}
+
+func TestMemoryPresignatureStore(t *testing.T) {
+	testPresignatureStore(t, NewMemoryPresignatureStore())
+}
+
+func TestFilePresignatureStore(t *testing.T) {
+	store, err := NewFilePresignatureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	testPresignatureStore(t, store)
+}
+
+func TestFilePresignatureStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+	epoch := bytes.Repeat([]byte{1}, 32)
+	id := []byte{2}
+
+	store, err := NewFilePresignatureStore(dir)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := store.Put(epoch, "m", id, []byte("pre")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if _, err := store.Take(epoch, "m", id); err != nil {
+		t.Fatalf("failed to take: %v", err)
+	}
+
+	store, err = NewFilePresignatureStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, err := store.Take(epoch, "m", id); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed after restart, got %v", err)
+	}
+	if err := store.Put(epoch, "m", id, []byte("pre")); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed after restart, got %v", err)
+	}
+}
+
+func TestFilePresignatureStoreConcurrentPut(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFilePresignatureStore(dir)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	epoch := bytes.Repeat([]byte{1}, 32)
+
+	// Retried Puts race with Takes of the same ID; every ID must be
+	// handed out at most once
+	for n := 0; n < 20; n++ {
+		id := []byte{byte(n)}
+		var mu sync.Mutex
+		taken := 0
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 5; k++ {
+					store.Put(epoch, "m", id, []byte("pre"))
+					if _, err := store.Take(epoch, "m", id); err == nil {
+						mu.Lock()
+						taken++
+						mu.Unlock()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if taken != 1 {
+			t.Fatalf("ID %d taken %d times", n, taken)
+		}
+	}
+
+	// A .pre file next to a tombstone is never handed out, and is
+	// removed on restart
+	pre := filepath.Join(store.pathDir(epoch, "m"), hex.EncodeToString([]byte{0})+presignatureFileSuffix)
+	if err := os.WriteFile(pre, []byte("pre"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Take(epoch, "m", []byte{0}); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed, got %v", err)
+	}
+	if _, err := NewFilePresignatureStore(dir); err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, err := os.Stat(pre); !os.IsNotExist(err) {
+		t.Error("expected the .pre file to be removed on restart")
+	}
+}
+
+func TestPresignaturePool(t *testing.T) {
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	path := "m"
+	pools := make([]*PresignaturePool, len(shares))
+	for i, share := range shares {
+		store, err := NewFilePresignatureStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to open store: %v", err)
+		}
+		pools[i], err = NewPresignaturePool(share, path, store, nil)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+	}
+
+	// Compute two presignatures jointly and add them to every pool.
+	for n := 0; n < 2; n++ {
+		parties := make([]signer, len(shares))
+		for i, share := range shares {
+			parties[i], err = NewSignSession(share, path, nil)
+			if err != nil {
+				t.Fatalf("failed to create sign session: %v", err)
+			}
+		}
+		if err := runPresign(parties, func() error { return nil }); err != nil {
+			t.Fatalf("presign failed: %v", err)
+		}
+		for i, party := range parties {
+			pre, err := party.(*SignSession).PreSignature()
+			if err != nil {
+				t.Fatalf("failed to extract presignature: %v", err)
+			}
+			if err := pools[i].Add(pre); err != nil {
+				t.Fatalf("failed to add presignature: %v", err)
+			}
+		}
+	}
+
+	// A presignature for another derivation path is refused
+	parties := make([]signer, len(shares))
+	for i, share := range shares {
+		parties[i], err = NewSignSession(share, "m/1", nil)
+		if err != nil {
+			t.Fatalf("failed to create sign session: %v", err)
+		}
+		defer parties[i].Free()
+	}
+	if err := runPresign(parties, func() error { return nil }); err != nil {
+		t.Fatalf("presign failed: %v", err)
+	}
+	other, err := parties[0].(*SignSession).PreSignature()
+	if err != nil {
+		t.Fatalf("failed to extract presignature: %v", err)
+	}
+	if err := pools[0].Add(other); err == nil {
+		t.Error("expected an error for a presignature of another path")
+	}
+
+	ids, err := pools[0].IDs()
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 presignatures, got %d", len(ids))
+	}
+
+	// Every party takes the presignature the first party picked.
+	messageHash := bytes.Repeat([]byte{7}, 32)
+	partials := make([]*PartialSignature, len(pools))
+	msgs := make([]*Message, len(pools))
+	for i, pool := range pools {
+		pre, err := pool.Take(ids[0])
+		if err != nil {
+			t.Fatalf("party %d: failed to take: %v", i, err)
+		}
+		partials[i], msgs[i], err = pre.Sign(messageHash)
+		if err != nil {
+			t.Fatalf("party %d: failed to sign: %v", i, err)
+		}
+	}
+	for i, partial := range partials {
+		if _, err := partial.Combine(filterMessages(msgs, uint8(i))); err != nil {
+			t.Fatalf("party %d: failed to combine: %v", i, err)
+		}
+	}
+
+	if _, err := pools[0].Take(ids[0]); !errors.Is(err, ErrPresignatureUsed) {
+		t.Errorf("expected ErrPresignatureUsed, got %v", err)
+	}
+
+	// Rotating the keyshare expires the remaining presignature.
+	rotated, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range rotated {
+			share.Free()
+		}
+	}()
+	if err := pools[0].Rotate(rotated[0]); err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if n, _ := pools[0].Len(); n != 0 {
+		t.Errorf("expected empty pool after rotation, got %d", n)
+	}
+	if _, err := pools[0].Take(ids[1]); !errors.Is(err, ErrPresignatureNotFound) {
+		t.Errorf("expected ErrPresignatureNotFound after rotation, got %v", err)
+	}
+}
+
+// transportPresignGenerator runs the interactive sign rounds with the
+// other parties over transport, as each party's generator would
+func transportPresignGenerator(transport Transport) PresignatureGenerator {
+	return func(ctx context.Context, keyshare *Keyshare, chainPath string) (*PreSignature, error) {
+		return RunPresign(ctx, transport, "presign", keyshare, chainPath, nil)
+	}
+}
+
+func TestPresignaturePoolTwoParties(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	// One pool per party in this process, filled together.
+	net := newChanNetwork(len(shares))
+	pools := make([]*PresignaturePool, len(shares))
+	for i, share := range shares {
+		pools[i], err = NewPresignaturePool(share, "m", NewMemoryPresignatureStore(), transportPresignGenerator(net[i]))
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+	}
+	errs := make([]error, len(pools))
+	var wg sync.WaitGroup
+	for i, pool := range pools {
+		wg.Add(1)
+		go func(i int, pool *PresignaturePool) {
+			defer wg.Done()
+			errs[i] = pool.Fill(ctx, 2)
+		}(i, pool)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("party %d: failed to fill: %v", i, err)
+		}
+	}
+
+	ids, err := pools[0].IDs()
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if other, _ := pools[1].IDs(); len(ids) != 2 || len(other) != 2 {
+		t.Fatalf("expected 2 presignatures in every pool, got %d and %d", len(ids), len(other))
+	}
+	pubKey, err := shares[0].PublicKey()
+	if err != nil {
+		t.Fatalf("failed to get public key: %v", err)
+	}
+
+	// Both parties take and use every presignature, through Combine.
+	for n, id := range ids {
+		messageHash := bytes.Repeat([]byte{byte(n + 1)}, 32)
+		partials := make([]*PartialSignature, len(pools))
+		msgs := make([]*Message, len(pools))
+		for i, pool := range pools {
+			pre, err := pool.Take(id)
+			if err != nil {
+				t.Fatalf("party %d: failed to take: %v", i, err)
+			}
+			partials[i], msgs[i], err = pre.Sign(messageHash)
+			if err != nil {
+				t.Fatalf("party %d: failed to sign: %v", i, err)
+			}
+		}
+		signatures := make([][]byte, len(partials))
+		for i, partial := range partials {
+			sig, err := partial.Combine(filterMessages(msgs, uint8(i)))
+			if err != nil {
+				t.Fatalf("party %d: failed to combine: %v", i, err)
+			}
+			if err := VerifySignature(pubKey, messageHash, sig); err != nil {
+				t.Errorf("party %d: signature does not verify: %v", i, err)
+			}
+			signatures[i] = sig.Bytes()
+		}
+		if !bytes.Equal(signatures[0], signatures[1]) {
+			t.Error("signatures from different parties do not match")
+		}
+		for i, pool := range pools {
+			if _, err := pool.Take(id); !errors.Is(err, ErrPresignatureUsed) {
+				t.Errorf("party %d: expected ErrPresignatureUsed, got %v", i, err)
+			}
+		}
+	}
+}
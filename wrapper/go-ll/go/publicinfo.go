@@ -0,0 +1,72 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import "crypto/sha256"
+
+// PublicInfo holds the non-secret fields of a keyshare. It is the same
+// for all parties of a key, except for PartyID.
+type PublicInfo struct {
+	// PublicKey is the 33-byte compressed public key
+	PublicKey []byte
+	// RootChainCode is the 32-byte BIP32 chain code of the root key
+	RootChainCode []byte
+	// Fingerprint identifies the key, see KeyFingerprint
+	Fingerprint []byte
+	// FinalSessionID changes with every rotation or recovery
+	FinalSessionID []byte
+	PartyID        uint8
+	Threshold      uint8
+	TotalParties   uint8
+	// Ranks holds the rank of every party, indexed by party ID
+	Ranks []uint8
+	// PublicShares holds the 33-byte public share of every party,
+	// indexed by party ID
+	PublicShares [][]byte
+}
+
+// KeyFingerprint returns the 32-byte fingerprint of a key, the SHA-256
+// hash of its compressed public key and root chain code. It does not
+// change when the key is rotated.
+func KeyFingerprint(publicKey, rootChainCode []byte) []byte {
+	h := sha256.New()
+	h.Write(publicKey)
+	h.Write(rootChainCode)
+	return h.Sum(nil)
+}
+
+// PublicInfo returns the non-secret fields of the keyshare
+func (k *Keyshare) PublicInfo() (*PublicInfo, error) {
+	pk, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	chainCode, err := k.RootChainCode()
+	if err != nil {
+		return nil, err
+	}
+	finalSessionID, err := k.FinalSessionID()
+	if err != nil {
+		return nil, err
+	}
+	ranks, err := k.Ranks()
+	if err != nil {
+		return nil, err
+	}
+	shares, err := k.PublicShares()
+	if err != nil {
+		return nil, err
+	}
+	return &PublicInfo{
+		PublicKey:      pk,
+		RootChainCode:  chainCode,
+		Fingerprint:    KeyFingerprint(pk, chainCode),
+		FinalSessionID: finalSessionID,
+		PartyID:        k.PartyID(),
+		Threshold:      k.Threshold(),
+		TotalParties:   k.Participants(),
+		Ranks:          ranks,
+		PublicShares:   shares,
+	}, nil
+}
@@ -0,0 +1,347 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Transport carries protocol messages between the parties of a session.
+//
+// Send delivers msg to party *msg.ToID, or to every other party of the
+// session if msg.ToID is nil. Receive returns the next message addressed
+// to this party in the session, either directly or as a broadcast.
+// Messages from the same sender must be received in the order they were
+// sent; messages from different senders may be interleaved.
+type Transport interface {
+	Send(ctx context.Context, sessionID string, msg *Message) error
+	Receive(ctx context.Context, sessionID string) (*Message, error)
+}
+
+// signer is implemented by both SignSession and SignSessionOTVariant.
+type signer interface {
+	CreateFirstMessage() (*Message, error)
+	HandleMessages(msgs []*Message, seed []byte) ([]*Message, error)
+	LastMessage(messageHash []byte) (*Message, error)
+	Combine(msgs []*Message) (*Signature, error)
+	ToBytes() ([]byte, error)
+	Free()
+}
+
+// roundSeed derives the seed of one protocol round from the seed of the
+// session, or returns nil if the session uses random seeds
+func roundSeed(seed []byte, round byte) []byte {
+	if len(seed) == 0 {
+		return nil
+	}
+	h := sha256.New()
+	h.Write(seed)
+	h.Write([]byte{round})
+	return h.Sum(nil)
+}
+
+// inbox buffers messages received ahead of their round. A fast party may
+// send its next round before a slow one has sent the current round.
+type inbox struct {
+	transport Transport
+	sessionID string
+	self      uint8
+	peers     []uint8 // nil until known
+	count     int     // number of peers
+	pending   map[uint8][]*Message
+}
+
+func newInbox(transport Transport, sessionID string, self uint8, count int) *inbox {
+	return &inbox{
+		transport: transport,
+		sessionID: sessionID,
+		self:      self,
+		count:     count,
+		pending:   make(map[uint8][]*Message),
+	}
+}
+
+func (in *inbox) isPeer(id uint8) bool {
+	if in.peers == nil {
+		_, ok := in.pending[id]
+		return ok || len(in.pending) < in.count
+	}
+	for _, p := range in.peers {
+		if p == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (in *inbox) ready(perPeer int) bool {
+	if in.peers == nil {
+		if len(in.pending) < in.count {
+			return false
+		}
+		peers := make([]uint8, 0, in.count)
+		for id := range in.pending {
+			peers = append(peers, id)
+		}
+		sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+		in.peers = peers
+	}
+	for _, id := range in.peers {
+		if len(in.pending[id]) < perPeer {
+			return false
+		}
+	}
+	return true
+}
+
+// receive waits for perPeer messages from every peer and returns them
+// ordered by sender. If the peers are not known yet, the first count
+// distinct senders become the peers.
+func (in *inbox) receive(ctx context.Context, perPeer int) ([]*Message, error) {
+	for !in.ready(perPeer) {
+		msg, err := in.transport.Receive(ctx, in.sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if msg == nil || msg.FromID == in.self {
+			continue
+		}
+		if msg.ToID != nil && *msg.ToID != in.self {
+			return nil, fmt.Errorf("message from party %d addressed to party %d", msg.FromID, *msg.ToID)
+		}
+		if !in.isPeer(msg.FromID) {
+			return nil, fmt.Errorf("unexpected message from party %d", msg.FromID)
+		}
+		in.pending[msg.FromID] = append(in.pending[msg.FromID], msg)
+	}
+
+	msgs := make([]*Message, 0, len(in.peers)*perPeer)
+	for _, id := range in.peers {
+		msgs = append(msgs, in.pending[id][:perPeer]...)
+		in.pending[id] = in.pending[id][perPeer:]
+	}
+	return msgs, nil
+}
+
+func sendAll(ctx context.Context, transport Transport, sessionID string, msgs []*Message) error {
+	for _, msg := range msgs {
+		if err := transport.Send(ctx, sessionID, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunKeygen runs a complete distributed key generation over the
+// transport and returns this party's keyshare. seed is optional; when
+// it is set, the seeds of all rounds are derived from it.
+func RunKeygen(ctx context.Context, transport Transport, sessionID string, participants, threshold, partyID uint8, seed []byte) (*Keyshare, error) {
+	session, err := NewKeygenSession(participants, threshold, partyID, seed)
+	if err != nil {
+		return nil, err
+	}
+	return RunKeygenSession(ctx, transport, sessionID, session, participants, seed)
+}
+
+// RunKeygenSession drives a keygen session that has not started yet,
+// such as one returned by InitKeyRotation, InitKeyRecovery or
+// InitLostShareRecovery, to completion over the transport. The session
+// is consumed. seed is optional and only used for the rounds; the seed
+// of the session itself is given to its constructor.
+func RunKeygenSession(ctx context.Context, transport Transport, sessionID string, session *KeygenSession, participants uint8, seed []byte) (*Keyshare, error) {
+	if session == nil {
+		return nil, errors.New("nil session")
+	}
+	defer session.Free()
+	if participants < 2 {
+		return nil, errors.New("invalid number of participants")
+	}
+
+	// Round 1: broadcast the first message
+	msg1, err := session.CreateFirstMessage()
+	if err != nil {
+		return nil, err
+	}
+	self := msg1.FromID
+	in := newInbox(transport, sessionID, self, int(participants)-1)
+	in.peers = make([]uint8, 0, participants-1)
+	for id := uint8(0); id < participants; id++ {
+		if id != self {
+			in.peers = append(in.peers, id)
+		}
+	}
+	if err := transport.Send(ctx, sessionID, msg1); err != nil {
+		return nil, err
+	}
+	batch, err := in.receive(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round 2: answer with P2P messages and broadcast the commitment
+	msg2, err := session.HandleMessages(batch, nil, roundSeed(seed, 2))
+	if err != nil {
+		return nil, err
+	}
+	commitment, err := session.CalculateCommitment2()
+	if err != nil {
+		return nil, err
+	}
+	if err := sendAll(ctx, transport, sessionID, msg2); err != nil {
+		return nil, err
+	}
+	if err := transport.Send(ctx, sessionID, &Message{FromID: self, Payload: commitment, Header: session.header()}); err != nil {
+		return nil, err
+	}
+	batch, err = in.receive(ctx, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split the P2P messages of round 2 from the broadcast commitments
+	commitments := make([]byte, int(participants)*32)
+	copy(commitments[int(self)*32:], commitment)
+	p2p := make([]*Message, 0, len(batch)/2)
+	for _, msg := range batch {
+		if msg.ToID != nil {
+			p2p = append(p2p, msg)
+			continue
+		}
+		if len(msg.Payload) != 32 || int(msg.FromID) >= int(participants) {
+			return nil, fmt.Errorf("invalid commitment from party %d", msg.FromID)
+		}
+		copy(commitments[int(msg.FromID)*32:], msg.Payload)
+	}
+
+	// Round 3
+	msg3, err := session.HandleMessages(p2p, nil, roundSeed(seed, 3))
+	if err != nil {
+		return nil, err
+	}
+	if err := sendAll(ctx, transport, sessionID, msg3); err != nil {
+		return nil, err
+	}
+	batch, err = in.receive(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round 4: verify the commitments
+	msg4, err := session.HandleMessages(batch, commitments, roundSeed(seed, 4))
+	if err != nil {
+		return nil, err
+	}
+	if err := sendAll(ctx, transport, sessionID, msg4); err != nil {
+		return nil, err
+	}
+	batch, err = in.receive(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round 5
+	if _, err := session.HandleMessages(batch, nil, roundSeed(seed, 5)); err != nil {
+		return nil, err
+	}
+	return session.Keyshare()
+}
+
+// RunSign runs a complete signing session over the transport and returns
+// the signature of the 32-byte message hash. Exactly threshold parties
+// must take part. seed is optional; when it is set, the seeds of all
+// rounds are derived from it.
+func RunSign(ctx context.Context, transport Transport, sessionID string, keyshare *Keyshare, chainPath string, messageHash []byte, seed []byte) (*Signature, error) {
+	session, err := NewSignSession(keyshare, chainPath, seed)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Free()
+	return runSign(ctx, transport, sessionID, session, keyshare, messageHash, seed)
+}
+
+// RunSignOTVariant is RunSign for the OT variant of the sign protocol
+func RunSignOTVariant(ctx context.Context, transport Transport, sessionID string, keyshare *Keyshare, chainPath string, messageHash []byte, seed []byte) (*Signature, error) {
+	session, err := NewSignSessionOTVariant(keyshare, chainPath, seed)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Free()
+	return runSign(ctx, transport, sessionID, session, keyshare, messageHash, seed)
+}
+
+// RunPresign runs the interactive rounds of the sign protocol over the
+// transport and returns this party's presignature, to sign a message
+// hash later with PreSignature.Sign. Exactly threshold parties must take
+// part.
+func RunPresign(ctx context.Context, transport Transport, sessionID string, keyshare *Keyshare, chainPath string, seed []byte) (*PreSignature, error) {
+	session, err := NewSignSession(keyshare, chainPath, seed)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Free()
+	if _, err := presignRounds(ctx, transport, sessionID, session, keyshare, seed); err != nil {
+		return nil, err
+	}
+	return session.PreSignature()
+}
+
+// presignRounds runs the rounds up to the presignature and returns the
+// inbox for the messages of the last round
+func presignRounds(ctx context.Context, transport Transport, sessionID string, session signer, keyshare *Keyshare, seed []byte) (*inbox, error) {
+	in := newInbox(transport, sessionID, keyshare.PartyID(), int(keyshare.Threshold())-1)
+
+	// Round 1: broadcast the first message
+	msg1, err := session.CreateFirstMessage()
+	if err != nil {
+		return nil, err
+	}
+	if err := transport.Send(ctx, sessionID, msg1); err != nil {
+		return nil, err
+	}
+
+	// Rounds 2 and 3 answer with P2P messages, round 4 creates the
+	// presignature
+	for round := byte(2); round <= 4; round++ {
+		batch, err := in.receive(ctx, 1)
+		if err != nil {
+			return nil, err
+		}
+		out, err := session.HandleMessages(batch, roundSeed(seed, round))
+		if err != nil {
+			return nil, err
+		}
+		if err := sendAll(ctx, transport, sessionID, out); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+func runSign(ctx context.Context, transport Transport, sessionID string, session signer, keyshare *Keyshare, messageHash []byte, seed []byte) (*Signature, error) {
+	if len(messageHash) != 32 {
+		return nil, errors.New("message hash must be 32 bytes")
+	}
+	in, err := presignRounds(ctx, transport, sessionID, session, keyshare, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Broadcast the partial signature and combine
+	last, err := session.LastMessage(messageHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := transport.Send(ctx, sessionID, last); err != nil {
+		return nil, err
+	}
+	batch, err := in.receive(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	return session.Combine(batch)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chanTransport connects the parties of a test through channels. Each
+// party has one endpoint; sessionID is ignored.
+type chanTransport struct {
+	self  uint8
+	inbox []chan *Message
+}
+
+func newChanNetwork(n int) []*chanTransport {
+	inbox := make([]chan *Message, n)
+	for i := range inbox {
+		inbox[i] = make(chan *Message, 64)
+	}
+	net := make([]*chanTransport, n)
+	for i := range net {
+		net[i] = &chanTransport{self: uint8(i), inbox: inbox}
+	}
+	return net
+}
+
+func (c *chanTransport) Send(ctx context.Context, sessionID string, msg *Message) error {
+	for i, ch := range c.inbox {
+		if uint8(i) == c.self || (msg.ToID != nil && *msg.ToID != uint8(i)) {
+			continue
+		}
+		select {
+		case ch <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *chanTransport) Receive(ctx context.Context, sessionID string) (*Message, error) {
+	select {
+	case msg := <-c.inbox[c.self]:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// sliceTransport returns queued messages in order
+type sliceTransport struct {
+	msgs []*Message
+}
+
+func (s *sliceTransport) Send(ctx context.Context, sessionID string, msg *Message) error {
+	return nil
+}
+
+func (s *sliceTransport) Receive(ctx context.Context, sessionID string) (*Message, error) {
+	if len(s.msgs) == 0 {
+		return nil, fmt.Errorf("no more messages")
+	}
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return msg, nil
+}
+
+func TestInboxBuffersEarlyMessages(t *testing.T) {
+	to := uint8(0)
+	transport := &sliceTransport{msgs: []*Message{
+		{FromID: 2, Payload: []byte("2a")},
+		{FromID: 2, ToID: &to, Payload: []byte("2b")},
+		{FromID: 0, Payload: []byte("echo")},
+		{FromID: 1, Payload: []byte("1a")},
+		{FromID: 1, ToID: &to, Payload: []byte("1b")},
+	}}
+	in := newInbox(transport, "s", 0, 2)
+
+	first, err := in.receive(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if len(first) != 2 || string(first[0].Payload) != "1a" || string(first[1].Payload) != "2a" {
+		t.Errorf("unexpected first round: %v", first)
+	}
+
+	second, err := in.receive(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if len(second) != 2 || string(second[0].Payload) != "1b" || string(second[1].Payload) != "2b" {
+		t.Errorf("unexpected second round: %v", second)
+	}
+
+	transport.msgs = []*Message{{FromID: 3}}
+	if _, err := in.receive(context.Background(), 1); err == nil {
+		t.Error("expected error for a message from an unknown party")
+	}
+}
+
+func TestRunKeygenAndSign(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n, threshold := 3, 2
+	net := newChanNetwork(n)
+	shares := make([]*Keyshare, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shares[i], errs[i] = RunKeygen(ctx, net[i], "keygen", uint8(n), uint8(threshold), uint8(i), nil)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("party %d: keygen failed: %v", i, err)
+		}
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	messageHash := bytes.Repeat([]byte{1}, 32)
+	net = newChanNetwork(threshold)
+	signatures := make([][]byte, threshold)
+	for i := 0; i < threshold; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sig, err := RunSign(ctx, net[i], "sign", shares[i], "m", messageHash, nil)
+			if err == nil {
+				signatures[i] = sig.Bytes()
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < threshold; i++ {
+		if errs[i] != nil {
+			t.Fatalf("party %d: sign failed: %v", i, errs[i])
+		}
+	}
+	if !bytes.Equal(signatures[0], signatures[1]) {
+		t.Error("signatures from different parties do not match")
+	}
+}
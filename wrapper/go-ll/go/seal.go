@@ -0,0 +1,273 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	// ErrInvalidSealed is returned for data that is not a sealed keyshare
+	// or uses an unsupported version or KDF
+	ErrInvalidSealed = errors.New("invalid sealed keyshare")
+	// ErrWrongKey is returned when a sealed keyshare is opened with the
+	// wrong passphrase or key. A modified salt or KDF parameter derives
+	// another key and is also reported as ErrWrongKey.
+	ErrWrongKey = errors.New("wrong passphrase or key")
+	// ErrTampered is returned when the key is right but the metadata or
+	// the ciphertext of a sealed keyshare has been modified
+	ErrTampered = errors.New("sealed keyshare has been tampered with")
+)
+
+// Sealed keyshare layout, version 1. Everything before the ciphertext is
+// the additional data of the AEAD.
+//
+//	magic "DKSEAL" | version (1) | kdf (1)
+//	argon2 time (4) | argon2 memory KiB (4) | argon2 threads (1) | salt (16)
+//	public key (33) | party ID (1) | threshold (1) | total parties (1)
+//	key check (16) | nonce (24) | XChaCha20-Poly1305 ciphertext
+const (
+	sealVersion = 1
+
+	kdfNone     = 0 // a raw 32-byte key
+	kdfArgon2id = 1
+
+	sealSaltLen     = 16
+	sealCheckLen    = 16
+	sealMetadataLen = 33 + 3
+	sealHeaderLen   = len(sealMagic) + 2 + 9 + sealSaltLen + sealMetadataLen + sealCheckLen + chacha20poly1305.NonceSizeX
+
+	// Limits on the Argon2id parameters accepted when opening, so that a
+	// crafted envelope can not exhaust memory or time. They leave room
+	// for a few times the cost of Seal.
+	maxArgon2Time   = 8
+	maxArgon2Memory = 256 << 10 // 256 MiB
+)
+
+const sealMagic = "DKSEAL"
+
+// argon2Params are the Argon2id parameters of Seal, the second
+// recommended option of RFC 9106
+var argon2Params = struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}{time: 3, memory: 64 << 10, threads: 4}
+
+// SealedMetadata holds the public fields of a sealed keyshare. They are
+// readable without the key, and authenticated when the keyshare is
+// opened.
+type SealedMetadata struct {
+	// PublicKey is the 33-byte compressed public key
+	PublicKey    []byte
+	PartyID      uint8
+	Threshold    uint8
+	TotalParties uint8
+}
+
+// Seal encrypts the keyshare with a key derived from passphrase by
+// Argon2id. The result can be stored as is and opened with OpenKeyshare.
+func (k *Keyshare) Seal(passphrase []byte) ([]byte, error) {
+	return k.seal(kdfArgon2id, passphrase)
+}
+
+// SealWithKey encrypts the keyshare with a 32-byte key, e.g. one held in
+// a KMS. The result is opened with OpenKeyshareWithKey.
+func (k *Keyshare) SealWithKey(key []byte) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	return k.seal(kdfNone, key)
+}
+
+func (k *Keyshare) seal(kdf byte, secret []byte) ([]byte, error) {
+	pk, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := k.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(plaintext)
+	meta := &SealedMetadata{PublicKey: pk, PartyID: k.PartyID(), Threshold: k.Threshold(), TotalParties: k.Participants()}
+	return sealPayload(kdf, secret, meta, plaintext)
+}
+
+// sealPayload builds a version 1 envelope around plaintext
+func sealPayload(kdf byte, secret []byte, meta *SealedMetadata, plaintext []byte) ([]byte, error) {
+	if len(meta.PublicKey) != 33 {
+		return nil, errors.New("public key must be 33 bytes")
+	}
+	header := make([]byte, sealHeaderLen)
+	copy(header, sealMagic)
+	off := len(sealMagic)
+	header[off] = sealVersion
+	header[off+1] = kdf
+	off += 2
+	if kdf == kdfArgon2id {
+		binary.BigEndian.PutUint32(header[off:], argon2Params.time)
+		binary.BigEndian.PutUint32(header[off+4:], argon2Params.memory)
+		header[off+8] = argon2Params.threads
+	}
+	off += 9
+	if _, err := rand.Read(header[off : off+sealSaltLen]); err != nil {
+		return nil, err
+	}
+	off += sealSaltLen
+	copy(header[off:], meta.PublicKey)
+	header[off+33] = meta.PartyID
+	header[off+34] = meta.Threshold
+	header[off+35] = meta.TotalParties
+	off += sealMetadataLen
+	nonce := header[sealHeaderLen-chacha20poly1305.NonceSizeX:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	aead, check, err := sealKeys(header, secret)
+	if err != nil {
+		return nil, err
+	}
+	copy(header[off:], check)
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// sealKeys derives the AEAD and the key check value of an envelope from
+// its header and the passphrase or key
+func sealKeys(header, secret []byte) (aead cipher.AEAD, check []byte, err error) {
+	off := len(sealMagic) + 1
+	kdf := header[off]
+	params := header[off+1 : off+10]
+	salt := header[off+10 : off+10+sealSaltLen]
+
+	var master []byte
+	switch kdf {
+	case kdfNone:
+		master = append([]byte{}, secret...)
+	case kdfArgon2id:
+		time := binary.BigEndian.Uint32(params)
+		memory := binary.BigEndian.Uint32(params[4:])
+		threads := params[8]
+		if time == 0 || time > maxArgon2Time || memory < 8*uint32(threads) || memory > maxArgon2Memory || threads == 0 {
+			return nil, nil, fmt.Errorf("%w: bad Argon2id parameters", ErrInvalidSealed)
+		}
+		master = argon2.IDKey(secret, salt, time, memory, threads, 32)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown KDF %d", ErrInvalidSealed, kdf)
+	}
+	defer zero(master)
+
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("dkls keyshare seal v1 encryption"))
+	encKey := mac.Sum(nil)
+	defer zero(encKey)
+	mac = hmac.New(sha256.New, master)
+	mac.Write([]byte("dkls keyshare seal v1 key check"))
+	mac.Write(salt)
+	check = mac.Sum(nil)[:sealCheckLen]
+
+	aead, err = chacha20poly1305.NewX(encKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, check, nil
+}
+
+// OpenKeyshare decrypts a keyshare sealed with Seal. It returns
+// ErrWrongKey for a wrong passphrase and ErrTampered if the envelope was
+// modified.
+func OpenKeyshare(sealed, passphrase []byte) (*Keyshare, error) {
+	return openKeyshare(sealed, kdfArgon2id, passphrase)
+}
+
+// OpenKeyshareWithKey decrypts a keyshare sealed with SealWithKey
+func OpenKeyshareWithKey(sealed, key []byte) (*Keyshare, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	return openKeyshare(sealed, kdfNone, key)
+}
+
+func openKeyshare(sealed []byte, kdf byte, secret []byte) (*Keyshare, error) {
+	plaintext, err := openPayload(sealed, kdf, secret)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(plaintext)
+	return NewKeyshareFromBytes(plaintext)
+}
+
+// openPayload checks the key and authenticates and decrypts an envelope
+func openPayload(sealed []byte, kdf byte, secret []byte) ([]byte, error) {
+	if err := checkSealedHeader(sealed); err != nil {
+		return nil, err
+	}
+	header := sealed[:sealHeaderLen]
+	if got := header[len(sealMagic)+1]; got != kdf {
+		if got == kdfArgon2id {
+			return nil, fmt.Errorf("%w: sealed with a passphrase", ErrWrongKey)
+		}
+		return nil, fmt.Errorf("%w: sealed with a key", ErrWrongKey)
+	}
+
+	aead, check, err := sealKeys(header, secret)
+	if err != nil {
+		return nil, err
+	}
+	checkOff := sealHeaderLen - chacha20poly1305.NonceSizeX - sealCheckLen
+	if subtle.ConstantTimeCompare(check, header[checkOff:checkOff+sealCheckLen]) != 1 {
+		return nil, ErrWrongKey
+	}
+	nonce := header[sealHeaderLen-chacha20poly1305.NonceSizeX:]
+	plaintext, err := aead.Open(nil, nonce, sealed[sealHeaderLen:], header)
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plaintext, nil
+}
+
+func checkSealedHeader(sealed []byte) error {
+	if len(sealed) < sealHeaderLen+chacha20poly1305.Overhead || string(sealed[:len(sealMagic)]) != sealMagic {
+		return ErrInvalidSealed
+	}
+	if v := sealed[len(sealMagic)]; v != sealVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSealed, v)
+	}
+	return nil
+}
+
+// ReadSealedMetadata returns the public fields of a sealed keyshare
+// without decrypting it. They can not be trusted until the keyshare is
+// opened.
+func ReadSealedMetadata(sealed []byte) (*SealedMetadata, error) {
+	if err := checkSealedHeader(sealed); err != nil {
+		return nil, err
+	}
+	off := len(sealMagic) + 2 + 9 + sealSaltLen
+	meta := sealed[off : off+sealMetadataLen]
+	return &SealedMetadata{
+		PublicKey:    append([]byte{}, meta[:33]...),
+		PartyID:      meta[33],
+		Threshold:    meta[34],
+		TotalParties: meta[35],
+	}, nil
+}
+
+// zero overwrites secret material that is no longer needed
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// cheapArgon2 lowers the Argon2id cost for the duration of a test
+func cheapArgon2(t *testing.T) {
+	saved := argon2Params
+	argon2Params.time, argon2Params.memory, argon2Params.threads = 1, 64, 1
+	t.Cleanup(func() { argon2Params = saved })
+}
+
+func TestSealPayload(t *testing.T) {
+	cheapArgon2(t)
+	meta := &SealedMetadata{PublicKey: bytes.Repeat([]byte{0x02}, 33), PartyID: 1, Threshold: 2, TotalParties: 3}
+	plaintext := []byte("keyshare")
+	passphrase := []byte("correct horse battery staple")
+
+	sealed, err := sealPayload(kdfArgon2id, passphrase, meta, plaintext)
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Error("plaintext is visible in the envelope")
+	}
+	other, _ := sealPayload(kdfArgon2id, passphrase, meta, plaintext)
+	if bytes.Equal(sealed, other) {
+		t.Error("expected a fresh salt and nonce for every seal")
+	}
+
+	got, err := ReadSealedMetadata(sealed)
+	if err != nil {
+		t.Fatalf("failed to read metadata: %v", err)
+	}
+	if !bytes.Equal(got.PublicKey, meta.PublicKey) || got.PartyID != 1 || got.Threshold != 2 || got.TotalParties != 3 {
+		t.Errorf("unexpected metadata %+v", got)
+	}
+
+	opened, err := openPayload(sealed, kdfArgon2id, passphrase)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("failed to open: %q, %v", opened, err)
+	}
+	if _, err := openPayload(sealed, kdfArgon2id, []byte("wrong")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+	if _, err := openPayload(sealed, kdfNone, make([]byte, 32)); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey for a key, got %v", err)
+	}
+
+	metaOff := len(sealMagic) + 2 + 9 + sealSaltLen
+	tampered := map[string]int{
+		"party ID":   metaOff + 33,
+		"public key": metaOff + 1,
+		"ciphertext": sealHeaderLen + 1,
+		"tag":        len(sealed) - 1,
+	}
+	for name, i := range tampered {
+		modified := append([]byte{}, sealed...)
+		modified[i] ^= 1
+		if _, err := openPayload(modified, kdfArgon2id, passphrase); !errors.Is(err, ErrTampered) {
+			t.Errorf("%s: expected ErrTampered, got %v", name, err)
+		}
+	}
+
+	invalid := map[string][]byte{
+		"truncated": sealed[:sealHeaderLen],
+		"magic":     append([]byte("X"), sealed[1:]...),
+		"version":   append(append([]byte{}, sealed[:len(sealMagic)]...), append([]byte{2}, sealed[len(sealMagic)+1:]...)...),
+	}
+	for name, data := range invalid {
+		if _, err := openPayload(data, kdfArgon2id, passphrase); !errors.Is(err, ErrInvalidSealed) {
+			t.Errorf("%s: expected ErrInvalidSealed, got %v", name, err)
+		}
+	}
+
+	// Argon2id parameters beyond the limits are refused before deriving
+	for name, param := range map[string]struct {
+		off   int
+		value uint32
+	}{
+		"time":   {len(sealMagic) + 2, maxArgon2Time + 1},
+		"memory": {len(sealMagic) + 6, maxArgon2Memory + 1},
+	} {
+		costly := append([]byte{}, sealed...)
+		binary.BigEndian.PutUint32(costly[param.off:], param.value)
+		if _, err := openPayload(costly, kdfArgon2id, passphrase); !errors.Is(err, ErrInvalidSealed) {
+			t.Errorf("expected ErrInvalidSealed for Argon2id %s beyond the limit, got %v", name, err)
+		}
+	}
+}
+
+func TestSealPayloadWithKey(t *testing.T) {
+	meta := &SealedMetadata{PublicKey: bytes.Repeat([]byte{0x03}, 33)}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	sealed, err := sealPayload(kdfNone, key, meta, []byte("keyshare"))
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	if opened, err := openPayload(sealed, kdfNone, key); err != nil || string(opened) != "keyshare" {
+		t.Fatalf("failed to open: %q, %v", opened, err)
+	}
+	if _, err := openPayload(sealed, kdfNone, make([]byte, 32)); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+	if _, err := openPayload(sealed, kdfArgon2id, key); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey for a passphrase, got %v", err)
+	}
+	if _, err := OpenKeyshareWithKey(sealed, key[:16]); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}
+
+func TestKeyshareSeal(t *testing.T) {
+	cheapArgon2(t)
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	sealed, err := shares[1].Seal([]byte("passphrase"))
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	meta, err := ReadSealedMetadata(sealed)
+	if err != nil {
+		t.Fatalf("failed to read metadata: %v", err)
+	}
+	pk, _ := shares[1].PublicKey()
+	if !bytes.Equal(meta.PublicKey, pk) || meta.PartyID != 1 || meta.Threshold != 2 || meta.TotalParties != 2 {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+
+	opened, err := OpenKeyshare(sealed, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer opened.Free()
+	want, _ := shares[1].ToBytes()
+	if got, _ := opened.ToBytes(); !bytes.Equal(got, want) {
+		t.Error("opened keyshare differs from the sealed one")
+	}
+	if _, err := OpenKeyshare(sealed, []byte("Passphrase")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+
+	shares[0].Free()
+	if _, err := shares[0].Seal([]byte("passphrase")); err != ErrHandleFreed {
+		t.Errorf("expected ErrHandleFreed, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+// Package secp256k1 encodes and verifies the ECDSA signatures produced by
+// the dkls package. It is pure Go, so it can be used by relays and
+// auditors without linking the Rust library. Verification only handles
+// public data and is not constant time; do not use the curve arithmetic
+// here with secrets.
+package secp256k1
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	// P is the order of the base field
+	P, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	// N is the order of the group
+	N, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+
+	gx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	gy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+
+	halfN  = new(big.Int).Rsh(N, 1)
+	curveB = big.NewInt(7)
+	// sqrtExp is (P + 1) / 4; P = 3 mod 4, so a^sqrtExp is a square root
+	sqrtExp = new(big.Int).Rsh(new(big.Int).Add(P, big.NewInt(1)), 2)
+)
+
+// ErrInvalidPublicKey is returned for a public key that is not a 33-byte
+// compressed or 65-byte uncompressed SEC1 encoding of a curve point
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
+// PublicKey is a point on the curve in affine coordinates
+type PublicKey struct {
+	X, Y *big.Int
+}
+
+// ParsePublicKey parses a 33-byte compressed or 65-byte uncompressed
+// SEC1 public key and checks that it is on the curve
+func ParsePublicKey(b []byte) (*PublicKey, error) {
+	switch {
+	case len(b) == 33 && (b[0] == 2 || b[0] == 3):
+		x := new(big.Int).SetBytes(b[1:])
+		if x.Cmp(P) >= 0 {
+			return nil, ErrInvalidPublicKey
+		}
+		y := new(big.Int).Exp(curveRHS(x), sqrtExp, P)
+		if new(big.Int).Exp(y, big.NewInt(2), P).Cmp(curveRHS(x)) != 0 {
+			return nil, ErrInvalidPublicKey
+		}
+		if y.Bit(0) != uint(b[0]&1) {
+			y.Sub(P, y)
+		}
+		return &PublicKey{X: x, Y: y}, nil
+	case len(b) == 65 && b[0] == 4:
+		x := new(big.Int).SetBytes(b[1:33])
+		y := new(big.Int).SetBytes(b[33:])
+		if x.Cmp(P) >= 0 || y.Cmp(P) >= 0 || !isOnCurve(x, y) {
+			return nil, ErrInvalidPublicKey
+		}
+		return &PublicKey{X: x, Y: y}, nil
+	}
+	return nil, ErrInvalidPublicKey
+}
+
+// SerializeCompressed returns the 33-byte SEC1 encoding of the key
+func (k *PublicKey) SerializeCompressed() []byte {
+	out := make([]byte, 33)
+	out[0] = 2 | byte(k.Y.Bit(0))
+	k.X.FillBytes(out[1:])
+	return out
+}
+
+// SerializeUncompressed returns the 65-byte SEC1 encoding of the key
+func (k *PublicKey) SerializeUncompressed() []byte {
+	out := make([]byte, 65)
+	out[0] = 4
+	k.X.FillBytes(out[1:33])
+	k.Y.FillBytes(out[33:])
+	return out
+}
+
+// curveRHS returns x^3 + 7 mod P
+func curveRHS(x *big.Int) *big.Int {
+	r := new(big.Int).Exp(x, big.NewInt(3), P)
+	r.Add(r, curveB)
+	return r.Mod(r, P)
+}
+
+func isOnCurve(x, y *big.Int) bool {
+	y2 := new(big.Int).Mul(y, y)
+	return y2.Mod(y2, P).Cmp(curveRHS(x)) == 0
+}
+
+// jacobian is a point (X / Z^2, Y / Z^3). Z = 0 is the point at infinity.
+type jacobian struct {
+	x, y, z *big.Int
+}
+
+func fromAffine(x, y *big.Int) *jacobian {
+	return &jacobian{new(big.Int).Set(x), new(big.Int).Set(y), big.NewInt(1)}
+}
+
+func (p *jacobian) isInfinity() bool {
+	return p.z.Sign() == 0
+}
+
+// affine returns the affine coordinates, or nil for the point at infinity
+func (p *jacobian) affine() (x, y *big.Int) {
+	if p.isInfinity() {
+		return nil, nil
+	}
+	zInv := new(big.Int).ModInverse(p.z, P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x = new(big.Int).Mul(p.x, zInv2)
+	x.Mod(x, P)
+	y = new(big.Int).Mul(p.y, zInv2.Mul(zInv2, zInv))
+	y.Mod(y, P)
+	return x, y
+}
+
+func (p *jacobian) double() *jacobian {
+	if p.isInfinity() || p.y.Sign() == 0 {
+		return &jacobian{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	// dbl-2009-l for a = 0
+	a := new(big.Int).Mul(p.x, p.x)
+	b := new(big.Int).Mul(p.y, p.y)
+	c := new(big.Int).Mul(b, b)
+	d := new(big.Int).Add(p.x, b)
+	d.Mul(d, d).Sub(d, a).Sub(d, c).Lsh(d, 1)
+	e := new(big.Int).Mul(a, big.NewInt(3))
+	f := new(big.Int).Mul(e, e)
+
+	x := new(big.Int).Sub(f, new(big.Int).Lsh(d, 1))
+	x.Mod(x, P)
+	y := new(big.Int).Sub(d, x)
+	y.Mul(y, e).Sub(y, c.Lsh(c, 3))
+	y.Mod(y, P)
+	z := new(big.Int).Mul(p.y, p.z)
+	z.Lsh(z, 1).Mod(z, P)
+	return &jacobian{x, y, z}
+}
+
+func (p *jacobian) add(q *jacobian) *jacobian {
+	if p.isInfinity() {
+		return q
+	}
+	if q.isInfinity() {
+		return p
+	}
+	// add-2007-bl
+	z1z1 := new(big.Int).Mul(p.z, p.z)
+	z1z1.Mod(z1z1, P)
+	z2z2 := new(big.Int).Mul(q.z, q.z)
+	z2z2.Mod(z2z2, P)
+	u1 := new(big.Int).Mul(p.x, z2z2)
+	u1.Mod(u1, P)
+	u2 := new(big.Int).Mul(q.x, z1z1)
+	u2.Mod(u2, P)
+	s1 := new(big.Int).Mul(p.y, q.z)
+	s1.Mul(s1, z2z2).Mod(s1, P)
+	s2 := new(big.Int).Mul(q.y, p.z)
+	s2.Mul(s2, z1z1).Mod(s2, P)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, P)
+	r := new(big.Int).Sub(s2, s1)
+	r.Mod(r, P)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return p.double()
+		}
+		return &jacobian{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	r.Lsh(r, 1)
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	j := new(big.Int).Mul(h, i)
+	v := new(big.Int).Mul(u1, i)
+
+	x := new(big.Int).Mul(r, r)
+	x.Sub(x, j).Sub(x, new(big.Int).Lsh(v, 1)).Mod(x, P)
+	y := new(big.Int).Sub(v, x)
+	y.Mul(y, r).Sub(y, new(big.Int).Lsh(s1.Mul(s1, j), 1)).Mod(y, P)
+	z := new(big.Int).Add(p.z, q.z)
+	z.Mul(z, z).Sub(z, z1z1).Sub(z, z2z2).Mul(z, h).Mod(z, P)
+	return &jacobian{x, y, z}
+}
+
+// mulAdd returns a*G + b*Q by Shamir's trick
+func mulAdd(a *big.Int, q *PublicKey, b *big.Int) *jacobian {
+	g := fromAffine(gx, gy)
+	qj := fromAffine(q.X, q.Y)
+	gq := g.add(qj)
+	acc := &jacobian{new(big.Int), new(big.Int), new(big.Int)}
+	for i := 255; i >= 0; i-- {
+		acc = acc.double()
+		switch {
+		case a.Bit(i) == 1 && b.Bit(i) == 1:
+			acc = acc.add(gq)
+		case a.Bit(i) == 1:
+			acc = acc.add(g)
+		case b.Bit(i) == 1:
+			acc = acc.add(qj)
+		}
+	}
+	return acc
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package secp256k1
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature does not verify
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrHighS is returned for a signature whose S is in the upper half
+	// of the group order. Combine always returns the low-S form.
+	ErrHighS = errors.New("signature S is not in low form")
+	// ErrInvalidDER is returned for a malformed or non-canonical DER
+	// signature
+	ErrInvalidDER = errors.New("invalid DER signature")
+)
+
+// Signature is an ECDSA signature over secp256k1, as returned by Combine.
+// S is always in the lower half of the curve order.
+type Signature struct {
+	// R and S are 32 bytes each
+	R, S []byte
+	// RecoveryID recovers PublicKey from the signature and message hash.
+	// It is 0 or 1, except with negligible probability.
+	RecoveryID uint8
+	// PublicKey is the 33-byte compressed public key, derived for the
+	// chain path of the session, that the signature was verified against
+	PublicKey []byte
+}
+
+// Bytes returns the 65-byte signature [R || S || V] with V the recovery
+// ID, as taken by Ethereum's ecrecover precompile after adding 27 to V
+func (sig *Signature) Bytes() []byte {
+	out := make([]byte, 0, 65)
+	out = append(out, sig.R...)
+	out = append(out, sig.S...)
+	return append(out, sig.RecoveryID)
+}
+
+// Compact returns the 64-byte signature [R || S]
+func (sig *Signature) Compact() []byte {
+	out := make([]byte, 0, 64)
+	out = append(out, sig.R...)
+	return append(out, sig.S...)
+}
+
+// EIP155V returns the v value of a legacy Ethereum transaction signed
+// for chainID, recovery ID + 35 + 2 * chainID
+func (sig *Signature) EIP155V(chainID uint64) uint64 {
+	return uint64(sig.RecoveryID) + 35 + 2*chainID
+}
+
+// DER returns the ASN.1 DER encoding SEQUENCE { r INTEGER, s INTEGER }
+func (sig *Signature) DER() []byte {
+	r := derInteger(sig.R)
+	s := derInteger(sig.S)
+	out := make([]byte, 0, 6+len(r)+len(s))
+	out = append(out, 0x30, byte(4+len(r)+len(s)))
+	out = append(out, 0x02, byte(len(r)))
+	out = append(out, r...)
+	out = append(out, 0x02, byte(len(s)))
+	return append(out, s...)
+}
+
+// derInteger returns the minimal big-endian encoding of a positive
+// integer, with a leading zero if the high bit is set
+func derInteger(b []byte) []byte {
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	if len(b) == 0 {
+		return []byte{0}
+	}
+	if b[0]&0x80 != 0 {
+		return append([]byte{0}, b...)
+	}
+	return b
+}
+
+// ParseDERSignature parses a strict DER encoded signature. R and S of
+// the result are padded to 32 bytes; the recovery ID and public key are
+// not part of the encoding and are left empty.
+func ParseDERSignature(der []byte) (*Signature, error) {
+	if len(der) < 8 || der[0] != 0x30 || int(der[1]) != len(der)-2 {
+		return nil, ErrInvalidDER
+	}
+	r, rest, err := parseDERInteger(der[2:])
+	if err != nil {
+		return nil, err
+	}
+	s, rest, err := parseDERInteger(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidDER
+	}
+	return &Signature{R: r, S: s}, nil
+}
+
+// parseDERInteger parses one INTEGER in the range [1, N) and returns it
+// as 32 bytes along with the remaining input
+func parseDERInteger(b []byte) (value, rest []byte, err error) {
+	if len(b) < 3 || b[0] != 0x02 {
+		return nil, nil, ErrInvalidDER
+	}
+	n := int(b[1])
+	if n == 0 || n > 33 || len(b) < 2+n {
+		return nil, nil, ErrInvalidDER
+	}
+	v := b[2 : 2+n]
+	// Negative, or not minimally encoded
+	if v[0]&0x80 != 0 || (n > 1 && v[0] == 0 && v[1]&0x80 == 0) {
+		return nil, nil, ErrInvalidDER
+	}
+	i := new(big.Int).SetBytes(v)
+	if i.Sign() == 0 || i.Cmp(N) >= 0 {
+		return nil, nil, ErrInvalidDER
+	}
+	return i.FillBytes(make([]byte, 32)), b[2+n:], nil
+}
+
+// VerifySignature checks the signature of the 32-byte hash against a
+// 33-byte compressed or 65-byte uncompressed SEC1 public key. Signatures
+// with a high S are rejected with ErrHighS, as they are by Bitcoin and
+// Ethereum.
+func VerifySignature(pubKey, hash []byte, sig *Signature) error {
+	key, err := ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	if len(hash) != 32 {
+		return errors.New("hash must be 32 bytes")
+	}
+	if sig == nil || len(sig.R) != 32 || len(sig.S) != 32 {
+		return ErrInvalidSignature
+	}
+	r := new(big.Int).SetBytes(sig.R)
+	s := new(big.Int).SetBytes(sig.S)
+	if r.Sign() == 0 || r.Cmp(N) >= 0 || s.Sign() == 0 || s.Cmp(N) >= 0 {
+		return ErrInvalidSignature
+	}
+	if s.Cmp(halfN) > 0 {
+		return ErrHighS
+	}
+
+	z := new(big.Int).SetBytes(hash)
+	w := new(big.Int).ModInverse(s, N)
+	u1 := z.Mul(z, w)
+	u1.Mod(u1, N)
+	u2 := w.Mul(r, w)
+	u2.Mod(u2, N)
+	x, _ := mulAdd(u1, key, u2).affine()
+	if x == nil || x.Mod(x, N).Cmp(r) != 0 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// RecoverPublicKey returns the 33-byte compressed public key that signed
+// the 32-byte hash, using the recovery ID of the signature
+func RecoverPublicKey(hash []byte, sig *Signature) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.New("hash must be 32 bytes")
+	}
+	if sig == nil || len(sig.R) != 32 || len(sig.S) != 32 || sig.RecoveryID > 3 {
+		return nil, ErrInvalidSignature
+	}
+	r := new(big.Int).SetBytes(sig.R)
+	s := new(big.Int).SetBytes(sig.S)
+	if r.Sign() == 0 || r.Cmp(N) >= 0 || s.Sign() == 0 || s.Cmp(N) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	// R is the point with x = r (+ N) and the parity of the recovery ID
+	x := new(big.Int).Set(r)
+	if sig.RecoveryID&2 != 0 {
+		x.Add(x, N)
+	}
+	compressed := make([]byte, 33)
+	compressed[0] = 2 | sig.RecoveryID&1
+	if x.Cmp(P) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+	x.FillBytes(compressed[1:])
+	point, err := ParsePublicKey(compressed)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	// Q = r^-1 (s R - z G)
+	rInv := new(big.Int).ModInverse(r, N)
+	u1 := new(big.Int).SetBytes(hash)
+	u1.Neg(u1).Mul(u1, rInv).Mod(u1, N)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, N)
+	qx, qy := mulAdd(u1, point, u2).affine()
+	if qx == nil {
+		return nil, ErrInvalidSignature
+	}
+	return (&PublicKey{X: qx, Y: qy}).SerializeCompressed(), nil
+}
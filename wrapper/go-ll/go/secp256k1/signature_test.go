@@ -0,0 +1,181 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package secp256k1
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Signature of SHA-256("dkls23") computed with an independent
+// implementation
+const (
+	testPubKey       = "02085fe2ca7a5758957ea811bd8e743d9cee6bc20072f1470a888c43a1091a8e8b"
+	testPubKeyUncomp = "04085fe2ca7a5758957ea811bd8e743d9cee6bc20072f1470a888c43a1091a8e8b6c24b94641fa44c371b757127afcba3652e884413ada780be21d0585190deeac"
+	testHash         = "af600590ba37d1650da7339a4a9f38335485f6deaff60eab31a8bdd922c99f04"
+	testR            = "f7a376241533602bcc43beeaddcfd1bec1fdce7fa3c7f4b8e9b01c579690e5d8"
+	testS            = "71c318c8efd12250873aed2752028c0337c5f57a1dd13882cf0c3f6436c300a1"
+)
+
+func testSignature(t *testing.T) *Signature {
+	return &Signature{R: mustHex(t, testR), S: mustHex(t, testS)}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := ParsePublicKey(mustHex(t, testPubKey))
+	if err != nil {
+		t.Fatalf("failed to parse compressed key: %v", err)
+	}
+	if got := hex.EncodeToString(key.SerializeUncompressed()); got != testPubKeyUncomp {
+		t.Errorf("unexpected uncompressed key %s", got)
+	}
+	key, err = ParsePublicKey(mustHex(t, testPubKeyUncomp))
+	if err != nil {
+		t.Fatalf("failed to parse uncompressed key: %v", err)
+	}
+	if got := hex.EncodeToString(key.SerializeCompressed()); got != testPubKey {
+		t.Errorf("unexpected compressed key %s", got)
+	}
+
+	bad := [][]byte{
+		nil,
+		mustHex(t, testPubKey)[1:],
+		append([]byte{4}, mustHex(t, testPubKey)[1:]...),
+		// x = 5 is not on the curve
+		append([]byte{2}, new(big.Int).SetInt64(5).FillBytes(make([]byte, 32))...),
+		// x >= P
+		append([]byte{2}, P.Bytes()...),
+	}
+	offCurve := mustHex(t, testPubKeyUncomp)
+	offCurve[64] ^= 1
+	bad = append(bad, offCurve)
+	for _, b := range bad {
+		if _, err := ParsePublicKey(b); !errors.Is(err, ErrInvalidPublicKey) {
+			t.Errorf("expected ErrInvalidPublicKey for %x, got %v", b, err)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	hash := mustHex(t, testHash)
+	for _, pk := range []string{testPubKey, testPubKeyUncomp} {
+		if err := VerifySignature(mustHex(t, pk), hash, testSignature(t)); err != nil {
+			t.Errorf("valid signature rejected: %v", err)
+		}
+	}
+
+	otherHash := append([]byte{}, hash...)
+	otherHash[0] ^= 1
+	if err := VerifySignature(mustHex(t, testPubKey), otherHash, testSignature(t)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	// (r, N - s) is also a valid ECDSA signature, but not low-S
+	high := testSignature(t)
+	s := new(big.Int).SetBytes(high.S)
+	high.S = s.Sub(N, s).FillBytes(make([]byte, 32))
+	if err := VerifySignature(mustHex(t, testPubKey), hash, high); !errors.Is(err, ErrHighS) {
+		t.Errorf("expected ErrHighS, got %v", err)
+	}
+
+	zero := &Signature{R: make([]byte, 32), S: mustHex(t, testS)}
+	if err := VerifySignature(mustHex(t, testPubKey), hash, zero); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+	if err := VerifySignature(mustHex(t, testPubKey)[:32], hash, testSignature(t)); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("expected ErrInvalidPublicKey, got %v", err)
+	}
+}
+
+func TestRecoverPublicKey(t *testing.T) {
+	hash := mustHex(t, testHash)
+	var found int
+	for id := uint8(0); id < 2; id++ {
+		sig := testSignature(t)
+		sig.RecoveryID = id
+		pk, err := RecoverPublicKey(hash, sig)
+		if err != nil {
+			t.Fatalf("failed to recover with ID %d: %v", id, err)
+		}
+		if hex.EncodeToString(pk) == testPubKey {
+			found++
+		}
+	}
+	if found != 1 {
+		t.Errorf("expected exactly one recovery ID to recover the key, got %d", found)
+	}
+	if _, err := RecoverPublicKey(hash, &Signature{R: make([]byte, 32), S: mustHex(t, testS)}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestDER(t *testing.T) {
+	sig := testSignature(t)
+	der := sig.DER()
+	// R has its high bit set and takes a leading zero
+	want := "3045022100" + testR + "0220" + testS
+	if got := hex.EncodeToString(der); got != want {
+		t.Fatalf("unexpected DER\n got %s\nwant %s", got, want)
+	}
+	parsed, err := ParseDERSignature(der)
+	if err != nil {
+		t.Fatalf("failed to parse DER: %v", err)
+	}
+	if !bytes.Equal(parsed.R, sig.R) || !bytes.Equal(parsed.S, sig.S) {
+		t.Error("DER round trip changed the signature")
+	}
+
+	// Short integers are padded back to 32 bytes
+	short := &Signature{R: append(make([]byte, 31), 1), S: append(make([]byte, 30), 1, 2)}
+	if got := hex.EncodeToString(short.DER()); got != "300702010102020102" {
+		t.Errorf("unexpected DER %s", got)
+	}
+	parsed, err = ParseDERSignature(short.DER())
+	if err != nil || !bytes.Equal(parsed.R, short.R) || !bytes.Equal(parsed.S, short.S) {
+		t.Errorf("short round trip failed: %v", err)
+	}
+
+	for _, bad := range []string{
+		"",
+		"3045022100" + testR + "0220" + testS + "00", // trailing data
+		"3046022100" + testR + "0220" + testS,        // wrong length
+		"30440220" + testR + "0220" + testS,          // negative R
+		"30070202000102010" + "1",                    // padded R
+		"3006020100020101",                           // zero R
+	} {
+		if _, err := ParseDERSignature(mustHex(t, bad)); !errors.Is(err, ErrInvalidDER) {
+			t.Errorf("expected ErrInvalidDER for %s, got %v", bad, err)
+		}
+	}
+}
+
+func TestSignatureEncodings(t *testing.T) {
+	sig := &Signature{R: bytes.Repeat([]byte{1}, 32), S: bytes.Repeat([]byte{2}, 32), RecoveryID: 1}
+	if b := sig.Bytes(); len(b) != 65 || b[0] != 1 || b[63] != 2 || b[64] != 1 {
+		t.Errorf("unexpected 65-byte signature %x", b)
+	}
+	if b := sig.Compact(); len(b) != 64 || b[0] != 1 || b[63] != 2 {
+		t.Errorf("unexpected compact signature %x", b)
+	}
+	// Ethereum mainnet, chain ID 1
+	if v := sig.EIP155V(1); v != 38 {
+		t.Errorf("expected v 38, got %d", v)
+	}
+	sig.RecoveryID = 0
+	if v := sig.EIP155V(137); v != 309 {
+		t.Errorf("expected v 309, got %d", v)
+	}
+}
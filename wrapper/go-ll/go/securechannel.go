@@ -0,0 +1,273 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Secured payload, in place of Message.Payload:
+//
+//	version (1) | kind (1) | body | Ed25519 signature (64)
+//
+// The body of a broadcast is the payload. The body of a P2P message is
+// a 24-byte nonce followed by the payload encrypted with
+// XChaCha20-Poly1305, under a key derived from the X25519 secret of the
+// two parties and the session ID. The signature covers the session ID,
+// the sender, the recipient, the message header and the body.
+const (
+	secureVersion   = 1
+	secureSigned    = 0
+	secureEncrypted = 1
+)
+
+var secureDomain = []byte("dkls23-ll secure channel v1")
+
+// ErrUnauthenticated is returned for a message whose signature does not
+// verify or that can not be decrypted
+var ErrUnauthenticated = errors.New("unauthenticated message")
+
+// Identity is the long-term key pair of a party: an Ed25519 key that
+// signs its messages and an X25519 key that its peers encrypt to
+type Identity struct {
+	SigningKey ed25519.PrivateKey
+	// ExchangeKey is the 32-byte X25519 private key
+	ExchangeKey []byte
+}
+
+// PeerKey is the public part of an Identity, as given to the other
+// parties
+type PeerKey struct {
+	SigningKey ed25519.PublicKey
+	// ExchangeKey is the 32-byte X25519 public key
+	ExchangeKey []byte
+}
+
+// GenerateIdentity creates a random identity
+func GenerateIdentity() (*Identity, error) {
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	exchangeKey := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, exchangeKey); err != nil {
+		return nil, err
+	}
+	return &Identity{SigningKey: signingKey, ExchangeKey: exchangeKey}, nil
+}
+
+// Public returns the keys the other parties need to talk to this party
+func (id *Identity) Public() (PeerKey, error) {
+	if len(id.SigningKey) != ed25519.PrivateKeySize || len(id.ExchangeKey) != curve25519.ScalarSize {
+		return PeerKey{}, errors.New("invalid identity")
+	}
+	exchangeKey, err := curve25519.X25519(id.ExchangeKey, curve25519.Basepoint)
+	if err != nil {
+		return PeerKey{}, err
+	}
+	return PeerKey{
+		SigningKey:  id.SigningKey.Public().(ed25519.PublicKey),
+		ExchangeKey: exchangeKey,
+	}, nil
+}
+
+// SecureChannel signs and encrypts the messages of a party over an
+// untrusted relay. Broadcasts are signed; P2P messages, which carry
+// secret shares and OT material, are also encrypted to the recipient.
+// A SecureChannel is a Transport, so it can be passed to RunKeygen and
+// RunSign in place of the relay; Seal and Open serve sessions that are
+// driven by hand.
+type SecureChannel struct {
+	transport Transport
+	self      uint8
+	identity  *Identity
+	peers     map[uint8]PeerKey
+}
+
+// NewSecureChannel creates the secure channel of party self over
+// transport. peers holds the public keys of the other parties, indexed
+// by party ID. transport may be nil if only Seal and Open are used.
+func NewSecureChannel(transport Transport, self uint8, identity *Identity, peers map[uint8]PeerKey) (*SecureChannel, error) {
+	if identity == nil {
+		return nil, errors.New("nil identity")
+	}
+	if _, err := identity.Public(); err != nil {
+		return nil, err
+	}
+	keys := make(map[uint8]PeerKey, len(peers))
+	for id, peer := range peers {
+		if id == self {
+			continue
+		}
+		if len(peer.SigningKey) != ed25519.PublicKeySize || len(peer.ExchangeKey) != curve25519.PointSize {
+			return nil, fmt.Errorf("invalid keys for party %d", id)
+		}
+		keys[id] = peer
+	}
+	return &SecureChannel{transport: transport, self: self, identity: identity, peers: keys}, nil
+}
+
+// transcript returns the data signed with a secured message, before its
+// body. It is also the additional data of the encryption.
+func transcript(sessionID string, msg *Message, kind byte) []byte {
+	var n [binary.MaxVarintLen64]byte
+	out := append([]byte{}, secureDomain...)
+	out = append(out, n[:binary.PutUvarint(n[:], uint64(len(sessionID)))]...)
+	out = append(out, sessionID...)
+	to := uint8(255)
+	if msg.ToID != nil {
+		to = *msg.ToID
+	}
+	out = append(out, msg.FromID, to)
+	if h := msg.Header; h != nil {
+		out = append(out, 1, byte(h.Protocol), h.Round, byte(len(h.SessionID)))
+		out = append(out, h.SessionID...)
+	} else {
+		out = append(out, 0)
+	}
+	return append(out, secureVersion, kind)
+}
+
+// p2pKey derives the key of messages from party from to party to in the
+// session, from the X25519 secret of the two parties
+func (c *SecureChannel) p2pKey(sessionID string, peer uint8, from, to uint8) ([]byte, error) {
+	key, ok := c.peers[peer]
+	if !ok {
+		return nil, fmt.Errorf("no keys for party %d", peer)
+	}
+	secret, err := curve25519.X25519(c.identity.ExchangeKey, key.ExchangeKey)
+	if err != nil {
+		return nil, err
+	}
+	info := append(append([]byte{}, secureDomain...), from, to)
+	out := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, []byte(sessionID), info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Seal signs a message created by this party, and encrypts it if it is
+// P2P. The header of the message is authenticated as well.
+func (c *SecureChannel) Seal(sessionID string, msg *Message) (*Message, error) {
+	if msg == nil {
+		return nil, errors.New("nil message")
+	}
+	if msg.FromID != c.self {
+		return nil, fmt.Errorf("message from party %d sealed by party %d", msg.FromID, c.self)
+	}
+
+	kind := byte(secureSigned)
+	body := msg.Payload
+	if msg.ToID != nil {
+		kind = secureEncrypted
+		key, err := c.p2pKey(sessionID, *msg.ToID, c.self, *msg.ToID)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := chacha20poly1305.NewX(key)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(msg.Payload)+aead.Overhead())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		body = aead.Seal(nonce, nonce, msg.Payload, transcript(sessionID, msg, kind))
+	}
+
+	signed := append(transcript(sessionID, msg, kind), body...)
+	payload := make([]byte, 0, 2+len(body)+ed25519.SignatureSize)
+	payload = append(payload, secureVersion, kind)
+	payload = append(payload, body...)
+	payload = append(payload, ed25519.Sign(c.identity.SigningKey, signed)...)
+	return &Message{FromID: msg.FromID, ToID: msg.ToID, Payload: payload, Header: msg.Header}, nil
+}
+
+// Open verifies a message sealed by a peer and decrypts it if it is P2P.
+// A message that is not signed by the key of its sender, or P2P and not
+// addressed to this party, is rejected with ErrUnauthenticated.
+func (c *SecureChannel) Open(sessionID string, msg *Message) (*Message, error) {
+	if msg == nil {
+		return nil, errors.New("nil message")
+	}
+	peer, ok := c.peers[msg.FromID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown party %d", ErrUnauthenticated, msg.FromID)
+	}
+	p := msg.Payload
+	if len(p) < 2+ed25519.SignatureSize || p[0] != secureVersion {
+		return nil, fmt.Errorf("%w: malformed message from party %d", ErrUnauthenticated, msg.FromID)
+	}
+	kind := p[1]
+	body, sig := p[2:len(p)-ed25519.SignatureSize], p[len(p)-ed25519.SignatureSize:]
+	if kind > secureEncrypted || (kind == secureEncrypted) != (msg.ToID != nil) {
+		return nil, fmt.Errorf("%w: malformed message from party %d", ErrUnauthenticated, msg.FromID)
+	}
+	ad := transcript(sessionID, msg, kind)
+	if !ed25519.Verify(peer.SigningKey, append(append([]byte{}, ad...), body...), sig) {
+		return nil, fmt.Errorf("%w: bad signature from party %d", ErrUnauthenticated, msg.FromID)
+	}
+
+	payload := body
+	if kind == secureEncrypted {
+		if *msg.ToID != c.self {
+			return nil, fmt.Errorf("%w: message from party %d addressed to party %d", ErrUnauthenticated, msg.FromID, *msg.ToID)
+		}
+		key, err := c.p2pKey(sessionID, msg.FromID, msg.FromID, c.self)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := chacha20poly1305.NewX(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < aead.NonceSize() {
+			return nil, fmt.Errorf("%w: malformed message from party %d", ErrUnauthenticated, msg.FromID)
+		}
+		payload, err = aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], ad)
+		if err != nil {
+			return nil, fmt.Errorf("%w: can not decrypt message from party %d", ErrUnauthenticated, msg.FromID)
+		}
+	} else {
+		payload = append([]byte{}, body...)
+	}
+	return &Message{FromID: msg.FromID, ToID: msg.ToID, Payload: payload, Header: msg.Header}, nil
+}
+
+// Send seals msg and sends it over the underlying transport. It
+// implements Transport.
+func (c *SecureChannel) Send(ctx context.Context, sessionID string, msg *Message) error {
+	sealed, err := c.Seal(sessionID, msg)
+	if err != nil {
+		return err
+	}
+	return c.transport.Send(ctx, sessionID, sealed)
+}
+
+// Receive returns the next message of the underlying transport, verified
+// and decrypted. Messages of this party echoed by the relay are skipped.
+// It implements Transport.
+func (c *SecureChannel) Receive(ctx context.Context, sessionID string) (*Message, error) {
+	for {
+		msg, err := c.transport.Receive(ctx, sessionID)
+		if err != nil || msg == nil {
+			return msg, err
+		}
+		if msg.FromID != c.self {
+			return c.Open(sessionID, msg)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newSecureChannels creates an identity for each of n parties and the
+// secure channel of every party over the given transports
+func newSecureChannels(t *testing.T, transports []Transport) []*SecureChannel {
+	n := len(transports)
+	identities := make([]*Identity, n)
+	peers := make(map[uint8]PeerKey, n)
+	for i := range identities {
+		var err error
+		identities[i], err = GenerateIdentity()
+		if err != nil {
+			t.Fatalf("failed to generate identity: %v", err)
+		}
+		peers[uint8(i)], err = identities[i].Public()
+		if err != nil {
+			t.Fatalf("failed to get public keys: %v", err)
+		}
+	}
+	channels := make([]*SecureChannel, n)
+	for i := range channels {
+		var err error
+		channels[i], err = NewSecureChannel(transports[i], uint8(i), identities[i], peers)
+		if err != nil {
+			t.Fatalf("failed to create secure channel: %v", err)
+		}
+	}
+	return channels
+}
+
+func TestSecureChannelSealOpen(t *testing.T) {
+	c := newSecureChannels(t, make([]Transport, 3))
+	payload := []byte("secret share")
+	to := uint8(1)
+
+	p2p := &Message{FromID: 0, ToID: &to, Payload: payload, Header: &Header{SessionID: []byte("s"), Protocol: ProtocolKeygen, Round: 2}}
+	sealed, err := c[0].Seal("s", p2p)
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	if bytes.Contains(sealed.Payload, payload) {
+		t.Error("P2P payload is visible to the relay")
+	}
+	opened, err := c[1].Open("s", sealed)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	if !bytes.Equal(opened.Payload, payload) || opened.Header != p2p.Header {
+		t.Errorf("unexpected message %+v", opened)
+	}
+
+	broadcast, err := c[0].Seal("s", &Message{FromID: 0, Payload: payload})
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	for _, i := range []int{1, 2} {
+		if opened, err := c[i].Open("s", broadcast); err != nil || !bytes.Equal(opened.Payload, payload) {
+			t.Errorf("party %d: failed to open broadcast: %v", i, err)
+		}
+	}
+
+	rejected := func(name string, c *SecureChannel, sessionID string, msg *Message) {
+		t.Helper()
+		if _, err := c.Open(sessionID, msg); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s: expected ErrUnauthenticated, got %v", name, err)
+		}
+	}
+	rejected("other session", c[1], "t", sealed)
+	rejected("other recipient", c[2], "s", sealed)
+
+	tampered := *sealed
+	tampered.Payload = append([]byte{}, sealed.Payload...)
+	tampered.Payload[10] ^= 1
+	rejected("tampered payload", c[1], "s", &tampered)
+
+	spoofed := *broadcast
+	spoofed.FromID = 2
+	rejected("spoofed sender", c[1], "s", &spoofed)
+
+	replayed := *sealed
+	replayed.Header = &Header{SessionID: []byte("s"), Protocol: ProtocolKeygen, Round: 3}
+	rejected("other round", c[1], "s", &replayed)
+
+	redirected := *broadcast
+	redirected.ToID = &to
+	rejected("broadcast sent as P2P", c[1], "s", &redirected)
+
+	if _, err := c[1].Seal("s", &Message{FromID: 0, Payload: payload}); err == nil {
+		t.Error("expected an error for sealing another party's message")
+	}
+}
+
+func TestRunKeygenAndSignSecure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n, threshold := 3, 2
+	relay := make([]Transport, n)
+	for i, c := range newChanNetwork(n) {
+		relay[i] = c
+	}
+	channels := newSecureChannels(t, relay)
+	shares := make([]*Keyshare, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shares[i], errs[i] = RunKeygen(ctx, channels[i], "keygen", uint8(n), uint8(threshold), uint8(i), nil)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("party %d: keygen failed: %v", i, err)
+		}
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+
+	relay = relay[:threshold]
+	for i, c := range newChanNetwork(threshold) {
+		relay[i] = c
+	}
+	channels = newSecureChannels(t, relay)
+	for i := 0; i < threshold; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = RunSign(ctx, channels[i], "sign", shares[i], "m", bytes.Repeat([]byte{1}, 32), nil)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < threshold; i++ {
+		if errs[i] != nil {
+			t.Fatalf("party %d: sign failed: %v", i, errs[i])
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import "github.com/silence-laboratories/dkls23-ll/wrapper/go-ll/go/secp256k1"
+
+// Signature is an ECDSA signature over secp256k1 with its recovery ID
+// and the derived public key it verifies against. It is defined in the
+// secp256k1 package, which verifies signatures without the Rust library.
+type Signature = secp256k1.Signature
+
+// ParseDERSignature parses a strict DER encoded signature
+func ParseDERSignature(der []byte) (*Signature, error) {
+	return secp256k1.ParseDERSignature(der)
+}
+
+// VerifySignature checks the signature of the 32-byte hash against a
+// 33- or 65-byte SEC1 public key, rejecting high-S signatures
+func VerifySignature(pubKey, hash []byte, sig *Signature) error {
+	return secp256k1.VerifySignature(pubKey, hash, sig)
+}
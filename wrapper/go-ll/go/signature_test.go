@@ -0,0 +1,76 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+package dkls
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignatureRecoveryID(t *testing.T) {
+	shares, err := runDKG(2, 2)
+	if err != nil {
+		t.Fatalf("DKG failed: %v", err)
+	}
+	defer func() {
+		for _, share := range shares {
+			share.Free()
+		}
+	}()
+	derived, _, err := shares[0].DerivePublicKey("m/0/1")
+	if err != nil {
+		t.Fatalf("failed to derive public key: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	messageHash := bytes.Repeat([]byte{7}, 32)
+	for _, run := range []func(context.Context, Transport, string, *Keyshare, string, []byte, []byte) (*Signature, error){RunSign, RunSignOTVariant} {
+		net := newChanNetwork(2)
+		sigs := make([]*Signature, 2)
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i := range shares {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				sigs[i], errs[i] = run(ctx, net[i], "sign", shares[i], "m/0/1", messageHash, nil)
+			}(i)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("party %d: sign failed: %v", i, err)
+			}
+		}
+
+		sig := sigs[0]
+		if !bytes.Equal(sig.Bytes(), sigs[1].Bytes()) {
+			t.Error("signatures from different parties do not match")
+		}
+		if sig.RecoveryID > 1 {
+			t.Errorf("unexpected recovery ID %d", sig.RecoveryID)
+		}
+		if !bytes.Equal(sig.PublicKey, derived) {
+			t.Error("signature public key is not the derived key")
+		}
+		if err := VerifySignature(derived, messageHash, sig); err != nil {
+			t.Errorf("signature does not verify: %v", err)
+		}
+		parsed, err := ParseDERSignature(sig.DER())
+		if err != nil {
+			t.Fatalf("failed to parse DER: %v", err)
+		}
+		if err := VerifySignature(derived, messageHash, parsed); err != nil {
+			t.Errorf("DER round trip does not verify: %v", err)
+		}
+		root, _ := shares[0].PublicKey()
+		if err := VerifySignature(root, messageHash, sig); err == nil {
+			t.Error("signature verifies against the root key")
+		}
+	}
+}
@@ -1,23 +1,108 @@
 // Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
 // This software is licensed under the Silence Laboratories License Agreement.
 
+//! Stable error codes passed to Go in `GoError::code`.
+//!
+//! The codes are part of the FFI contract: never renumber them, only add
+//! new ones. Sign and OT variant sign errors share the codes of the
+//! variants they have in common.
+
+use std::os::raw::c_int;
+
 use crate::GoError;
 use dkls23_ll::{dkg::KeygenError, dsg::SignError, dsg_ot_variant::SignOTVariantError};
 
+/// Invalid argument, malformed data or any error without its own code.
+pub const ERR_GENERIC: c_int = 1;
+/// A Rust panic was caught at the FFI boundary.
+pub const ERR_PANIC: c_int = 10;
+/// A presignature was already used to sign a message.
+pub const ERR_PRESIGNATURE_USED: c_int = 11;
+/// A session was called in a round where the call is not allowed, such
+/// as a second first message.
+pub const ERR_INVALID_STATE: c_int = 12;
+
+pub const ERR_KEYGEN_INVALID_MESSAGE: c_int = 100;
+pub const ERR_KEYGEN_INVALID_COMMITMENT_HASH: c_int = 101;
+pub const ERR_KEYGEN_INVALID_DLOG_PROOF: c_int = 102;
+pub const ERR_KEYGEN_INVALID_POLYNOMIAL_POINT: c_int = 103;
+pub const ERR_KEYGEN_NOT_UNIQUE_XI_VALUES: c_int = 104;
+pub const ERR_KEYGEN_BIG_F_VEC_MISMATCH: c_int = 105;
+pub const ERR_KEYGEN_FAILED_FELDMAN_VERIFY: c_int = 106;
+pub const ERR_KEYGEN_PUBLIC_KEY_MISMATCH: c_int = 107;
+pub const ERR_KEYGEN_BIG_S_MISMATCH: c_int = 108;
+pub const ERR_KEYGEN_PPRF: c_int = 109;
+pub const ERR_KEYGEN_MISSING_MESSAGE: c_int = 110;
+pub const ERR_KEYGEN_INVALID_KEY_REFRESH: c_int = 111;
+pub const ERR_KEYGEN_INVALID_RANKS: c_int = 112;
+
+pub const ERR_SIGN_INVALID_COMMITMENT: c_int = 200;
+pub const ERR_SIGN_INVALID_DIGEST: c_int = 201;
+pub const ERR_SIGN_INVALID_FINAL_SESSION_ID: c_int = 202;
+pub const ERR_SIGN_FAILED_CHECK: c_int = 203;
+pub const ERR_SIGN_K256: c_int = 204;
+pub const ERR_SIGN_MISSING_MESSAGE: c_int = 205;
+/// The party in `GoError::party` misbehaved and must be excluded.
+pub const ERR_SIGN_ABORT_BAN_PARTY: c_int = 206;
+pub const ERR_SIGN_RVOLE: c_int = 207;
+/// The ranks of the signing parties do not allow them to sign.
+pub const ERR_SIGN_INVALID_QUORUM: c_int = 208;
+
 pub fn keygen_error_to_go(err: KeygenError) -> GoError {
-    GoError::new(&err.to_string(), 1)
+    let code = match err {
+        KeygenError::InvalidMessage => ERR_KEYGEN_INVALID_MESSAGE,
+        KeygenError::InvalidCommitmentHash => {
+            ERR_KEYGEN_INVALID_COMMITMENT_HASH
+        }
+        KeygenError::InvalidDLogProof => ERR_KEYGEN_INVALID_DLOG_PROOF,
+        KeygenError::InvalidPolynomialPoint => {
+            ERR_KEYGEN_INVALID_POLYNOMIAL_POINT
+        }
+        KeygenError::NotUniqueXiValues => ERR_KEYGEN_NOT_UNIQUE_XI_VALUES,
+        KeygenError::BigFVecMismatch => ERR_KEYGEN_BIG_F_VEC_MISMATCH,
+        KeygenError::FailedFelmanVerify => ERR_KEYGEN_FAILED_FELDMAN_VERIFY,
+        KeygenError::PublicKeyMismatch => ERR_KEYGEN_PUBLIC_KEY_MISMATCH,
+        KeygenError::BigSMismatch => ERR_KEYGEN_BIG_S_MISMATCH,
+        KeygenError::PPRFError(_) => ERR_KEYGEN_PPRF,
+        KeygenError::MissingMessage => ERR_KEYGEN_MISSING_MESSAGE,
+        KeygenError::InvalidKeyRefresh => ERR_KEYGEN_INVALID_KEY_REFRESH,
+        KeygenError::InvalidRanks => ERR_KEYGEN_INVALID_RANKS,
+    };
+    GoError::new(&err.to_string(), code)
 }
 
 pub fn sign_error_to_go(err: SignError) -> GoError {
-    let code = if matches!(err, SignError::AbortProtocolAndBanParty(_)) {
-        2
-    } else {
-        1
+    let code = match err {
+        SignError::InvalidCommitment => ERR_SIGN_INVALID_COMMITMENT,
+        SignError::InvalidDigest => ERR_SIGN_INVALID_DIGEST,
+        SignError::InvalidFinalSessionID => ERR_SIGN_INVALID_FINAL_SESSION_ID,
+        SignError::FailedCheck(_) => ERR_SIGN_FAILED_CHECK,
+        SignError::K256Error(_) => ERR_SIGN_K256,
+        SignError::MissingMessage => ERR_SIGN_MISSING_MESSAGE,
+        SignError::InvalidQuorum => ERR_SIGN_INVALID_QUORUM,
+        SignError::AbortProtocolAndBanParty(party) => {
+            return GoError::with_party(
+                &err.to_string(),
+                ERR_SIGN_ABORT_BAN_PARTY,
+                party,
+            );
+        }
     };
     GoError::new(&err.to_string(), code)
 }
 
-#[allow(dead_code)]
 pub fn sign_ot_variant_error_to_go(err: SignOTVariantError) -> GoError {
-    GoError::new(&err.to_string(), 1)
+    let code = match err {
+        SignOTVariantError::InvalidCommitment => ERR_SIGN_INVALID_COMMITMENT,
+        SignOTVariantError::InvalidDigest => ERR_SIGN_INVALID_DIGEST,
+        SignOTVariantError::InvalidFinalSessionID => {
+            ERR_SIGN_INVALID_FINAL_SESSION_ID
+        }
+        SignOTVariantError::FailedCheck(_) => ERR_SIGN_FAILED_CHECK,
+        SignOTVariantError::K256Error(_) => ERR_SIGN_K256,
+        SignOTVariantError::MissingMessage => ERR_SIGN_MISSING_MESSAGE,
+        SignOTVariantError::Rvole => ERR_SIGN_RVOLE,
+        SignOTVariantError::InvalidQuorum => ERR_SIGN_INVALID_QUORUM,
+    };
+    GoError::new(&err.to_string(), code)
 }
@@ -1,14 +1,22 @@
 // Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
 // This software is licensed under the Silence Laboratories License Agreement.
 
-use std::os::raw::{c_int, c_uchar};
+use std::os::raw::{c_char, c_int, c_uchar};
 use std::ptr;
+use std::str::FromStr;
 
+use derivation_path::DerivationPath;
 use k256::elliptic_curve::group::GroupEncoding;
+use k256::ProjectivePoint;
 
-use dkls23_ll::dkg;
+use dkls23_ll::{dkg, dsg};
 
-use crate::ByteBuffer;
+use crate::{
+    errors::ERR_GENERIC,
+    ffi_guard,
+    utils::{c_str_to_string, decode_keyshare, encode_keyshare},
+    ByteBuffer, GoError,
+};
 use std::slice;
 
 #[repr(C)]
@@ -26,36 +34,69 @@ impl KeyshareHandle {
 pub unsafe extern "C" fn dkls_keyshare_from_bytes(
     bytes: *const u8,
     len: usize,
+    err_out: *mut *mut GoError,
 ) -> *mut KeyshareHandle {
-    let slice = slice::from_raw_parts(bytes, len);
-    match ciborium::from_reader::<dkg::Keyshare, _>(slice) {
-        Ok(keyshare) => Box::into_raw(Box::new(KeyshareHandle::new(keyshare))),
-        Err(_) => ptr::null_mut(),
-    }
+    ffi_guard(err_out, || {
+        if bytes.is_null() || len == 0 {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("empty data", ERR_GENERIC)));
+            }
+            return ptr::null_mut();
+        }
+
+        let slice = slice::from_raw_parts(bytes, len);
+        match decode_keyshare(slice) {
+            Ok(keyshare) => Box::into_raw(Box::new(KeyshareHandle::new(keyshare))),
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(&e, ERR_GENERIC)));
+                }
+                ptr::null_mut()
+            }
+        }
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_keyshare_to_bytes(
     handle: *const KeyshareHandle,
 ) -> ByteBuffer {
-    if handle.is_null() {
-        return ByteBuffer {
-            data: ptr::null_mut(),
-            len: 0,
-            cap: 0,
-        };
-    }
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            };
+        }
 
-    let mut buffer = vec![];
-    if ciborium::into_writer(&(*handle).inner, &mut buffer).is_err() {
-        return ByteBuffer {
-            data: ptr::null_mut(),
-            len: 0,
-            cap: 0,
-        };
-    }
+        match encode_keyshare(&(*handle).inner) {
+            Some(buffer) => ByteBuffer::from_vec(buffer),
+            None => ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            },
+        }
+    })
+}
+
+/// Rank of every party, indexed by party ID
+#[no_mangle]
+pub unsafe extern "C" fn dkls_keyshare_ranks(
+    handle: *const KeyshareHandle,
+) -> ByteBuffer {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            };
+        }
 
-    ByteBuffer::from_vec(buffer)
+        ByteBuffer::from_vec((*handle).inner.rank_list.clone())
+    })
 }
 
 #[no_mangle]
@@ -63,55 +104,179 @@ pub unsafe extern "C" fn dkls_keyshare_public_key(
     handle: *const KeyshareHandle,
     out: *mut u8,
 ) -> c_int {
-    if handle.is_null() || out.is_null() {
-        return -1;
-    }
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() || out.is_null() {
+            return -1;
+        }
 
-    let bytes = (*handle).inner.public_key.to_bytes();
-    let bytes_slice: &[u8] = bytes.as_ref();
-    if bytes_slice.len() != 33 {
-        return -1;
-    }
+        let bytes = (*handle).inner.public_key.to_bytes();
+        let bytes_slice: &[u8] = bytes.as_ref();
+        if bytes_slice.len() != 33 {
+            return -1;
+        }
 
-    ptr::copy_nonoverlapping(bytes_slice.as_ptr(), out, 33);
-    0
+        ptr::copy_nonoverlapping(bytes_slice.as_ptr(), out, 33);
+        0
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_keyshare_participants(
     handle: *const KeyshareHandle,
 ) -> c_uchar {
-    if handle.is_null() {
-        return 0;
-    }
-    (*handle).inner.rank_list.len() as c_uchar
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return 0;
+        }
+        (*handle).inner.rank_list.len() as c_uchar
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_keyshare_threshold(
     handle: *const KeyshareHandle,
 ) -> c_uchar {
-    if handle.is_null() {
-        return 0;
-    }
-    (*handle).inner.threshold
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return 0;
+        }
+        (*handle).inner.threshold
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_keyshare_party_id(
     handle: *const KeyshareHandle,
 ) -> c_uchar {
-    if handle.is_null() {
-        return 0;
-    }
-    (*handle).inner.party_id
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return 0;
+        }
+        (*handle).inner.party_id
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_keyshare_final_session_id(
+    handle: *const KeyshareHandle,
+    out: *mut u8,
+) -> c_int {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() || out.is_null() {
+            return -1;
+        }
+
+        ptr::copy_nonoverlapping(
+            (*handle).inner.final_session_id().as_ptr(),
+            out,
+            32,
+        );
+        0
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_keyshare_root_chain_code(
+    handle: *const KeyshareHandle,
+    out: *mut u8,
+) -> c_int {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() || out.is_null() {
+            return -1;
+        }
+
+        ptr::copy_nonoverlapping((*handle).inner.root_chain_code.as_ptr(), out, 32);
+        0
+    })
+}
+
+/// Public shares of all parties, indexed by party ID, as concatenated
+/// 33-byte compressed points
+#[no_mangle]
+pub unsafe extern "C" fn dkls_keyshare_public_shares(
+    handle: *const KeyshareHandle,
+) -> ByteBuffer {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            };
+        }
+
+        let shares = (*handle).inner.big_s_list();
+        let mut buffer = Vec::with_capacity(shares.len() * 33);
+        for point in shares {
+            buffer.extend_from_slice(point.to_bytes().as_ref());
+        }
+
+        ByteBuffer::from_vec(buffer)
+    })
+}
+
+/// Derive the compressed public key (33 bytes) and chain code (32 bytes)
+/// of the child key at a non-hardened derivation path
+#[no_mangle]
+pub unsafe extern "C" fn dkls_keyshare_derive_public_key(
+    handle: *const KeyshareHandle,
+    chain_path: *const c_char,
+    pk_out: *mut u8,
+    chain_code_out: *mut u8,
+    err_out: *mut *mut GoError,
+) -> c_int {
+    ffi_guard(err_out, || {
+        if handle.is_null() || pk_out.is_null() || chain_code_out.is_null() {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null argument", ERR_GENERIC)));
+            }
+            return -1;
+        }
+
+        let chain_path = match c_str_to_string(chain_path)
+            .ok()
+            .and_then(|path| DerivationPath::from_str(&path).ok())
+        {
+            Some(path) => path,
+            None => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("invalid derivation path", ERR_GENERIC)));
+                }
+                return -1;
+            }
+        };
+
+        let keyshare = &(*handle).inner;
+        match dsg::derive_child_public_key(
+            &ProjectivePoint::from(keyshare.public_key),
+            &keyshare.root_chain_code,
+            &chain_path,
+        ) {
+            Ok((pk, chain_code)) => {
+                ptr::copy_nonoverlapping(pk.to_bytes().as_ptr(), pk_out, 33);
+                ptr::copy_nonoverlapping(chain_code.as_ptr(), chain_code_out, 32);
+                0
+            }
+            Err(_) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(
+                        "failed to derive public key, hardened derivation is not supported",
+                        ERR_GENERIC,
+                    )));
+                }
+                -1
+            }
+        }
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_keyshare_free(handle: *mut KeyshareHandle) {
-    if handle.is_null() {
-        return;
-    }
-    let _ = Box::from_raw(handle);
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return;
+        }
+        let _ = Box::from_raw(handle);
+    })
 }
 
@@ -3,8 +3,10 @@
 
 #![allow(clippy::missing_safety_doc)]
 
+use std::any::Any;
 use std::ffi::CString;
-use std::os::raw::{c_char, c_int};
+use std::os::raw::{c_char, c_int, c_uchar};
+use std::panic::{self, AssertUnwindSafe};
 use std::ptr;
 
 use rand::prelude::*;
@@ -14,6 +16,7 @@ mod errors;
 mod keygen;
 mod keyshare;
 mod message;
+mod presignature;
 mod sign;
 mod sign_ot_variant;
 mod utils;
@@ -21,18 +24,94 @@ mod utils;
 pub use keygen::KeygenSessionHandle;
 pub use keyshare::KeyshareHandle;
 pub use message::{Message, MessageArray};
+pub use presignature::{PartialSignatureHandle, PreSignatureHandle};
 pub use sign::SignSessionHandle;
 pub use sign_ot_variant::SignSessionOTVariantHandle;
 
-pub fn maybe_seeded_rng(seed: Option<&[u8]>) -> ChaCha20Rng {
+pub fn maybe_seeded_rng(seed: Option<&[u8]>) -> Result<ChaCha20Rng, GoError> {
     let seed = match seed {
         None => rand::thread_rng().gen(),
-        Some(seed) => {
-            seed.try_into().expect("invalid seed size")
-        }
+        Some(seed) => seed.try_into().map_err(|_| {
+            GoError::new("seed must be 32 bytes", errors::ERR_GENERIC)
+        })?,
     };
 
-    ChaCha20Rng::from_seed(seed)
+    Ok(ChaCha20Rng::from_seed(seed))
+}
+
+/// Value returned by an exported function whose body panicked.
+pub(crate) trait PanicDefault {
+    fn panic_default() -> Self;
+}
+
+impl<T> PanicDefault for *mut T {
+    fn panic_default() -> Self {
+        ptr::null_mut()
+    }
+}
+
+impl<T> PanicDefault for *const T {
+    fn panic_default() -> Self {
+        ptr::null()
+    }
+}
+
+impl PanicDefault for c_int {
+    fn panic_default() -> Self {
+        -1
+    }
+}
+
+impl PanicDefault for c_uchar {
+    fn panic_default() -> Self {
+        0
+    }
+}
+
+impl PanicDefault for () {
+    fn panic_default() -> Self {}
+}
+
+impl PanicDefault for ByteBuffer {
+    fn panic_default() -> Self {
+        ByteBuffer {
+            data: ptr::null_mut(),
+            len: 0,
+            cap: 0,
+        }
+    }
+}
+
+fn panic_message(payload: &(dyn Any + Send)) -> String {
+    if let Some(msg) = payload.downcast_ref::<&str>() {
+        msg.to_string()
+    } else if let Some(msg) = payload.downcast_ref::<String>() {
+        msg.clone()
+    } else {
+        "unknown panic".to_string()
+    }
+}
+
+/// Run the body of an exported function. A panic must not unwind into
+/// Go, where it aborts the process: it is reported in `err_out` with code
+/// `ERR_PANIC` and the function returns `T::panic_default()`.
+pub(crate) unsafe fn ffi_guard<T: PanicDefault>(
+    err_out: *mut *mut GoError,
+    body: impl FnOnce() -> T,
+) -> T {
+    match panic::catch_unwind(AssertUnwindSafe(body)) {
+        Ok(value) => value,
+        Err(payload) => {
+            if !err_out.is_null() && (*err_out).is_null() {
+                let msg = format!("panic: {}", panic_message(&*payload));
+                *err_out = Box::into_raw(Box::new(GoError::new(
+                    &msg,
+                    errors::ERR_PANIC,
+                )));
+            }
+            T::panic_default()
+        }
+    }
 }
 
 // Error handling
@@ -40,44 +119,72 @@ pub fn maybe_seeded_rng(seed: Option<&[u8]>) -> ChaCha20Rng {
 pub struct GoError {
     message: *mut c_char,
     code: c_int,
+    // Party to exclude from the next attempt, or -1
+    party: c_int,
 }
 
 impl GoError {
     fn new(msg: &str, code: c_int) -> Self {
-        let c_str = CString::new(msg).unwrap();
+        // CString::new only fails on interior NUL bytes
+        let c_str = CString::new(msg.replace('\0', " ")).unwrap_or_default();
         GoError {
             message: c_str.into_raw(),
             code,
+            party: -1,
         }
     }
 
+    fn with_party(msg: &str, code: c_int, party: u8) -> Self {
+        GoError {
+            party: party as c_int,
+            ..GoError::new(msg, code)
+        }
+    }
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_free_error(err: *mut GoError) {
-    if err.is_null() {
-        return;
-    }
-    if !(*err).message.is_null() {
-        let _ = CString::from_raw((*err).message);
-    }
-    let _ = Box::from_raw(err);
+    ffi_guard(ptr::null_mut(), || {
+        if err.is_null() {
+            return;
+        }
+        if !(*err).message.is_null() {
+            let _ = CString::from_raw((*err).message);
+        }
+        let _ = Box::from_raw(err);
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_error_message(err: *const GoError) -> *const c_char {
-    if err.is_null() || (*err).message.is_null() {
-        return ptr::null();
-    }
-    (*err).message
+    ffi_guard(ptr::null_mut(), || {
+        if err.is_null() || (*err).message.is_null() {
+            return ptr::null();
+        }
+        (*err).message
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_error_code(err: *const GoError) -> c_int {
-    if err.is_null() {
-        return -1;
-    }
-    (*err).code
+    ffi_guard(ptr::null_mut(), || {
+        if err.is_null() {
+            return -1;
+        }
+        (*err).code
+    })
+}
+
+/// Party that caused the error, or -1 if the error is not attributed to
+/// a party.
+#[no_mangle]
+pub unsafe extern "C" fn dkls_error_party(err: *const GoError) -> c_int {
+    ffi_guard(ptr::null_mut(), || {
+        if err.is_null() {
+            return -1;
+        }
+        (*err).party
+    })
 }
 
 // Byte buffer helpers
@@ -103,8 +210,10 @@ impl ByteBuffer {
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_free_bytes(buf: ByteBuffer) {
-    if buf.data.is_null() {
-        return;
-    }
-    let _ = Vec::from_raw_parts(buf.data, buf.len, buf.cap);
+    ffi_guard(ptr::null_mut(), || {
+        if buf.data.is_null() {
+            return;
+        }
+        let _ = Vec::from_raw_parts(buf.data, buf.len, buf.cap);
+    })
 }
@@ -3,7 +3,7 @@
 
 use serde::{de::DeserializeOwned, Serialize};
 
-use crate::ByteBuffer;
+use crate::{ffi_guard, ByteBuffer};
 
 pub trait MessageRouting {
     fn src_party_id(&self) -> u8;
@@ -60,16 +60,18 @@ impl Message {
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_message_free(msg: *mut Message) {
-    if msg.is_null() {
-        return;
-    }
-    let mut msg = Box::from_raw(msg);
-    let payload = std::mem::replace(&mut msg.payload, ByteBuffer {
-        data: ptr::null_mut(),
-        len: 0,
-        cap: 0,
-    });
-    dkls_free_bytes(payload);
+    ffi_guard(ptr::null_mut(), || {
+        if msg.is_null() {
+            return;
+        }
+        let mut msg = Box::from_raw(msg);
+        let payload = std::mem::replace(&mut msg.payload, ByteBuffer {
+            data: ptr::null_mut(),
+            len: 0,
+            cap: 0,
+        });
+        dkls_free_bytes(payload);
+    })
 }
 
 #[no_mangle]
@@ -77,19 +79,21 @@ pub unsafe extern "C" fn dkls_message_free_array(
     msgs: *mut Message,
     len: usize,
 ) {
-    if msgs.is_null() {
-        return;
-    }
-    let slice = std::slice::from_raw_parts_mut(msgs, len);
-    for msg in slice {
-        let payload = std::mem::replace(&mut msg.payload, ByteBuffer {
-            data: ptr::null_mut(),
-            len: 0,
-            cap: 0,
-        });
-        dkls_free_bytes(payload);
-    }
-    let _ = Vec::from_raw_parts(msgs, len, len);
+    ffi_guard(ptr::null_mut(), || {
+        if msgs.is_null() {
+            return;
+        }
+        let slice = std::slice::from_raw_parts_mut(msgs, len);
+        for msg in slice {
+            let payload = std::mem::replace(&mut msg.payload, ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            });
+            dkls_free_bytes(payload);
+        }
+        let _ = Vec::from_raw_parts(msgs, len, len);
+    })
 }
 
 use crate::dkls_free_bytes;
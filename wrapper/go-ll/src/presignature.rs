@@ -0,0 +1,372 @@
+// Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
+// This software is licensed under the Silence Laboratories License Agreement.
+
+use std::os::raw::{c_int, c_uchar};
+use std::ptr;
+
+use k256::elliptic_curve::group::GroupEncoding;
+
+use dkls23_ll::dsg;
+
+use crate::{
+    errors::{sign_error_to_go, ERR_PRESIGNATURE_USED},
+    message::Message,
+    utils::{
+        decode_session, encode_session, is_presignature_used,
+        mark_presignature_used, SESSION_KIND_PARTIAL_SIGNATURE,
+        SESSION_KIND_PRESIGNATURE, write_signature,
+    },
+    ffi_guard, ByteBuffer, GoError,
+};
+
+pub struct PreSignatureHandle {
+    pub(crate) inner: dsg::PreSignature,
+}
+
+impl PreSignatureHandle {
+    pub(crate) fn new(inner: dsg::PreSignature) -> Self {
+        Self { inner }
+    }
+}
+
+pub struct PartialSignatureHandle {
+    pub(crate) inner: dsg::PartialSignature,
+}
+
+impl PartialSignatureHandle {
+    pub(crate) fn new(inner: dsg::PartialSignature) -> Self {
+        Self { inner }
+    }
+
+    fn msg4(&self) -> dsg::SignMsg4 {
+        dsg::SignMsg4 {
+            from_id: self.inner.party_id,
+            session_id: self.inner.final_session_id,
+            s_0: self.inner.s_0,
+            s_1: self.inner.s_1,
+        }
+    }
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_presignature_to_bytes(
+    handle: *const PreSignatureHandle,
+) -> ByteBuffer {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            };
+        }
+
+        match encode_session(SESSION_KIND_PRESIGNATURE, &(*handle).inner) {
+            Some(buffer) => ByteBuffer::from_vec(buffer),
+            None => ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            },
+        }
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_presignature_from_bytes(
+    bytes: *const u8,
+    len: usize,
+    err_out: *mut *mut GoError,
+) -> *mut PreSignatureHandle {
+    ffi_guard(err_out, || {
+        if bytes.is_null() || len == 0 {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("empty data", 1)));
+            }
+            return ptr::null_mut();
+        }
+
+        let bytes = std::slice::from_raw_parts(bytes, len);
+        let pre = match decode_session::<dsg::PreSignature>(
+            SESSION_KIND_PRESIGNATURE,
+            bytes,
+        ) {
+            Ok(pre) => pre,
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
+                }
+                return ptr::null_mut();
+            }
+        };
+
+        if is_presignature_used(&pre) {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new(
+                    "presignature already used",
+                    ERR_PRESIGNATURE_USED,
+                )));
+            }
+            return ptr::null_mut();
+        }
+
+        Box::into_raw(Box::new(PreSignatureHandle::new(pre)))
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_presignature_final_session_id(
+    handle: *const PreSignatureHandle,
+    out: *mut u8,
+) -> c_int {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() || out.is_null() {
+            return -1;
+        }
+
+        ptr::copy_nonoverlapping(
+            (*handle).inner.final_session_id.as_ptr(),
+            out,
+            32,
+        );
+        0
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_presignature_party_id(
+    handle: *const PreSignatureHandle,
+) -> c_uchar {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return 0;
+        }
+        (*handle).inner.from_id
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_presignature_public_key(
+    handle: *const PreSignatureHandle,
+    out: *mut u8,
+) -> c_int {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() || out.is_null() {
+            return -1;
+        }
+
+        let bytes = (*handle).inner.public_key.to_bytes();
+        let bytes_slice: &[u8] = bytes.as_ref();
+        if bytes_slice.len() != 33 {
+            return -1;
+        }
+
+        ptr::copy_nonoverlapping(bytes_slice.as_ptr(), out, 33);
+        0
+    })
+}
+
+/// Turn the presignature into a partial signature of `message_hash`.
+/// The presignature handle is consumed, also on error.
+#[no_mangle]
+pub unsafe extern "C" fn dkls_presignature_sign(
+    handle: *mut PreSignatureHandle,
+    message_hash: *const u8,
+    message_hash_len: usize,
+    err_out: *mut *mut GoError,
+) -> *mut PartialSignatureHandle {
+    ffi_guard(err_out, || {
+        if handle.is_null() {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+            }
+            return ptr::null_mut();
+        }
+
+        let pre = Box::from_raw(handle).inner;
+        if message_hash.is_null() || message_hash_len != 32 {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("invalid message hash", 1)));
+            }
+            return ptr::null_mut();
+        }
+
+        let hash: [u8; 32] = std::slice::from_raw_parts(message_hash, 32)
+            .try_into()
+            .unwrap();
+
+        if !mark_presignature_used(&pre, &hash) {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new(
+                    "presignature already used",
+                    ERR_PRESIGNATURE_USED,
+                )));
+            }
+            return ptr::null_mut();
+        }
+
+        let (partial, _msg4) = dsg::create_partial_signature(pre, hash);
+        Box::into_raw(Box::new(PartialSignatureHandle::new(partial)))
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_presignature_free(
+    handle: *mut PreSignatureHandle,
+) {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return;
+        }
+        let _ = Box::from_raw(handle);
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_partial_signature_to_bytes(
+    handle: *const PartialSignatureHandle,
+) -> ByteBuffer {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            };
+        }
+
+        match encode_session(SESSION_KIND_PARTIAL_SIGNATURE, &(*handle).inner) {
+            Some(buffer) => ByteBuffer::from_vec(buffer),
+            None => ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            },
+        }
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_partial_signature_from_bytes(
+    bytes: *const u8,
+    len: usize,
+    err_out: *mut *mut GoError,
+) -> *mut PartialSignatureHandle {
+    ffi_guard(err_out, || {
+        if bytes.is_null() || len == 0 {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("empty data", 1)));
+            }
+            return ptr::null_mut();
+        }
+
+        let bytes = std::slice::from_raw_parts(bytes, len);
+        match decode_session::<dsg::PartialSignature>(
+            SESSION_KIND_PARTIAL_SIGNATURE,
+            bytes,
+        ) {
+            Ok(partial) => {
+                Box::into_raw(Box::new(PartialSignatureHandle::new(partial)))
+            }
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
+                }
+                ptr::null_mut()
+            }
+        }
+    })
+}
+
+/// Return the SignMsg4 that must be broadcast to the other parties.
+#[no_mangle]
+pub unsafe extern "C" fn dkls_partial_signature_message(
+    handle: *const PartialSignatureHandle,
+    err_out: *mut *mut GoError,
+) -> *mut Message {
+    ffi_guard(err_out, || {
+        if handle.is_null() {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+            }
+            return ptr::null_mut();
+        }
+
+        Box::into_raw(Box::new(Message::new((*handle).msg4())))
+    })
+}
+
+/// Combine the partial signature with SignMsg4 of the other parties.
+/// The partial signature handle is consumed.
+#[no_mangle]
+pub unsafe extern "C" fn dkls_partial_signature_combine(
+    handle: *mut PartialSignatureHandle,
+    msgs: *const Message,
+    msgs_len: usize,
+    r_out: *mut u8,
+    s_out: *mut u8,
+    recid_out: *mut u8,
+    pk_out: *mut u8,
+    err_out: *mut *mut GoError,
+) -> c_int {
+    ffi_guard(err_out, || {
+        if handle.is_null()
+            || r_out.is_null()
+            || s_out.is_null()
+            || recid_out.is_null()
+            || pk_out.is_null()
+        {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle or output", 1)));
+            }
+            return -1;
+        }
+
+        let partial = Box::from_raw(handle).inner;
+        let public_key = partial.public_key;
+        let message_hash = partial.message_hash;
+
+        let msgs_slice = std::slice::from_raw_parts(msgs, msgs_len);
+        let msgs_vec: Result<Vec<dsg::SignMsg4>, String> =
+            Message::decode_vector(msgs_slice);
+        let msgs_vec = match msgs_vec {
+            Ok(v) => v,
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
+                }
+                return -1;
+            }
+        };
+
+        match dsg::combine_signatures(partial, msgs_vec) {
+            Ok(sign) => match write_signature(&sign, &public_key, &message_hash, r_out, s_out, recid_out, pk_out) {
+                Ok(()) => 0,
+                Err(e) => {
+                    if !err_out.is_null() {
+                        *err_out = Box::into_raw(Box::new(GoError::new(e, 1)));
+                    }
+                    -1
+                }
+            },
+            Err(err) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(sign_error_to_go(err)));
+                }
+                -1
+            }
+        }
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_partial_signature_free(
+    handle: *mut PartialSignatureHandle,
+) {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return;
+        }
+        let _ = Box::from_raw(handle);
+    })
+}
@@ -10,12 +10,19 @@ use serde::{de::DeserializeOwned, Deserialize, Serialize};
 use dkls23_ll::dsg;
 
 use crate::{
-    errors::sign_error_to_go,
+    errors::{
+        sign_error_to_go, ERR_GENERIC, ERR_INVALID_STATE, ERR_PRESIGNATURE_USED,
+    },
     keyshare::KeyshareHandle,
     maybe_seeded_rng,
     message::{Message, MessageRouting},
-    utils::c_str_to_string,
-    ByteBuffer, GoError,
+    presignature::PreSignatureHandle,
+    utils::{
+        c_str_to_string, decode_session, encode_session,
+        is_presignature_used, mark_presignature_used, write_signature,
+        SESSION_KIND_SIGN,
+    },
+    ffi_guard, ByteBuffer, GoError,
 };
 
 #[derive(Serialize, Deserialize)]
@@ -30,10 +37,7 @@ enum Round {
     Finished,
 }
 
-// Note: PreSignature and PartialSignature don't implement Clone
-// We'll handle serialization differently - only serialize when in a serializable state
-
-#[repr(C)]
+#[derive(Serialize, Deserialize)]
 pub struct SignSessionHandle {
     state: dsg::State,
     round: Round,
@@ -56,104 +60,164 @@ pub unsafe extern "C" fn dkls_sign_new(
     seed_len: usize,
     err_out: *mut *mut GoError,
 ) -> *mut SignSessionHandle {
-    if keyshare.is_null() {
-        if !err_out.is_null() {
-            *err_out = Box::into_raw(Box::new(GoError::new("null keyshare", 1)));
-        }
-        return ptr::null_mut();
-    }
-
-    let chain_path_str = match c_str_to_string(chain_path) {
-        Ok(s) => s,
-        Err(e) => {
+    ffi_guard(err_out, || {
+        if keyshare.is_null() {
             if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
+                *err_out = Box::into_raw(Box::new(GoError::new("null keyshare", 1)));
             }
             return ptr::null_mut();
         }
-    };
 
-    let chain_path = match DerivationPath::from_str(&chain_path_str) {
-        Ok(p) => p,
-        Err(_) => {
-            if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new("invalid derivation path", 1)));
+        let chain_path_str = match c_str_to_string(chain_path) {
+            Ok(s) => s,
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
+                }
+                return ptr::null_mut();
             }
-            return ptr::null_mut();
-        }
-    };
+        };
 
-    let seed = if seed.is_null() || seed_len == 0 {
-        None
-    } else {
-        Some(std::slice::from_raw_parts(seed, seed_len))
-    };
+        let chain_path = match DerivationPath::from_str(&chain_path_str) {
+            Ok(p) => p,
+            Err(_) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("invalid derivation path", 1)));
+                }
+                return ptr::null_mut();
+            }
+        };
 
-    let mut rng = maybe_seeded_rng(seed);
+        let seed = if seed.is_null() || seed_len == 0 {
+            None
+        } else {
+            Some(std::slice::from_raw_parts(seed, seed_len))
+        };
 
-    match dsg::State::new(&mut rng, (*keyshare).inner.clone(), &chain_path) {
-        Ok(state) => Box::into_raw(Box::new(SignSessionHandle::new(state))),
-        Err(_e) => {
-            if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new("sign session init failed", 1)));
+        let mut rng = match maybe_seeded_rng(seed) {
+            Ok(rng) => rng,
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(e));
+                }
+                return ptr::null_mut();
             }
-            ptr::null_mut()
-        }
-    }
-}
+        };
 
-#[derive(Serialize, Deserialize)]
-struct SignSessionSerializable {
-    round: Round,
+        match dsg::State::new(&mut rng, (*keyshare).inner.clone(), &chain_path) {
+            Ok(state) => Box::into_raw(Box::new(SignSessionHandle::new(state))),
+            Err(_e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("sign session init failed", 1)));
+                }
+                ptr::null_mut()
+            }
+        }
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_sign_to_bytes(
     handle: *const SignSessionHandle,
 ) -> ByteBuffer {
-    if handle.is_null() {
-        return ByteBuffer {
-            data: ptr::null_mut(),
-            len: 0,
-            cap: 0,
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            };
+        }
+
+        match encode_session(SESSION_KIND_SIGN, &*handle) {
+            Some(buffer) => ByteBuffer::from_vec(buffer),
+            None => ByteBuffer {
+                data: ptr::null_mut(),
+                len: 0,
+                cap: 0,
+            },
+        }
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_sign_from_bytes(
+    bytes: *const u8,
+    len: usize,
+    err_out: *mut *mut GoError,
+) -> *mut SignSessionHandle {
+    ffi_guard(err_out, || {
+        if bytes.is_null() || len == 0 {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("empty data", 1)));
+            }
+            return ptr::null_mut();
+        }
+
+        let bytes = std::slice::from_raw_parts(bytes, len);
+        let session = match decode_session::<SignSessionHandle>(SESSION_KIND_SIGN, bytes) {
+            Ok(session) => session,
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
+                }
+                return ptr::null_mut();
+            }
         };
-    }
 
-    // Note: State cannot be serialized, and Pre/PartialSignature don't implement Clone
-    // We can only serialize when not in Pre or WaitMsg4 states
-    let round = match &(*handle).round {
-        Round::Init => Round::Init,
-        Round::WaitMsg1 => Round::WaitMsg1,
-        Round::WaitMsg2 => Round::WaitMsg2,
-        Round::WaitMsg3 => Round::WaitMsg3,
-        Round::Pre(_) => return ByteBuffer { data: ptr::null_mut(), len: 0, cap: 0 }, // Cannot serialize Pre state
-        Round::WaitMsg4(_) => return ByteBuffer { data: ptr::null_mut(), len: 0, cap: 0 }, // Cannot serialize WaitMsg4 state
-        Round::Failed => Round::Failed,
-        Round::Finished => Round::Finished,
-    };
-    let serializable = SignSessionSerializable { round };
-
-    let mut buffer = vec![];
-    if ciborium::into_writer(&serializable, &mut buffer).is_err() {
-        return ByteBuffer {
-            data: ptr::null_mut(),
-            len: 0,
-            cap: 0,
+        let refused = match &session.round {
+            Round::Pre(pre) if is_presignature_used(&pre) => {
+                Some(("presignature already used", ERR_PRESIGNATURE_USED))
+            }
+            Round::Finished => Some(("session already finished", ERR_GENERIC)),
+            _ => None,
         };
-    }
 
-    ByteBuffer::from_vec(buffer)
+        if let Some((msg, code)) = refused {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new(msg, code)));
+            }
+            return ptr::null_mut();
+        }
+
+        Box::into_raw(Box::new(session))
+    })
 }
 
+/// Write the final session ID of the session, which identifies its
+/// presignature, to id_out (32 bytes) and the party ID to party_out.
+/// Returns 0 while the ID is not known yet, 1 once it is, 2 at the
+/// presignature round and 3 after the last message, with the signed hash
+/// written to hash_out (32 bytes). Returns -1 on error.
 #[no_mangle]
-pub unsafe extern "C" fn dkls_sign_from_bytes(
-    _bytes: *const u8,
-    _len: usize,
-) -> *mut SignSessionHandle {
-    // Note: We cannot fully deserialize because State is not serializable
-    // This function is provided for API compatibility but will return null
-    // In practice, sessions should be kept in memory and not serialized mid-protocol
-    ptr::null_mut()
+pub unsafe extern "C" fn dkls_sign_presignature_id(
+    handle: *const SignSessionHandle,
+    id_out: *mut u8,
+    party_out: *mut u8,
+    hash_out: *mut u8,
+) -> c_int {
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null()
+            || id_out.is_null()
+            || party_out.is_null()
+            || hash_out.is_null()
+        {
+            return -1;
+        }
+
+        let state = match &(*handle).round {
+            Round::WaitMsg2 | Round::WaitMsg3 => 1,
+            Round::Pre(_) => 2,
+            Round::WaitMsg4(partial) => {
+                ptr::copy_nonoverlapping(partial.message_hash.as_ptr(), hash_out, 32);
+                3
+            }
+            _ => return 0,
+        };
+        ptr::copy_nonoverlapping((*handle).state.final_session_id.as_ptr(), id_out, 32);
+        *party_out = (*handle).state.keyshare.party_id;
+        state
+    })
 }
 
 #[no_mangle]
@@ -161,25 +225,27 @@ pub unsafe extern "C" fn dkls_sign_create_first_message(
     handle: *mut SignSessionHandle,
     err_out: *mut *mut GoError,
 ) -> *mut Message {
-    if handle.is_null() {
-        if !err_out.is_null() {
-            *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+    ffi_guard(err_out, || {
+        if handle.is_null() {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+            }
+            return ptr::null_mut();
         }
-        return ptr::null_mut();
-    }
 
-    match (*handle).round {
-        Round::Init => {
-            (*handle).round = Round::WaitMsg1;
-            Box::into_raw(Box::new(Message::new((*handle).state.generate_msg1())))
-        }
-        _ => {
-            if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new("invalid state", 1)));
+        match (*handle).round {
+            Round::Init => {
+                (*handle).round = Round::WaitMsg1;
+                Box::into_raw(Box::new(Message::new((*handle).state.generate_msg1())))
+            }
+            _ => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("invalid state", ERR_INVALID_STATE)));
+                }
+                ptr::null_mut()
             }
-            ptr::null_mut()
         }
-    }
+    })
 }
 
 unsafe fn handle_messages<T, U, H>(
@@ -224,107 +290,117 @@ pub unsafe extern "C" fn dkls_sign_handle_messages(
     err_out: *mut *mut GoError,
     out: *mut crate::MessageArray,
 ) -> c_int {
-    if handle.is_null() {
-        if !err_out.is_null() {
-            *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+    ffi_guard(err_out, || {
+        if handle.is_null() {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+            }
+            return -1;
         }
-        return -1;
-    }
 
-    let seed = if seed.is_null() || seed_len == 0 {
-        None
-    } else {
-        Some(std::slice::from_raw_parts(seed, seed_len))
-    };
+        let seed = if seed.is_null() || seed_len == 0 {
+            None
+        } else {
+            Some(std::slice::from_raw_parts(seed, seed_len))
+        };
 
-    let mut rng = maybe_seeded_rng(seed);
-
-    let result = match &(*handle).round {
-        Round::WaitMsg1 => handle_messages(
-            handle,
-            msgs,
-            msgs_len,
-            |state, msgs| state.handle_msg1(&mut rng, msgs),
-            Round::WaitMsg2,
-        ),
-
-        Round::WaitMsg2 => handle_messages(
-            handle,
-            msgs,
-            msgs_len,
-            |state, msgs| state.handle_msg2(&mut rng, msgs),
-            Round::WaitMsg3,
-        ),
-
-        Round::WaitMsg3 => {
-            let msgs_slice = std::slice::from_raw_parts(msgs, msgs_len);
-            let msgs_vec: Result<Vec<dsg::SignMsg3>, String> =
-                Message::decode_vector(msgs_slice);
-            let msgs_vec = match msgs_vec {
-                Ok(v) => v,
-                Err(e) => {
-                    (*handle).round = Round::Failed;
-                    if !err_out.is_null() {
-                        *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
-                    }
-                    return -1;
+        let mut rng = match maybe_seeded_rng(seed) {
+            Ok(rng) => rng,
+            Err(e) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(e));
                 }
-            };
+                return -1;
+            }
+        };
 
-            match (*handle).state.handle_msg3(msgs_vec) {
-                Ok(pre) => {
-                    (*handle).round = Round::Pre(pre);
-                    Ok(vec![])
-                }
-                Err(err) => {
-                    (*handle).round = Round::Failed;
-                    Err(sign_error_to_go(err))
+        let result = match &(*handle).round {
+            Round::WaitMsg1 => handle_messages(
+                handle,
+                msgs,
+                msgs_len,
+                |state, msgs| state.handle_msg1(&mut rng, msgs),
+                Round::WaitMsg2,
+            ),
+
+            Round::WaitMsg2 => handle_messages(
+                handle,
+                msgs,
+                msgs_len,
+                |state, msgs| state.handle_msg2(&mut rng, msgs),
+                Round::WaitMsg3,
+            ),
+
+            Round::WaitMsg3 => {
+                let msgs_slice = std::slice::from_raw_parts(msgs, msgs_len);
+                let msgs_vec: Result<Vec<dsg::SignMsg3>, String> =
+                    Message::decode_vector(msgs_slice);
+                let msgs_vec = match msgs_vec {
+                    Ok(v) => v,
+                    Err(e) => {
+                        (*handle).round = Round::Failed;
+                        if !err_out.is_null() {
+                            *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
+                        }
+                        return -1;
+                    }
+                };
+
+                match (*handle).state.handle_msg3(msgs_vec) {
+                    Ok(pre) => {
+                        (*handle).round = Round::Pre(pre);
+                        Ok(vec![])
+                    }
+                    Err(err) => {
+                        (*handle).round = Round::Failed;
+                        Err(sign_error_to_go(err))
+                    }
                 }
             }
-        }
 
-        Round::Failed => {
-            if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new("failed", 1)));
+            Round::Failed => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("failed", 1)));
+                }
+                return -1;
             }
-            return -1;
-        }
 
-        _ => {
-            if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new("invalid session state", 1)));
+            _ => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("invalid session state", ERR_INVALID_STATE)));
+                }
+                return -1;
             }
-            return -1;
-        }
-    };
+        };
 
-    match result {
-        Ok(out_vec) => {
-            if out_vec.is_empty() {
-                if !out.is_null() {
-                    (*out).msgs = ptr::null_mut();
-                    (*out).len = 0;
+        match result {
+            Ok(out_vec) => {
+                if out_vec.is_empty() {
+                    if !out.is_null() {
+                        (*out).msgs = ptr::null_mut();
+                        (*out).len = 0;
+                    }
+                    return 0;
                 }
-                return 0;
-            }
 
-            let len = out_vec.len();
-            let boxed = out_vec.into_boxed_slice();
-            let ptr = Box::into_raw(boxed) as *mut Message;
+                let len = out_vec.len();
+                let boxed = out_vec.into_boxed_slice();
+                let ptr = Box::into_raw(boxed) as *mut Message;
 
-            if !out.is_null() {
-                (*out).msgs = ptr;
-                (*out).len = len;
+                if !out.is_null() {
+                    (*out).msgs = ptr;
+                    (*out).len = len;
+                }
+                0
             }
-            0
-        }
-        Err(err) => {
-            if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(err));
+            Err(err) => {
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(err));
+                }
+                -1
             }
-            -1
         }
-    }
+    })
 }
 
 #[no_mangle]
@@ -334,39 +410,81 @@ pub unsafe extern "C" fn dkls_sign_last_message(
     message_hash_len: usize,
     err_out: *mut *mut GoError,
 ) -> *mut Message {
-    if handle.is_null() {
-        if !err_out.is_null() {
-            *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+    ffi_guard(err_out, || {
+        if handle.is_null() {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+            }
+            return ptr::null_mut();
         }
-        return ptr::null_mut();
-    }
 
-    if message_hash_len != 32 {
-        if !err_out.is_null() {
-            *err_out = Box::into_raw(Box::new(GoError::new("invalid message hash", 1)));
+        if message_hash_len != 32 {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("invalid message hash", 1)));
+            }
+            return ptr::null_mut();
         }
-        return ptr::null_mut();
-    }
 
-    let hash: [u8; 32] = std::slice::from_raw_parts(message_hash, 32)
-        .try_into()
-        .unwrap();
-
-    let round = std::mem::replace(&mut (*handle).round, Round::Finished);
-    match round {
-        Round::Pre(pre) => {
-            let (partial, msg4) = dsg::create_partial_signature(pre, hash);
-            (*handle).round = Round::WaitMsg4(partial);
-            Box::into_raw(Box::new(Message::new(msg4)))
+        let hash: [u8; 32] = std::slice::from_raw_parts(message_hash, 32)
+            .try_into()
+            .unwrap();
+
+        let round = std::mem::replace(&mut (*handle).round, Round::Finished);
+        match round {
+            Round::Pre(pre) if !mark_presignature_used(&pre, &hash) => {
+                (*handle).round = Round::Failed;
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new(
+                        "presignature already used",
+                        ERR_PRESIGNATURE_USED,
+                    )));
+                }
+                ptr::null_mut()
+            }
+            Round::Pre(pre) => {
+                let (partial, msg4) = dsg::create_partial_signature(pre, hash);
+                (*handle).round = Round::WaitMsg4(partial);
+                Box::into_raw(Box::new(Message::new(msg4)))
+            }
+            prev => {
+                (*handle).round = prev;
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("invalid state", ERR_INVALID_STATE)));
+                }
+                ptr::null_mut()
+            }
         }
-        prev => {
-            (*handle).round = prev;
+    })
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn dkls_sign_presignature(
+    handle: *mut SignSessionHandle,
+    err_out: *mut *mut GoError,
+) -> *mut PreSignatureHandle {
+    ffi_guard(err_out, || {
+        if handle.is_null() {
             if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new("invalid state", 1)));
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle", 1)));
+            }
+            return ptr::null_mut();
+        }
+
+        let round = std::mem::replace(&mut (*handle).round, Round::Finished);
+        match round {
+            Round::Pre(pre) => {
+                let _ = Box::from_raw(handle);
+                Box::into_raw(Box::new(PreSignatureHandle::new(pre)))
+            }
+            prev => {
+                (*handle).round = prev;
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("invalid state", ERR_INVALID_STATE)));
+                }
+                ptr::null_mut()
             }
-            ptr::null_mut()
         }
-    }
+    })
 }
 
 #[no_mangle]
@@ -376,74 +494,83 @@ pub unsafe extern "C" fn dkls_sign_combine(
     msgs_len: usize,
     r_out: *mut u8,
     s_out: *mut u8,
+    recid_out: *mut u8,
+    pk_out: *mut u8,
     err_out: *mut *mut GoError,
 ) -> c_int {
-    if handle.is_null() || r_out.is_null() || s_out.is_null() {
-        if !err_out.is_null() {
-            *err_out = Box::into_raw(Box::new(GoError::new("null handle or output", 1)));
+    ffi_guard(err_out, || {
+        if handle.is_null()
+            || r_out.is_null()
+            || s_out.is_null()
+            || recid_out.is_null()
+            || pk_out.is_null()
+        {
+            if !err_out.is_null() {
+                *err_out = Box::into_raw(Box::new(GoError::new("null handle or output", 1)));
+            }
+            return -1;
         }
-        return -1;
-    }
 
-    let round = std::mem::replace(&mut (*handle).round, Round::Finished);
-    match round {
-        Round::WaitMsg4(partial) => {
-            let msgs_slice = std::slice::from_raw_parts(msgs, msgs_len);
-            let msgs_vec: Result<Vec<dsg::SignMsg4>, String> =
-                Message::decode_vector(msgs_slice);
-            let msgs_vec = match msgs_vec {
-                Ok(v) => v,
-                Err(e) => {
-                    let _ = Box::from_raw(handle);
-                    if !err_out.is_null() {
-                        *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
-                    }
-                    return -1;
-                }
-            };
-
-            match dsg::combine_signatures(partial, msgs_vec) {
-                Ok(sign) => {
-                    let (r, s) = sign.split_bytes();
-                    if r.len() != 32 || s.len() != 32 {
+        let round = std::mem::replace(&mut (*handle).round, Round::Finished);
+        match round {
+            Round::WaitMsg4(partial) => {
+                let public_key = partial.public_key;
+                let message_hash = partial.message_hash;
+                let msgs_slice = std::slice::from_raw_parts(msgs, msgs_len);
+                let msgs_vec: Result<Vec<dsg::SignMsg4>, String> =
+                    Message::decode_vector(msgs_slice);
+                let msgs_vec = match msgs_vec {
+                    Ok(v) => v,
+                    Err(e) => {
+                        let _ = Box::from_raw(handle);
                         if !err_out.is_null() {
-                            *err_out = Box::into_raw(Box::new(GoError::new("invalid signature size", 1)));
+                            *err_out = Box::into_raw(Box::new(GoError::new(&e, 1)));
                         }
-                        let _ = Box::from_raw(handle);
                         return -1;
                     }
+                };
 
-                    ptr::copy_nonoverlapping(r.as_ptr(), r_out, 32);
-                    ptr::copy_nonoverlapping(s.as_ptr(), s_out, 32);
-
-                    let _ = Box::from_raw(handle);
-                    0
-                }
-                Err(err) => {
-                    let _ = Box::from_raw(handle);
-                    if !err_out.is_null() {
-                        *err_out = Box::into_raw(Box::new(sign_error_to_go(err)));
+                match dsg::combine_signatures(partial, msgs_vec) {
+                    Ok(sign) => {
+                        let _ = Box::from_raw(handle);
+                        match write_signature(&sign, &public_key, &message_hash, r_out, s_out, recid_out, pk_out) {
+                            Ok(()) => 0,
+                            Err(e) => {
+                                if !err_out.is_null() {
+                                    *err_out = Box::into_raw(Box::new(GoError::new(e, 1)));
+                                }
+                                -1
+                            }
+                        }
+                    }
+                    Err(err) => {
+                        let _ = Box::from_raw(handle);
+                        if !err_out.is_null() {
+                            *err_out = Box::into_raw(Box::new(sign_error_to_go(err)));
+                        }
+                        -1
                     }
-                    -1
                 }
             }
-        }
-        _ => {
-            let _ = Box::from_raw(handle);
-            if !err_out.is_null() {
-                *err_out = Box::into_raw(Box::new(GoError::new("invalid state", 1)));
+            _ => {
+                let _ = Box::from_raw(handle);
+                if !err_out.is_null() {
+                    *err_out = Box::into_raw(Box::new(GoError::new("invalid state", ERR_INVALID_STATE)));
+                }
+                -1
             }
-            -1
         }
-    }
+    })
 }
 
 #[no_mangle]
 pub unsafe extern "C" fn dkls_sign_free(handle: *mut SignSessionHandle) {
-    if handle.is_null() {
-        return;
-    }
-    let _ = Box::from_raw(handle);
+    ffi_guard(ptr::null_mut(), || {
+        if handle.is_null() {
+            return;
+        }
+        let _ = Box::from_raw(handle);
+    })
 }
 
 impl MessageRouting for dsg::SignMsg1 {
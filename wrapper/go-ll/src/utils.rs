@@ -1,8 +1,19 @@
 // Copyright (c) Silence Laboratories Pte. Ltd. All Rights Reserved.
 // This software is licensed under the Silence Laboratories License Agreement.
 
+use std::collections::{BTreeMap, VecDeque};
 use std::ffi::CStr;
 use std::os::raw::c_char;
+use std::ptr;
+use std::sync::Mutex;
+
+use k256::ecdsa::{RecoveryId, Signature, VerifyingKey};
+use k256::elliptic_curve::group::GroupEncoding;
+use k256::AffinePoint;
+use serde::{de::DeserializeOwned, Serialize};
+use sha2::{Digest, Sha256};
+
+use dkls23_ll::{dkg, dsg};
 
 pub unsafe fn c_str_to_string(c_str: *const c_char) -> Result<String, String> {
     if c_str.is_null() {
@@ -14,3 +25,217 @@ pub unsafe fn c_str_to_string(c_str: *const c_char) -> Result<String, String> {
         .map_err(|e| format!("invalid UTF-8: {}", e))
 }
 
+/// Version of the serialized session layout. Bump it whenever a
+/// session handle or its round enum changes shape.
+pub const SESSION_FORMAT_VERSION: u8 = 1;
+
+/// Tag of a serialized keygen session.
+pub const SESSION_KIND_KEYGEN: u8 = b'K';
+
+/// Tag of a serialized sign session.
+pub const SESSION_KIND_SIGN: u8 = b'S';
+
+/// Tag of a serialized OT variant sign session.
+pub const SESSION_KIND_SIGN_OT_VARIANT: u8 = b'O';
+
+/// Tag of a serialized presignature.
+pub const SESSION_KIND_PRESIGNATURE: u8 = b'P';
+
+/// Tag of a serialized partial signature.
+pub const SESSION_KIND_PARTIAL_SIGNATURE: u8 = b'Q';
+
+/// Serialize a session as `[kind, version] || CBOR(session)`.
+pub fn encode_session<T: Serialize>(kind: u8, session: &T) -> Option<Vec<u8>> {
+    let mut buffer = vec![kind, SESSION_FORMAT_VERSION];
+    ciborium::into_writer(session, &mut buffer).ok()?;
+    Some(buffer)
+}
+
+/// Check the header written by `encode_session` and decode the session.
+pub fn decode_session<T: DeserializeOwned>(
+    kind: u8,
+    bytes: &[u8],
+) -> Result<T, String> {
+    match bytes {
+        [k, v, body @ ..] if *k == kind && *v == SESSION_FORMAT_VERSION => {
+            ciborium::from_reader(body)
+                .map_err(|e| format!("CBOR decode error: {}", e))
+        }
+        [k, v, ..] if *k == kind => {
+            Err(format!("unsupported session format version {}", v))
+        }
+        [_, _, ..] => Err("invalid session kind".to_string()),
+        _ => Err("truncated session data".to_string()),
+    }
+}
+
+/// Magic prefix of a serialized keyshare.
+pub const KEYSHARE_MAGIC: [u8; 4] = *b"DKLS";
+
+/// Version of the keyshare container layout. Bare CBOR keyshares written
+/// before the container existed are version 0.
+pub const KEYSHARE_FORMAT_VERSION: u8 = 1;
+
+/// Curve ID of secp256k1 in the keyshare container.
+pub const CURVE_SECP256K1: u8 = 1;
+
+/// Protocol version of bare CBOR keyshares, which carry no header.
+const LEGACY_PROTOCOL_VERSION: u16 = 1;
+
+const KEYSHARE_HEADER_LEN: usize = 8;
+const KEYSHARE_CHECKSUM_LEN: usize = 4;
+
+/// Serialize a keyshare as `magic || format version || protocol VERSION
+/// (u16 big endian) || curve ID || CBOR(keyshare) || checksum`, where the
+/// checksum is the first 4 bytes of the SHA-256 of everything before it.
+pub fn encode_keyshare(keyshare: &dkg::Keyshare) -> Option<Vec<u8>> {
+    let mut buffer = KEYSHARE_MAGIC.to_vec();
+    buffer.push(KEYSHARE_FORMAT_VERSION);
+    buffer.extend_from_slice(&dkls23_ll::VERSION.to_be_bytes());
+    buffer.push(CURVE_SECP256K1);
+    ciborium::into_writer(keyshare, &mut buffer).ok()?;
+    let checksum = Sha256::digest(&buffer);
+    buffer.extend_from_slice(&checksum[..KEYSHARE_CHECKSUM_LEN]);
+    Some(buffer)
+}
+
+/// Decode a keyshare written by `encode_keyshare`, or a bare CBOR keyshare
+/// of an older release.
+pub fn decode_keyshare(bytes: &[u8]) -> Result<dkg::Keyshare, String> {
+    if !bytes.starts_with(&KEYSHARE_MAGIC) {
+        return migrate_keyshare(0, LEGACY_PROTOCOL_VERSION, bytes);
+    }
+    if bytes.len() < KEYSHARE_HEADER_LEN + KEYSHARE_CHECKSUM_LEN {
+        return Err("truncated keyshare data".to_string());
+    }
+    let (content, checksum) =
+        bytes.split_at(bytes.len() - KEYSHARE_CHECKSUM_LEN);
+    if Sha256::digest(content)[..KEYSHARE_CHECKSUM_LEN] != *checksum {
+        return Err("keyshare checksum mismatch".to_string());
+    }
+
+    let format = content[4];
+    let protocol = u16::from_be_bytes([content[5], content[6]]);
+    let curve = content[7];
+    if curve != CURVE_SECP256K1 {
+        return Err(format!("unsupported curve ID {}", curve));
+    }
+    if protocol > dkls23_ll::VERSION {
+        return Err(format!(
+            "keyshare of protocol version {} is newer than supported version {}",
+            protocol,
+            dkls23_ll::VERSION
+        ));
+    }
+    migrate_keyshare(format, protocol, &content[KEYSHARE_HEADER_LEN..])
+}
+
+/// Decode the body of a keyshare of any known layout into the current
+/// `dkg::Keyshare`. When the layout or the protocol changes the shape of
+/// a keyshare, add an arm that decodes the old shape and converts it.
+fn migrate_keyshare(
+    format: u8,
+    protocol: u16,
+    body: &[u8],
+) -> Result<dkg::Keyshare, String> {
+    match (format, protocol) {
+        // Bare CBOR and container version 1 hold the same CBOR body
+        (0 | 1, 1) => ciborium::from_reader(body)
+            .map_err(|e| format!("CBOR decode error: {}", e)),
+        (0 | 1, v) => Err(format!("unsupported protocol version {}", v)),
+        (v, _) => Err(format!("unsupported keyshare format version {}", v)),
+    }
+}
+
+/// Most presignatures the in-process registry remembers. Past the limit
+/// the oldest entries are dropped, so the registry is only a guard
+/// against reuse within a running process; durable single-use protection
+/// comes from the PresignatureGuard of the Go wrapper, which a session
+/// needs to be serialized past the first round.
+const USED_PRESIGNATURES_LIMIT: usize = 1 << 16;
+
+/// Presignatures this process has turned into a partial signature, with
+/// the message hash each signed, in the order they were used. A
+/// presignature must never sign two different messages, so a restored
+/// session holding one of these is refused.
+struct UsedPresignatures {
+    hashes: BTreeMap<[u8; 32], [u8; 32]>,
+    order: VecDeque<[u8; 32]>,
+}
+
+static USED_PRESIGNATURES: Mutex<UsedPresignatures> =
+    Mutex::new(UsedPresignatures {
+        hashes: BTreeMap::new(),
+        order: VecDeque::new(),
+    });
+
+/// Identify a presignature of one party. The final_session_id is the
+/// same for every party of a sign session, so it is hashed with the
+/// secret values of this party: the presignatures of all parties run in
+/// one process are told apart, and the ID reveals nothing about them.
+fn presignature_id(pre: &dsg::PreSignature) -> [u8; 32] {
+    let mut h = Sha256::new();
+    h.update(b"dkls23-ll used presignature");
+    h.update(pre.final_session_id);
+    h.update([pre.from_id]);
+    h.update(pre.phi_i.to_bytes());
+    h.update(pre.s_0.to_bytes());
+    h.finalize().into()
+}
+
+/// Record that the presignature signs message_hash. Returns false if it
+/// has already signed another hash. Signing the same hash again, as a
+/// seeded session that is run twice does, yields the same partial
+/// signature and is allowed.
+pub fn mark_presignature_used(
+    pre: &dsg::PreSignature,
+    message_hash: &[u8; 32],
+) -> bool {
+    let id = presignature_id(pre);
+    let mut used =
+        USED_PRESIGNATURES.lock().unwrap_or_else(|e| e.into_inner());
+    if let Some(signed) = used.hashes.get(&id) {
+        return signed == message_hash;
+    }
+    used.hashes.insert(id, *message_hash);
+    used.order.push_back(id);
+    if used.order.len() > USED_PRESIGNATURES_LIMIT {
+        if let Some(oldest) = used.order.pop_front() {
+            used.hashes.remove(&oldest);
+        }
+    }
+    true
+}
+
+pub fn is_presignature_used(pre: &dsg::PreSignature) -> bool {
+    USED_PRESIGNATURES
+        .lock()
+        .unwrap_or_else(|e| e.into_inner())
+        .hashes
+        .contains_key(&presignature_id(pre))
+}
+
+/// Write r and s (32 bytes each), the recovery ID (1 byte) and the
+/// compressed public key the signature verifies against (33 bytes).
+pub unsafe fn write_signature(
+    sign: &Signature,
+    public_key: &AffinePoint,
+    message_hash: &[u8; 32],
+    r_out: *mut u8,
+    s_out: *mut u8,
+    recid_out: *mut u8,
+    pk_out: *mut u8,
+) -> Result<(), &'static str> {
+    let verifying_key = VerifyingKey::from_affine(*public_key)
+        .map_err(|_| "invalid public key")?;
+    let recid =
+        RecoveryId::trial_recovery_from_prehash(&verifying_key, message_hash, sign)
+            .map_err(|_| "failed to compute recovery ID")?;
+
+    let (r, s) = sign.split_bytes();
+    ptr::copy_nonoverlapping(r.as_ptr(), r_out, 32);
+    ptr::copy_nonoverlapping(s.as_ptr(), s_out, 32);
+    *recid_out = recid.to_byte();
+    ptr::copy_nonoverlapping(public_key.to_bytes().as_ptr(), pk_out, 33);
+    Ok(())
+}